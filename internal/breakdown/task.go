@@ -19,6 +19,7 @@ type TaskSpec struct {
 	DependsOn     []string `json:"depends_on"`      // References by title or index
 	Priority      int      `json:"priority"`
 	ParallelGroup string   `json:"parallel_group"`  // Tasks in same group can run in parallel
+	BestOf        int      `json:"best_of"`         // Independent attempts to keep the best of, for critical tasks
 }
 
 // BreakdownResult contains the parsed breakdown from Claude
@@ -65,6 +66,7 @@ func ConvertToTasks(specs []TaskSpec) []*state.Task {
 			FilesCreate:   spec.FilesCreate,
 			Priority:      spec.Priority,
 			ParallelGroup: spec.ParallelGroup,
+			BestOf:        spec.BestOf,
 			Status:        state.TaskStatusPending,
 		}
 		titleToID[spec.Title] = id
@@ -1,9 +1,11 @@
 package claude
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"os/exec"
 	"strings"
 )
@@ -57,6 +59,90 @@ func (c *Client) Execute(ctx context.Context, prompt string) (string, error) {
 	return stdout.String(), nil
 }
 
+// ExecuteStream runs Claude Code with stream-json output and returns the
+// final result text. Every raw JSONL line is copied to transcript and stderr
+// to stderrW; either may be nil.
+func (c *Client) ExecuteStream(ctx context.Context, prompt string, transcript, stderrW io.Writer) (string, error) {
+	claudePath := c.claudePath
+	if claudePath == "" {
+		var err error
+		claudePath, err = exec.LookPath("claude")
+		if err != nil {
+			return "", fmt.Errorf("claude code not found in PATH")
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, claudePath,
+		"--print",
+		"--output-format", "stream-json",
+		"--verbose", // Required for stream-json in print mode
+		"--dangerously-skip-permissions",
+	)
+	cmd.Dir = c.workDir
+	cmd.Stdin = strings.NewReader(prompt)
+
+	var stderr bytes.Buffer
+	if stderrW != nil {
+		cmd.Stderr = io.MultiWriter(&stderr, stderrW)
+	} else {
+		cmd.Stderr = &stderr
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", fmt.Errorf("failed to get stdout pipe: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return "", fmt.Errorf("failed to start claude: %w", err)
+	}
+
+	var text strings.Builder
+	var result string
+	var haveResult, resultIsError bool
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		if transcript != nil {
+			transcript.Write(append(append([]byte{}, line...), '\n'))
+		}
+
+		event, err := ParseEvent(line)
+		if err != nil {
+			continue
+		}
+		switch event.Type {
+		case EventTypeAssistant:
+			text.WriteString(event.GetText())
+		case EventTypeResult:
+			result, haveResult = event.GetResultText(), true
+			resultIsError = event.IsError
+		}
+	}
+	scanErr := scanner.Err()
+
+	output := text.String()
+	if haveResult {
+		output = result
+	}
+
+	if err := cmd.Wait(); err != nil {
+		return output, fmt.Errorf("claude code failed: %w: %s", err, stderr.String())
+	}
+	if scanErr != nil {
+		return output, fmt.Errorf("failed to read claude output: %w", scanErr)
+	}
+	if resultIsError {
+		return output, fmt.Errorf("claude code reported an error: %s", output)
+	}
+
+	return output, nil
+}
+
 // ExecuteWithModel runs Claude Code with a specific model
 func (c *Client) ExecuteWithModel(ctx context.Context, prompt, model string) (string, error) {
 	claudePath := c.claudePath
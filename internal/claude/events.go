@@ -32,6 +32,7 @@ type Event struct {
 	SessionID string          `json:"sessionId,omitempty"`
 	Error     string          `json:"error,omitempty"`
 	Result    json.RawMessage `json:"result,omitempty"`
+	IsError   bool            `json:"is_error,omitempty"`
 	Raw       json.RawMessage `json:"-"` // Original JSON for debugging
 }
 
@@ -156,6 +157,19 @@ func (e *Event) GetText() string {
 	return text
 }
 
+// GetResultText returns the final text of a result event
+func (e *Event) GetResultText() string {
+	if e.Type != EventTypeResult || len(e.Result) == 0 {
+		return ""
+	}
+
+	var text string
+	if err := json.Unmarshal(e.Result, &text); err != nil {
+		return string(e.Result)
+	}
+	return text
+}
+
 // IsAskUserQuestion checks if a tool use is an AskUserQuestion call
 func (tu *ToolUse) IsAskUserQuestion() bool {
 	return tu.Name == "AskUserQuestion"
@@ -1,5 +1,7 @@
 package claude
 
+import "strings"
+
 // PlanningSystemPrompt is the system prompt for the planning/breakdown phase
 // It instructs Claude to explore the codebase, ask questions, and generate tasks
 const PlanningSystemPrompt = `You are a feature planning assistant helping break down a feature into implementable tasks.
@@ -25,6 +27,7 @@ Design tasks for parallel execution:
 - Only add dependencies when truly necessary (shared state, file conflicts)
 - Assign parallel_group to tasks that can run simultaneously
 - Keep tasks focused and atomic
+- Set best_of (e.g. 3) only on critical tasks that most others depend on, such as a core API; they are attempted that many times and the best result kept
 
 ## Output Format
 
@@ -43,7 +46,8 @@ When you have enough information, output ONLY this JSON (no other text):
       "files_create": ["new files to create"],
       "depends_on": [],
       "priority": 1,
-      "parallel_group": "setup"
+      "parallel_group": "setup",
+      "best_of": 1
     }
   ],
   "assumptions": ["any assumptions made"]
@@ -81,3 +85,19 @@ func BuildPlanningPrompt(featureDesc string, projectType string) string {
 
 Please explore the codebase (if existing) and help me plan the implementation. Ask clarifying questions if needed, then provide a task breakdown.`
 }
+
+// BuildConflictPrompt asks Claude to resolve the conflicts a sync of the
+// feature branch with its base branch stopped on
+func BuildConflictPrompt(featureDesc, base, mode string, files []string) string {
+	return `## Resolve Sync Conflicts
+
+This branch implements the following feature:
+
+` + featureDesc + `
+
+It is being synced with the updated ` + "`" + base + "`" + ` branch (` + mode + `), which stopped on conflicts in:
+
+- ` + strings.Join(files, "\n- ") + `
+
+Edit each file so the conflict markers are gone and the result keeps both the feature's changes and the changes from ` + "`" + base + "`" + `. Only touch the conflicted files. Do not stage, commit, or run any git commands that change history; that is done for you afterwards.`
+}
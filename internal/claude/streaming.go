@@ -22,9 +22,10 @@ type StreamingClient struct {
 	stdout io.ReadCloser
 	stderr io.ReadCloser
 
-	mu        sync.Mutex
-	running   bool
-	sessionID string
+	mu         sync.Mutex
+	running    bool
+	sessionID  string
+	transcript io.Writer
 }
 
 // StreamingClientConfig configures the streaming client
@@ -70,6 +71,11 @@ type StreamOptions struct {
 
 	// SkipPermissions enables --dangerously-skip-permissions
 	SkipPermissions bool
+
+	// Transcript receives every raw JSONL line sent to or received from
+	// Claude, and Stderr everything Claude writes to stderr. Both optional.
+	Transcript io.Writer
+	Stderr     io.Writer
 }
 
 // Start begins a streaming session with the given prompt
@@ -80,6 +86,7 @@ func (c *StreamingClient) Start(ctx context.Context, prompt string, opts StreamO
 		return fmt.Errorf("client already running")
 	}
 	c.running = true
+	c.transcript = opts.Transcript
 	c.mu.Unlock()
 
 	// Find Claude binary
@@ -147,7 +154,7 @@ func (c *StreamingClient) Start(ctx context.Context, prompt string, opts StreamO
 	go c.processEvents(opts)
 
 	// Capture stderr
-	go c.captureStderr(opts.OnError)
+	go c.captureStderr(opts.OnError, opts.Stderr)
 
 	return nil
 }
@@ -169,10 +176,18 @@ func (c *StreamingClient) sendUserMessage(text string) error {
 		return err
 	}
 
+	c.record(data)
 	_, err = fmt.Fprintf(c.stdin, "%s\n", data)
 	return err
 }
 
+// record copies a raw JSONL line to the transcript, if any
+func (c *StreamingClient) record(line []byte) {
+	if c.transcript != nil {
+		c.transcript.Write(append(append([]byte{}, line...), '\n'))
+	}
+}
+
 // SendToolResult sends a tool result back to Claude
 func (c *StreamingClient) SendToolResult(result ToolResult) error {
 	c.mu.Lock()
@@ -202,6 +217,7 @@ func (c *StreamingClient) SendToolResult(result ToolResult) error {
 		return err
 	}
 
+	c.record(data)
 	_, err = fmt.Fprintf(c.stdin, "%s\n", data)
 	return err
 }
@@ -218,6 +234,7 @@ func (c *StreamingClient) processEvents(opts StreamOptions) {
 		if len(line) == 0 {
 			continue
 		}
+		c.record(line)
 
 		event, err := ParseEvent(line)
 		if err != nil {
@@ -284,7 +301,7 @@ func (c *StreamingClient) processEvents(opts StreamOptions) {
 }
 
 // captureStderr reads and reports stderr
-func (c *StreamingClient) captureStderr(onError func(error)) {
+func (c *StreamingClient) captureStderr(onError func(error), w io.Writer) {
 	scanner := bufio.NewScanner(c.stderr)
 	var stderrBuf strings.Builder
 
@@ -292,6 +309,9 @@ func (c *StreamingClient) captureStderr(onError func(error)) {
 		line := scanner.Text()
 		stderrBuf.WriteString(line)
 		stderrBuf.WriteString("\n")
+		if w != nil {
+			fmt.Fprintln(w, line)
+		}
 	}
 
 	if stderrBuf.Len() > 0 && onError != nil {
@@ -34,10 +34,11 @@ func init() {
 }
 
 func runClean(cmd *cobra.Command, args []string) error {
-	store, err := state.NewStore(cfg.StateDir)
+	store, err := openStore()
 	if err != nil {
-		return fmt.Errorf("failed to initialize state: %w", err)
+		return err
 	}
+	defer store.Close()
 
 	var runsToClean []*state.Run
 
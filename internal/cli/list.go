@@ -3,6 +3,7 @@ package cli
 import (
 	"fmt"
 	"path/filepath"
+	"time"
 
 	"github.com/howell-aikit/aiflow/internal/state"
 	"github.com/howell-aikit/aiflow/internal/worktree"
@@ -12,17 +13,30 @@ import (
 
 var (
 	listWorktrees bool
+	listStatus    string
+	listRepo      string
+	listSince     string
+	listLimit     int
 )
 
 var listCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List all runs or worktrees",
-	Long:  `List all aiflow runs and their status, or list worktrees with --worktrees flag.`,
+	Long: `List all aiflow runs and their status, or list worktrees with --worktrees flag.
+
+Runs can be filtered by status, source repository and age:
+  aiflow list --status running
+  aiflow list --status crashed     # Active runs whose process is gone
+  aiflow list --repo . --since 72h --limit 10`,
 	RunE:  runList,
 }
 
 func init() {
 	listCmd.Flags().BoolVarP(&listWorktrees, "worktrees", "w", false, "list worktrees instead of runs")
+	listCmd.Flags().StringVar(&listStatus, "status", "", "only show runs with this status")
+	listCmd.Flags().StringVar(&listRepo, "repo", "", "only show runs started from this repository or any of its worktrees")
+	listCmd.Flags().StringVar(&listSince, "since", "", "only show runs created within this duration (e.g. 24h) or since a date (YYYY-MM-DD)")
+	listCmd.Flags().IntVarP(&listLimit, "limit", "n", 0, "maximum number of runs to show")
 }
 
 func runList(cmd *cobra.Command, args []string) error {
@@ -33,16 +47,44 @@ func runList(cmd *cobra.Command, args []string) error {
 }
 
 func listRunsFunc() error {
-	store, err := state.NewStore(cfg.StateDir)
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	query, err := buildRunQuery()
 	if err != nil {
-		return fmt.Errorf("failed to initialize state: %w", err)
+		return err
+	}
+
+	// Crashed is derived from the run lease, not stored: query the runs
+	// that claim to be active and keep those whose lease holder is gone
+	crashedOnly := query.Status == state.RunStatusCrashed
+	limit := query.Limit
+	if crashedOnly {
+		query.Status = ""
+		query.Limit = 0
 	}
 
-	runs, err := store.ListRuns()
+	runs, err := store.QueryRuns(query)
 	if err != nil {
 		return fmt.Errorf("failed to list runs: %w", err)
 	}
 
+	if crashedOnly {
+		var crashed []*state.Run
+		for _, run := range runs {
+			if state.EffectiveStatus(cfg.StateDir, run) == state.RunStatusCrashed {
+				crashed = append(crashed, run)
+			}
+		}
+		if limit > 0 && len(crashed) > limit {
+			crashed = crashed[:limit]
+		}
+		runs = crashed
+	}
+
 	if len(runs) == 0 {
 		fmt.Println("No runs found")
 		return nil
@@ -76,7 +118,7 @@ func listRunsFunc() error {
 		fmt.Printf("%s%-9s %-12s %-40s %s\n",
 			marker,
 			run.ID,
-			run.Status,
+			state.EffectiveStatus(cfg.StateDir, run),
 			feature,
 			progress)
 	}
@@ -85,6 +127,39 @@ func listRunsFunc() error {
 	return nil
 }
 
+// buildRunQuery converts the list flags into a state query
+func buildRunQuery() (state.RunQuery, error) {
+	query := state.RunQuery{
+		Status: state.RunStatus(listStatus),
+		Limit:  listLimit,
+	}
+
+	if listRepo != "" {
+		absPath, err := filepath.Abs(listRepo)
+		if err != nil {
+			return query, fmt.Errorf("invalid --repo: %w", err)
+		}
+		repo, err := git.Open(absPath)
+		if err != nil {
+			return query, fmt.Errorf("invalid --repo: %w", err)
+		}
+		query.Repo = repo.Path()
+		query.CommonDir, _ = repo.CommonDir()
+	}
+
+	if listSince != "" {
+		if d, err := time.ParseDuration(listSince); err == nil {
+			query.Since = time.Now().Add(-d)
+		} else if t, err := time.ParseInLocation("2006-01-02", listSince, time.Local); err == nil {
+			query.Since = t
+		} else {
+			return query, fmt.Errorf("invalid --since %q: use a duration like 24h or a date like 2006-01-02", listSince)
+		}
+	}
+
+	return query, nil
+}
+
 func listWorktreesFunc() error {
 	repoPath, err := git.FindRepoRootFromCwd()
 	if err != nil {
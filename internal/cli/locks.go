@@ -0,0 +1,111 @@
+package cli
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/howell-aikit/aiflow/internal/scheduler"
+	"github.com/howell-aikit/aiflow/internal/state"
+	"github.com/spf13/cobra"
+)
+
+var (
+	locksRunID string
+	locksBreak string
+)
+
+var locksCmd = &cobra.Command{
+	Use:   "locks",
+	Short: "Inspect or force-release file locks",
+	Long: `Show the file locks held in a run's worktree, including which run, task
+and process holds each one. Locks whose holder is gone are marked stale.
+
+Use --break to force-release a lock after a crash.
+
+Examples:
+  aiflow locks                         # Locks in the current run's worktree
+  aiflow locks --run abc123            # Locks in a specific run's worktree
+  aiflow locks --break src/api.go      # Force-release the lock on a file`,
+	Args: cobra.NoArgs,
+	RunE: runLocks,
+}
+
+func init() {
+	locksCmd.Flags().StringVar(&locksRunID, "run", "", "run ID (default: current run)")
+	locksCmd.Flags().StringVar(&locksBreak, "break", "", "force-release the lock on this path")
+}
+
+func runLocks(cmd *cobra.Command, args []string) error {
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	var run *state.Run
+	if locksRunID != "" {
+		run, err = store.LoadRun(locksRunID)
+	} else {
+		run, err = store.GetCurrentRun()
+		if err == nil && run == nil {
+			return fmt.Errorf("no current run; specify a run ID with --run")
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load run: %w", err)
+	}
+
+	if locksBreak != "" {
+		holder, err := scheduler.BreakLock(run.WorktreePath, locksBreak)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Released lock on %s\n", locksBreak)
+		if holder != nil {
+			fmt.Printf("  Was held by run %s, task %s (pid %d on %s)\n",
+				holder.RunID, holder.TaskID, holder.PID, holder.Hostname)
+		}
+		return nil
+	}
+
+	locks, err := scheduler.ListLocks(run.WorktreePath)
+	if err != nil {
+		return err
+	}
+
+	if len(locks) == 0 {
+		fmt.Println("No locks held")
+		return nil
+	}
+
+	fmt.Printf("%-40s %-10s %-10s %-8s %-20s %-10s %s\n", "FILE", "RUN", "TASK", "PID", "HOST", "AGE", "STATE")
+	fmt.Printf("%-40s %-10s %-10s %-8s %-20s %-10s %s\n", "----", "---", "----", "---", "----", "---", "-----")
+
+	for _, lock := range locks {
+		file := lock.File
+		if len(file) > 38 {
+			file = "..." + file[len(file)-35:]
+		}
+
+		lockState := "held"
+		if lock.Stale {
+			lockState = "stale"
+		}
+
+		runID, taskID, pid, host, age := "?", "?", "?", "?", "?"
+		if h := lock.Holder; h != nil {
+			runID = h.RunID
+			taskID = h.TaskID
+			pid = fmt.Sprintf("%d", h.PID)
+			host = h.Hostname
+			if len(host) > 18 {
+				host = host[:15] + "..."
+			}
+			age = time.Since(h.AcquiredAt).Round(time.Second).String()
+		}
+
+		fmt.Printf("%-40s %-10s %-10s %-8s %-20s %-10s %s\n", file, runID, taskID, pid, host, age, lockState)
+	}
+
+	return nil
+}
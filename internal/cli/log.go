@@ -0,0 +1,144 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/howell-aikit/aiflow/internal/state"
+	"github.com/spf13/cobra"
+)
+
+var (
+	logFollow bool
+	logTaskID string
+)
+
+// logPollInterval is how often --follow checks the journal for new events
+const logPollInterval = 500 * time.Millisecond
+
+var logCmd = &cobra.Command{
+	Use:   "log [run-id]",
+	Short: "Show the event journal of a run",
+	Long: `Show the append-only event journal of a run: breakdown questions and
+answers, task starts, lock acquisition, agent results, summaries, commits and
+the actions chosen on failure or completion.
+
+Examples:
+  aiflow log                  # Journal of the current run
+  aiflow log abc123 --task t3 # Only events for one task
+  aiflow log -f               # Keep printing new events as they happen`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runLog,
+}
+
+func init() {
+	logCmd.Flags().BoolVarP(&logFollow, "follow", "f", false, "keep printing new events until interrupted")
+	logCmd.Flags().StringVar(&logTaskID, "task", "", "only show events for this task")
+}
+
+func runLog(cmd *cobra.Command, args []string) error {
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	var runID string
+	if len(args) > 0 {
+		runID = args[0]
+	} else {
+		runID, err = store.GetCurrentRunID()
+		if err == nil && runID == "" {
+			return fmt.Errorf("no current run; specify a run ID")
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load run: %w", err)
+	}
+	run, err := store.LoadRun(runID)
+	if err != nil {
+		return fmt.Errorf("failed to load run: %w", err)
+	}
+	if logTaskID != "" && run.GetTask(logTaskID) == nil {
+		return fmt.Errorf("task %s not found in run %s", logTaskID, runID)
+	}
+
+	var lastSeq int64
+	printed := 0
+	printNew := func() error {
+		events, err := store.ListEvents(runID)
+		if err != nil {
+			return fmt.Errorf("failed to read event log: %w", err)
+		}
+		for _, event := range events {
+			if event.Seq <= lastSeq {
+				continue
+			}
+			lastSeq = event.Seq
+			if logTaskID != "" && event.TaskID != logTaskID {
+				continue
+			}
+			fmt.Println(formatEvent(event))
+			printed++
+		}
+		return nil
+	}
+
+	if err := printNew(); err != nil {
+		return err
+	}
+	if !logFollow {
+		switch {
+		case lastSeq == 0:
+			fmt.Println("No events recorded")
+		case printed == 0:
+			fmt.Printf("No events for task %s\n", logTaskID)
+		}
+		return nil
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	ticker := time.NewTicker(logPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := printNew(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// formatEvent renders one journal entry as a single line
+func formatEvent(event *state.Event) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s  %-28s", event.Time.Local().Format("2006-01-02 15:04:05"), event.Type)
+
+	if event.TaskID != "" {
+		fmt.Fprintf(&b, "  [%s]", event.TaskID)
+	}
+	if event.Message != "" {
+		fmt.Fprintf(&b, "  %s", strings.ReplaceAll(event.Message, "\n", " "))
+	}
+
+	keys := make([]string, 0, len(event.Data))
+	for k := range event.Data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&b, "  %s=%s", k, event.Data[k])
+	}
+
+	return b.String()
+}
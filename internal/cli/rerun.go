@@ -0,0 +1,169 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/howell-aikit/aiflow/internal/executor"
+	"github.com/howell-aikit/aiflow/pkg/git"
+	"github.com/spf13/cobra"
+)
+
+// Choices for what happens to a rerun's result
+const (
+	rerunAsk     = "ask"
+	rerunKeep    = "keep"
+	rerunDiscard = "discard"
+	rerunLeave   = "leave"
+)
+
+var (
+	rerunFresh  bool
+	rerunResult string
+)
+
+var rerunCmd = &cobra.Command{
+	Use:   "rerun <run-id> <task-id>",
+	Short: "Run a single task again from where it started",
+	Long: `Execute one task again from the commit it last started from, with the
+summaries of the tasks that had completed by then as its context. Nothing
+else runs and the run itself is not changed until you decide what to do
+with the result:
+
+  keep      Replace the task's result with the new one. The run is rolled
+            back to the task, so later tasks run again on aiflow resume.
+  compare   Show how the new result differs from the task's current commit.
+  discard   Drop the new result.
+
+The rerun runs in the run's worktree on a detached HEAD, which must be
+clean, or with --fresh-worktree in a new scratch worktree without any
+ignored files or build output from earlier tasks. Until it is kept or
+discarded the result is held at refs/aiflow/rerun/<run>/<task>.
+
+Examples:
+  aiflow rerun abc123 t3                    # Rerun t3 and decide afterwards
+  aiflow rerun abc123 t3 --fresh-worktree   # Rerun in a clean scratch worktree
+  aiflow rerun abc123 t3 --result discard   # Only record the attempt`,
+	Args: cobra.ExactArgs(2),
+	RunE: runRerun,
+}
+
+func init() {
+	rerunCmd.Flags().BoolVar(&rerunFresh, "fresh-worktree", false, "run in a new scratch worktree instead of the run's own")
+	rerunCmd.Flags().StringVar(&rerunResult, "result", rerunAsk, "what to do with the result: ask, keep, discard or leave")
+}
+
+func runRerun(cmd *cobra.Command, args []string) error {
+	switch rerunResult {
+	case rerunAsk, rerunKeep, rerunDiscard, rerunLeave:
+	default:
+		return fmt.Errorf("invalid --result %q: use ask, keep, discard or leave", rerunResult)
+	}
+
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	run, err := store.LoadRun(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to load run: %w", err)
+	}
+	taskID := args[1]
+	task := run.GetTask(taskID)
+	if task == nil {
+		return fmt.Errorf("task %s not found in run %s", taskID, run.ID)
+	}
+
+	// The rerun checks out another commit in the run's worktree
+	lease, err := acquireRunLease(run)
+	if err != nil {
+		return err
+	}
+	defer lease.Release()
+
+	fmt.Printf("Rerunning %s (%s) from %s...\n", task.ID, task.Title, shortSHA(task.BaseSHA))
+	result, err := executor.RerunTask(context.Background(), cfg, store, run, taskID, executor.RerunOptions{
+		FreshWorktree: rerunFresh,
+	})
+	if err != nil {
+		return fmt.Errorf("rerun of %s failed: %w", taskID, err)
+	}
+
+	fmt.Printf("Rerun finished in %s (attempt %d)\n", result.Duration.Round(time.Second), result.Attempt)
+	repo, err := git.Open(run.WorktreePath)
+	if err != nil {
+		return err
+	}
+	if result.Changed() {
+		if stat, err := repo.Run("diff", "--stat", result.BaseSHA, result.NewSHA); err == nil {
+			fmt.Println(stat)
+		}
+	} else {
+		fmt.Println("The rerun made no changes")
+	}
+
+	choice := rerunResult
+	if choice == rerunAsk {
+		choice = askRerun(repo, result)
+	}
+
+	switch choice {
+	case rerunKeep:
+		rollback, err := executor.KeepRerun(store, run, result)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Kept the rerun of %s (%s)\n", taskID, shortSHA(result.NewSHA))
+		var reset []string
+		for _, id := range rollback.Reset {
+			if id != taskID {
+				reset = append(reset, id)
+			}
+		}
+		if len(reset) > 0 {
+			fmt.Printf("  Reset to pending: %s\n", strings.Join(reset, ", "))
+			fmt.Printf("  Previous history saved to %s\n", rollback.BackupRef)
+			fmt.Printf("\nContinue with: aiflow resume %s\n", run.ID)
+		}
+	case rerunDiscard:
+		if err := executor.DiscardRerun(store, run, result); err != nil {
+			return err
+		}
+		fmt.Printf("Discarded the rerun of %s\n", taskID)
+	default:
+		fmt.Printf("Left the rerun of %s at %s\n", taskID, result.Ref)
+	}
+	return nil
+}
+
+// askRerun prompts for what to do with a rerun's result
+func askRerun(repo git.Git, result *executor.RerunResult) string {
+	for {
+		fmt.Print("[k]eep, [c]ompare with the previous commit, [d]iscard, [l]eave for later? [l] ")
+
+		var response string
+		fmt.Scanln(&response)
+		switch strings.ToLower(response) {
+		case "k", "keep":
+			return rerunKeep
+		case "d", "discard":
+			return rerunDiscard
+		case "c", "compare":
+			// Both results start from the same base, so their trees diff
+			// directly; without a previous commit compare with the base
+			old := result.OldSHA
+			if old == "" {
+				old = result.BaseSHA
+			}
+			if err := repo.Stream("diff", old, result.NewSHA); err != nil {
+				fmt.Printf("Warning: %v\n", err)
+			}
+		default:
+			return rerunLeave
+		}
+	}
+}
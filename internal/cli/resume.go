@@ -9,24 +9,45 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var resumeWIP string
+
 var resumeCmd = &cobra.Command{
 	Use:   "resume [run-id]",
 	Short: "Resume an interrupted run",
 	Long: `Resume an interrupted aiflow run.
 
 This will:
-1. Reset any tasks that were running to pending
-2. Continue execution from where it left off
-3. Use preserved summaries from completed tasks`,
+1. Take ownership of the run (refused while another aiflow process is
+   executing it; the lease of a crashed process is taken over)
+2. Save changes left by interrupted tasks to refs/aiflow/wip/<run>/<task>
+   and restore a clean worktree, then restore, discard or keep them
+3. Reset any tasks that were running to pending
+4. Continue execution from where it left off
+5. Use preserved summaries from completed tasks`,
 	Args: cobra.MaximumNArgs(1),
 	RunE: runResume,
 }
 
+func init() {
+	resumeCmd.Flags().StringVar(&resumeWIP, "wip", wipAsk, "work in progress of interrupted tasks: ask, restore, discard or keep")
+	resumeCmd.Flags().IntVar(&bestOf, "best-of", 0, "attempt every remaining task at least N times in parallel and keep the best (default: from config)")
+}
+
 func runResume(cmd *cobra.Command, args []string) error {
-	store, err := state.NewStore(cfg.StateDir)
+	switch resumeWIP {
+	case wipAsk, wipRestore, wipDiscard, wipKeep:
+	default:
+		return fmt.Errorf("invalid --wip %q: use ask, restore, discard or keep", resumeWIP)
+	}
+	if err := applyBestOf(); err != nil {
+		return err
+	}
+
+	store, err := openStore()
 	if err != nil {
-		return fmt.Errorf("failed to initialize state: %w", err)
+		return err
 	}
+	defer store.Close()
 
 	var run *state.Run
 	if len(args) > 0 {
@@ -41,6 +62,13 @@ func runResume(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to load run: %w", err)
 	}
 
+	// Refuse runs another process is executing; take over crashed ones
+	lease, err := acquireRunLease(run)
+	if err != nil {
+		return err
+	}
+	defer lease.Release()
+
 	// Check if run can be resumed
 	switch run.Status {
 	case state.RunStatusCompleted:
@@ -60,13 +88,30 @@ func runResume(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	// Set aside what interrupted tasks left behind before they restart
+	if err := preserveWIP(store, run); err != nil {
+		return fmt.Errorf("failed to save work in progress: %w", err)
+	}
+	if err := store.SaveRun(run); err != nil {
+		return fmt.Errorf("failed to save run: %w", err)
+	}
+	if err := resolveWIP(store, run, resumeWIP); err != nil {
+		return err
+	}
+
 	// Reset running tasks to pending
+	previousStatus := run.Status
 	run.ResetRunningTasks()
 	run.Status = state.RunStatusRunning
 
 	if err := store.SaveRun(run); err != nil {
 		return fmt.Errorf("failed to save run: %w", err)
 	}
+	if err := state.RecordEvent(store, run.ID, state.EventRunResumed, "", "", map[string]string{
+		"previous_status": string(previousStatus),
+	}); err != nil {
+		fmt.Printf("Warning: failed to record resume event: %v\n", err)
+	}
 
 	// Set as current run
 	if err := store.SetCurrentRun(run.ID); err != nil {
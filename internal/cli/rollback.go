@@ -0,0 +1,74 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/howell-aikit/aiflow/internal/executor"
+	"github.com/howell-aikit/aiflow/internal/state"
+	"github.com/spf13/cobra"
+)
+
+var rollbackTo string
+
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback [run-id] --to <task-id>",
+	Short: "Roll a run back to the point where a task started",
+	Long: `Hard-reset the run's worktree to the commit a task started from. That
+task and every task whose work is not part of that commit are marked pending
+again, with their summaries and commits cleared, so aiflow resume runs them
+again.
+
+The discarded history, including uncommitted changes, is kept at
+refs/aiflow/backup/<run>/<time> before anything is reset.
+
+Examples:
+  aiflow rollback --to task-3          # Roll the current run back
+  aiflow rollback abc123 --to task-3`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runRollback,
+}
+
+func init() {
+	rollbackCmd.Flags().StringVar(&rollbackTo, "to", "", "task to roll back to; it and everything after it run again")
+	rollbackCmd.MarkFlagRequired("to")
+}
+
+func runRollback(cmd *cobra.Command, args []string) error {
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	var run *state.Run
+	if len(args) > 0 {
+		run, err = store.LoadRun(args[0])
+	} else {
+		run, err = store.GetCurrentRun()
+		if err == nil && run == nil {
+			return fmt.Errorf("no current run; specify a run ID")
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load run: %w", err)
+	}
+
+	// Resetting the worktree under a running executor would lose its work
+	lease, err := acquireRunLease(run)
+	if err != nil {
+		return err
+	}
+	defer lease.Release()
+
+	result, err := executor.RollbackRun(store, run, rollbackTo)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Rolled run %s back to the start of %s (%s)\n", run.ID, result.TaskID, shortSHA(result.SHA))
+	fmt.Printf("  Reset to pending: %s\n", strings.Join(result.Reset, ", "))
+	fmt.Printf("  Discarded history saved to %s\n", result.BackupRef)
+	fmt.Printf("\nContinue with: aiflow resume %s\n", run.ID)
+	return nil
+}
@@ -4,6 +4,11 @@ import (
 	"fmt"
 
 	"github.com/howell-aikit/aiflow/internal/config"
+	"github.com/howell-aikit/aiflow/internal/executor"
+	"github.com/howell-aikit/aiflow/internal/redact"
+	"github.com/howell-aikit/aiflow/internal/state"
+	"github.com/howell-aikit/aiflow/internal/worktree"
+	"github.com/howell-aikit/aiflow/pkg/git"
 	"github.com/spf13/cobra"
 )
 
@@ -78,6 +83,29 @@ var rootCmd = &cobra.Command{
 		if err != nil {
 			return fmt.Errorf("failed to load config: %w", err)
 		}
+		if _, err := redact.New(cfg.Redaction); err != nil {
+			return fmt.Errorf("invalid config: %w", err)
+		}
+		if _, err := worktree.ParseMergeStrategy(cfg.Integration.MergeStrategy); err != nil {
+			return fmt.Errorf("invalid config: %w", err)
+		}
+		if _, err := worktree.ParseSyncMode(cfg.Sync.Mode); err != nil {
+			return fmt.Errorf("invalid config: %w", err)
+		}
+		if _, err := worktree.ParseHistoryStrategy(cfg.Integration.History); err != nil {
+			return fmt.Errorf("invalid config: %w", err)
+		}
+		if err := executor.CheckCommitConfig(cfg.Commit); err != nil {
+			return fmt.Errorf("invalid config: %w", err)
+		}
+		if err := executor.CheckBestOfConfig(cfg.BestOf); err != nil {
+			return fmt.Errorf("invalid config: %w", err)
+		}
+		backend, err := git.ParseBackend(cfg.GitBackend)
+		if err != nil {
+			return fmt.Errorf("invalid config: %w", err)
+		}
+		git.SetBackend(backend)
 		return nil
 	},
 	Run: func(cmd *cobra.Command, args []string) {
@@ -98,6 +126,13 @@ func init() {
 	rootCmd.AddCommand(cleanCmd)
 	rootCmd.AddCommand(resumeCmd)
 	rootCmd.AddCommand(updateCmd)
+	rootCmd.AddCommand(locksCmd)
+	rootCmd.AddCommand(logCmd)
+	rootCmd.AddCommand(transcriptCmd)
+	rootCmd.AddCommand(stateCmd)
+	rootCmd.AddCommand(syncCmd)
+	rootCmd.AddCommand(rollbackCmd)
+	rootCmd.AddCommand(rerunCmd)
 }
 
 // Execute runs the root command
@@ -109,3 +144,25 @@ func Execute() error {
 func GetConfig() *config.Config {
 	return cfg
 }
+
+// openStore opens the state store selected by the configuration
+func openStore() (state.Store, error) {
+	store, err := state.OpenStore(cfg.StateBackend, cfg.StateDir, redact.ForConfig(cfg))
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize state: %w", err)
+	}
+	return store, nil
+}
+
+// acquireRunLease makes this process the owner of a run, taking over the
+// lease of an owner that is gone
+func acquireRunLease(run *state.Run) (*state.Lease, error) {
+	lease, previous, err := state.AcquireLease(cfg.StateDir, run.ID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot execute run %s: %w", run.ID, err)
+	}
+	if previous != nil {
+		fmt.Printf("Taking over run %s from a previous owner that is gone (%s)\n", run.ID, previous)
+	}
+	return lease, nil
+}
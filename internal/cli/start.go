@@ -15,6 +15,7 @@ import (
 var (
 	baseBranch string
 	noWorktree bool
+	bestOf     int
 )
 
 var startCmd = &cobra.Command{
@@ -34,11 +35,16 @@ This command will:
 }
 
 func init() {
-	startCmd.Flags().StringVarP(&baseBranch, "branch", "b", "", "base branch (default: from config)")
+	startCmd.Flags().StringVarP(&baseBranch, "branch", "b", "", "base revision: branch, remote branch, tag or commit (default: from config)")
 	startCmd.Flags().BoolVar(&noWorktree, "no-worktree", false, "run in current directory without creating a worktree")
+	startCmd.Flags().IntVar(&bestOf, "best-of", 0, "attempt every task at least N times in parallel and keep the best (default: from config)")
 }
 
 func runStart(cmd *cobra.Command, args []string) error {
+	if err := applyBestOf(); err != nil {
+		return err
+	}
+
 	// Feature description is optional - TUI will ask if not provided
 	var featureDesc string
 	if len(args) > 0 {
@@ -75,24 +81,30 @@ func runStart(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	// Verify branch exists
-	if !repo.HasBranch(branch) {
-		return fmt.Errorf("branch %q does not exist", branch)
+	// Pin the base to a commit so later diffs and rebases are exact
+	baseSHA, err := repo.ResolveBase(branch)
+	if err != nil {
+		return fmt.Errorf("invalid base: %w", err)
 	}
 
 	// Detect project type
 	projectType := DetectProjectType(repoPath)
 
 	// Initialize state store
-	store, err := state.NewStore(cfg.StateDir)
+	store, err := openStore()
 	if err != nil {
-		return fmt.Errorf("failed to initialize state: %w", err)
+		return err
 	}
+	defer store.Close()
 
 	var workingDir string
+	var setup *worktree.SetupReport
 
 	if noWorktree {
-		// Use current directory
+		// Use current directory, unless a live run is already working in it
+		if err := checkWorktreeFree(store, repoPath); err != nil {
+			return err
+		}
 		workingDir = repoPath
 	} else {
 		// Create worktree (use placeholder name if no feature desc yet)
@@ -106,10 +118,18 @@ func runStart(cmd *cobra.Command, args []string) error {
 			wtName = "new-feature"
 		}
 
-		workingDir, err = wtManager.Create(wtName, branch)
+		workingDir, err = wtManager.Create(wtName, baseSHA)
 		if err != nil {
 			return fmt.Errorf("failed to create worktree: %w", err)
 		}
+
+		setup = wtManager.Prepare(workingDir, worktree.SetupOptions{
+			Submodules: cfg.Worktree.Submodules,
+			LFS:        cfg.Worktree.LFS,
+		})
+		for _, skipped := range setup.Skipped {
+			fmt.Printf("Warning: worktree setup skipped %s\n", skipped)
+		}
 	}
 
 	// Create run with optional feature description
@@ -118,8 +138,24 @@ func runStart(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to create run: %w", err)
 	}
 
-	// Set project type
+	lease, err := acquireRunLease(run)
+	if err != nil {
+		return err
+	}
+	defer lease.Release()
+
+	// Set project type and source repository
 	run.ProjectType = string(projectType)
+	run.RepoPath = repoPath
+	run.BaseSHA = baseSHA
+	if setup != nil {
+		run.WorktreeSkipped = setup.Skipped
+	}
+	if commonDir, err := repo.CommonDir(); err == nil {
+		run.GitCommonDir = commonDir
+	} else {
+		fmt.Printf("Warning: failed to find git common dir: %v\n", err)
+	}
 
 	// Initialize spec conversation
 	run.SpecConversation = &state.SpecConversation{
@@ -131,11 +167,40 @@ func runStart(cmd *cobra.Command, args []string) error {
 	if err := store.SaveRun(run); err != nil {
 		return fmt.Errorf("failed to save run: %w", err)
 	}
+	if err := state.RecordEvent(store, run.ID, state.EventRunCreated, "", featureDesc, map[string]string{
+		"repo":     repoPath,
+		"branch":   branch,
+		"worktree": workingDir,
+	}); err != nil {
+		fmt.Printf("Warning: failed to record run event: %v\n", err)
+	}
 
 	// Launch TUI for interactive breakdown
 	return tui.Run(cfg, run, store)
 }
 
+// checkWorktreeFree refuses a working directory that a run with a live
+// owner is executing in
+func checkWorktreeFree(store state.Store, dir string) error {
+	runs, err := store.ListRuns()
+	if err != nil {
+		return fmt.Errorf("failed to list runs: %w", err)
+	}
+	for _, run := range runs {
+		if run.WorktreePath != dir {
+			continue
+		}
+		owner, err := state.ReadOwner(cfg.StateDir, run.ID)
+		if err != nil {
+			return err
+		}
+		if owner.Live() {
+			return fmt.Errorf("run %s is already executing in %s (%s)", run.ID, dir, owner)
+		}
+	}
+	return nil
+}
+
 // DetectProjectType checks if the directory contains code files
 func DetectProjectType(workDir string) string {
 	// Code file extensions to look for
@@ -214,3 +279,14 @@ func EnsureStateDir() error {
 	stateDir := filepath.Join(homeDir, ".aiflow", "state", "runs")
 	return os.MkdirAll(stateDir, 0755)
 }
+
+// applyBestOf makes --best-of the minimum number of candidates per task
+func applyBestOf() error {
+	if bestOf < 0 {
+		return fmt.Errorf("invalid --best-of %d: must be at least 1", bestOf)
+	}
+	if bestOf > 0 {
+		cfg.BestOf.Attempts = bestOf
+	}
+	return nil
+}
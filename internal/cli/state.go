@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/howell-aikit/aiflow/internal/state"
+	"github.com/spf13/cobra"
+)
+
+var stateMigrateDryRun bool
+
+var stateCmd = &cobra.Command{
+	Use:   "state",
+	Short: "Manage persisted run state",
+}
+
+var stateMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Upgrade saved runs to the current schema",
+	Long: fmt.Sprintf(`Upgrade every saved run to the current state schema (version %d).
+
+Older runs are also upgraded in memory whenever they are loaded; this
+command rewrites them on disk. Runs written by a newer aiflow are reported
+and left untouched.
+
+Examples:
+  aiflow state migrate --dry-run   # Show what would change
+  aiflow state migrate             # Rewrite outdated runs`, state.CurrentSchemaVersion),
+	Args: cobra.NoArgs,
+	RunE: runStateMigrate,
+}
+
+func init() {
+	stateMigrateCmd.Flags().BoolVar(&stateMigrateDryRun, "dry-run", false, "show changes without writing them")
+	stateCmd.AddCommand(stateMigrateCmd)
+}
+
+func runStateMigrate(cmd *cobra.Command, args []string) error {
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	reports, err := store.MigrateRuns(stateMigrateDryRun)
+	if err != nil {
+		return fmt.Errorf("failed to migrate runs: %w", err)
+	}
+
+	var migrated, current, failed int
+	for _, r := range reports {
+		switch {
+		case r.Err != nil:
+			failed++
+			fmt.Printf("%s: %v\n", r.RunID, r.Err)
+		case !r.NeedsMigration():
+			current++
+		default:
+			migrated++
+			fmt.Printf("%s: v%d -> v%d\n", r.RunID, r.FromVersion, r.ToVersion)
+			for _, applied := range r.Applied {
+				fmt.Printf("  migration: %s\n", applied)
+			}
+			for _, change := range r.Changes {
+				fmt.Printf("  %s\n", change)
+			}
+		}
+	}
+
+	verb := "Migrated"
+	if stateMigrateDryRun {
+		verb = "Would migrate"
+	}
+	fmt.Printf("\n%s %d run(s); %d already current, %d failed\n", verb, migrated, current, failed)
+
+	if failed > 0 {
+		return fmt.Errorf("%d run(s) could not be migrated", failed)
+	}
+	return nil
+}
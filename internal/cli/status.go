@@ -3,6 +3,7 @@ package cli
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/howell-aikit/aiflow/internal/state"
 	"github.com/spf13/cobra"
@@ -17,10 +18,11 @@ var statusCmd = &cobra.Command{
 }
 
 func runStatus(cmd *cobra.Command, args []string) error {
-	store, err := state.NewStore(cfg.StateDir)
+	store, err := openStore()
 	if err != nil {
-		return fmt.Errorf("failed to initialize state: %w", err)
+		return err
 	}
+	defer store.Close()
 
 	var run *state.Run
 	if len(args) > 0 {
@@ -38,15 +40,38 @@ func runStatus(cmd *cobra.Command, args []string) error {
 	// Print run info
 	fmt.Printf("Run: %s\n", run.ID)
 	fmt.Printf("Feature: %s\n", run.FeatureDesc)
-	fmt.Printf("Status: %s\n", run.Status)
+	status := state.EffectiveStatus(cfg.StateDir, run)
+	fmt.Printf("Status: %s\n", status)
+	if owner, err := state.ReadOwner(cfg.StateDir, run.ID); err == nil && owner.Live() {
+		fmt.Printf("Owner: %s\n", owner)
+	}
 	fmt.Printf("Worktree: %s\n", run.WorktreePath)
-	fmt.Printf("Base Branch: %s\n", run.BaseBranch)
+	if len(run.SparseDirs) > 0 {
+		fmt.Printf("Sparse checkout: %s\n", strings.Join(run.SparseDirs, ", "))
+	}
+	if len(run.WorktreeSkipped) > 0 {
+		fmt.Println("Worktree setup skipped:")
+		for _, skipped := range run.WorktreeSkipped {
+			fmt.Printf("  - %s\n", skipped)
+		}
+	}
+	if run.BaseSHA != "" && run.BaseSHA != run.BaseBranch {
+		fmt.Printf("Base Branch: %s (%s)\n", run.BaseBranch, shortSHA(run.BaseSHA))
+	} else {
+		fmt.Printf("Base Branch: %s\n", run.BaseBranch)
+	}
+	if run.HistoryBranch != "" {
+		fmt.Printf("Curated Branch: %s\n", run.HistoryBranch)
+	}
 	fmt.Printf("Created: %s\n", run.CreatedAt.Format("2006-01-02 15:04:05"))
 	fmt.Printf("Updated: %s\n", run.UpdatedAt.Format("2006-01-02 15:04:05"))
 
 	if run.Error != "" {
 		fmt.Printf("\nError: %s\n", run.Error)
 	}
+	if status == state.RunStatusCrashed {
+		fmt.Printf("\nThe process executing this run is gone; continue with: aiflow resume %s\n", run.ID)
+	}
 
 	// Print progress
 	if len(run.Tasks) > 0 {
@@ -89,6 +114,18 @@ func runStatus(cmd *cobra.Command, args []string) error {
 			if len(t.DependsOn) > 0 {
 				fmt.Printf("      Depends on: %s\n", strings.Join(t.DependsOn, ", "))
 			}
+
+			if t.BaseSHA != "" {
+				fmt.Printf("      Started at: %s\n", shortSHA(t.BaseSHA))
+			}
+
+			if t.WIPRef != "" {
+				fmt.Printf("      Work in progress: %s\n", t.WIPRef)
+			}
+
+			if t.LockWaitMS > 0 {
+				fmt.Printf("      Lock wait: %s\n", t.LockWait().Round(time.Millisecond))
+			}
 		}
 	} else {
 		fmt.Printf("\nNo tasks yet (breakdown not complete)\n")
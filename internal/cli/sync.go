@@ -0,0 +1,120 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/howell-aikit/aiflow/internal/executor"
+	"github.com/howell-aikit/aiflow/internal/state"
+	"github.com/howell-aikit/aiflow/internal/worktree"
+	"github.com/spf13/cobra"
+)
+
+var (
+	syncRebase  bool
+	syncMerge   bool
+	syncResolve bool
+)
+
+var syncCmd = &cobra.Command{
+	Use:   "sync [run-id]",
+	Short: "Bring a run's branch up to date with its base branch",
+	Long: `Fetch the latest base branch and rebase the run's task commits onto it,
+or merge it in. After a rebase each task's recorded commit is updated to the
+rewritten one.
+
+If the sync stops on conflicts it is aborted and the worktree left as it was,
+unless --resolve (or sync.resolve_conflicts) lets Claude resolve them. The
+verify commands then have to pass, otherwise the sync is undone.
+
+Examples:
+  aiflow sync                  # Sync the current run (mode from config)
+  aiflow sync abc123 --merge   # Merge the base branch in instead of rebasing
+  aiflow sync --resolve        # Let Claude resolve conflicts`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runSync,
+}
+
+func init() {
+	syncCmd.Flags().BoolVar(&syncRebase, "rebase", false, "rebase task commits onto the base branch")
+	syncCmd.Flags().BoolVar(&syncMerge, "merge", false, "merge the base branch into the run's branch")
+	syncCmd.Flags().BoolVar(&syncResolve, "resolve", false, "let Claude resolve conflicts, then run the verify commands")
+	syncCmd.MarkFlagsMutuallyExclusive("rebase", "merge")
+}
+
+func runSync(cmd *cobra.Command, args []string) error {
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	var run *state.Run
+	if len(args) > 0 {
+		run, err = store.LoadRun(args[0])
+	} else {
+		run, err = store.GetCurrentRun()
+		if err == nil && run == nil {
+			return fmt.Errorf("no current run; specify a run ID")
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load run: %w", err)
+	}
+
+	// Rewriting the branch under a running executor would lose its commits
+	lease, err := acquireRunLease(run)
+	if err != nil {
+		return err
+	}
+	defer lease.Release()
+
+	opts := executor.SyncOptions{ResolveConflicts: syncResolve || cfg.Sync.ResolveConflicts}
+	switch {
+	case syncRebase:
+		opts.Mode = worktree.SyncRebase
+	case syncMerge:
+		opts.Mode = worktree.SyncMerge
+	default:
+		if opts.Mode, err = worktree.ParseSyncMode(cfg.Sync.Mode); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Syncing run %s with %s (%s)...\n", run.ID, run.BaseBranch, opts.Mode)
+	result, err := executor.SyncRun(context.Background(), cfg, store, run, opts)
+	if err != nil {
+		if errors.Is(err, worktree.ErrSyncConflict) && !opts.ResolveConflicts {
+			fmt.Println("The worktree was left unchanged. Resolve manually, or retry with --resolve.")
+		}
+		return err
+	}
+
+	if result.UpToDate {
+		fmt.Printf("Already up to date with %s\n", result.BaseRef)
+		return nil
+	}
+
+	fmt.Printf("Synced with %s at %s\n", result.BaseRef, shortSHA(result.BaseSHA))
+	fmt.Printf("  HEAD: %s -> %s\n", shortSHA(result.OldHead), shortSHA(result.NewHead))
+	if len(result.Conflicts) > 0 {
+		fmt.Printf("  Resolved conflicts in: %v\n", result.Conflicts)
+	}
+	for _, t := range run.Tasks {
+		for oldSHA, newSHA := range result.Rewritten {
+			if t.CommitSHA == newSHA {
+				fmt.Printf("  %s: %s -> %s\n", t.ID, shortSHA(oldSHA), shortSHA(newSHA))
+			}
+		}
+	}
+	return nil
+}
+
+// shortSHA abbreviates a commit SHA for display
+func shortSHA(sha string) string {
+	if len(sha) > 8 {
+		return sha[:8]
+	}
+	return sha
+}
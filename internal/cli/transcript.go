@@ -0,0 +1,91 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/howell-aikit/aiflow/internal/transcript"
+	"github.com/spf13/cobra"
+)
+
+var (
+	transcriptAttempt int
+	transcriptRaw     bool
+)
+
+var transcriptCmd = &cobra.Command{
+	Use:   "transcript <run-id> <task-id|planning|sync>",
+	Short: "Show the recorded agent transcript of a task",
+	Long: `Show the exact prompt, the agent conversation (including tool calls and
+results) and stderr recorded for a task attempt, for a planning session
+when the task is "planning", or for a conflict resolution pass when it is
+"sync". The latest attempt is shown unless --attempt is given.
+
+Examples:
+  aiflow transcript abc123 t2
+  aiflow transcript abc123 t2 --attempt 1
+  aiflow transcript abc123 planning --raw > planning.jsonl
+  aiflow transcript abc123 sync         # Conflict resolution during sync`,
+	Args: cobra.ExactArgs(2),
+	RunE: runTranscript,
+}
+
+func init() {
+	transcriptCmd.Flags().IntVarP(&transcriptAttempt, "attempt", "a", 0, "attempt (or planning session) number; default latest")
+	transcriptCmd.Flags().BoolVar(&transcriptRaw, "raw", false, "print the raw stream-json transcript")
+}
+
+func runTranscript(cmd *cobra.Command, args []string) error {
+	runID, taskID := args[0], args[1]
+
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	run, err := store.LoadRun(runID)
+	if err != nil {
+		return fmt.Errorf("failed to load run: %w", err)
+	}
+
+	transcripts := transcript.NewStore(cfg.StateDir, nil)
+	planning := taskID == transcript.PlanningTaskID
+
+	var numbers []int
+	if planning {
+		numbers, err = transcripts.ListSessions(run.ID)
+	} else {
+		// Sync conflict resolutions are recorded as attempts of a pseudo-task
+		if taskID != transcript.SyncTaskID && run.GetTask(taskID) == nil {
+			return fmt.Errorf("task %s not found in run %s", taskID, run.ID)
+		}
+		numbers, err = transcripts.ListAttempts(run.ID, taskID)
+	}
+	if err != nil {
+		return err
+	}
+	if len(numbers) == 0 {
+		return fmt.Errorf("no transcripts recorded for %s in run %s", taskID, run.ID)
+	}
+
+	number := numbers[len(numbers)-1]
+	if transcriptAttempt > 0 {
+		number = transcriptAttempt
+	}
+
+	dir := transcripts.AttemptDir(run.ID, taskID, number)
+	if planning {
+		dir = transcripts.SessionDir(run.ID, number)
+	}
+
+	if !transcriptRaw {
+		label := "Attempt"
+		if planning {
+			label = "Session"
+		}
+		fmt.Printf("%s %d of %d (%s)\n\n", label, number, len(numbers), dir)
+	}
+
+	return transcript.Render(os.Stdout, dir, transcriptRaw)
+}
@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/howell-aikit/aiflow/pkg/git"
 	"github.com/spf13/cobra"
 )
 
@@ -47,40 +48,33 @@ func runUpdate(cmd *cobra.Command, args []string) error {
 
 	fmt.Printf("Source directory: %s\n\n", sourceDir)
 
+	repo, err := git.Open(sourceDir)
+	if err != nil {
+		return fmt.Errorf("failed to open source repository: %w", err)
+	}
+
 	// Check for uncommitted changes
-	statusCmd := exec.Command("git", "status", "--porcelain")
-	statusCmd.Dir = sourceDir
-	statusOut, _ := statusCmd.Output()
+	statusOut, _ := repo.Run("status", "--porcelain")
 	if len(statusOut) > 0 {
 		fmt.Println("Warning: You have uncommitted changes in the source directory")
-		fmt.Println(string(statusOut))
+		fmt.Println(statusOut)
 	}
 
 	// Get current commit
-	currentCmd := exec.Command("git", "rev-parse", "--short", "HEAD")
-	currentCmd.Dir = sourceDir
-	currentOut, _ := currentCmd.Output()
-	currentCommit := strings.TrimSpace(string(currentOut))
+	currentCommit, _ := repo.Run("rev-parse", "--short", "HEAD")
 
 	// Fetch and check for updates
 	fmt.Println("Fetching latest changes...")
-	fetchCmd := exec.Command("git", "fetch")
-	fetchCmd.Dir = sourceDir
-	fetchCmd.Stdout = os.Stdout
-	fetchCmd.Stderr = os.Stderr
-	if err := fetchCmd.Run(); err != nil {
+	if err := repo.Stream("fetch"); err != nil {
 		return fmt.Errorf("git fetch failed: %w", err)
 	}
 
 	// Check if we're behind
-	behindCmd := exec.Command("git", "rev-list", "--count", "HEAD..@{u}")
-	behindCmd.Dir = sourceDir
-	behindOut, err := behindCmd.Output()
+	behind, err := repo.Run("rev-list", "--count", "HEAD..@{u}")
 	if err != nil {
 		// Might not have upstream set
 		fmt.Println("Warning: Could not check upstream status")
 	} else {
-		behind := strings.TrimSpace(string(behindOut))
 		if behind == "0" {
 			fmt.Println("\nAlready up to date!")
 			return nil
@@ -90,27 +84,16 @@ func runUpdate(cmd *cobra.Command, args []string) error {
 
 	// Show what will change
 	fmt.Println("\nChanges to be pulled:")
-	logCmd := exec.Command("git", "log", "--oneline", "HEAD..@{u}")
-	logCmd.Dir = sourceDir
-	logCmd.Stdout = os.Stdout
-	logCmd.Stderr = os.Stderr
-	logCmd.Run()
+	repo.Stream("log", "--oneline", "HEAD..@{u}")
 
 	// Pull
 	fmt.Println("\nPulling changes...")
-	pullCmd := exec.Command("git", "pull", "--ff-only")
-	pullCmd.Dir = sourceDir
-	pullCmd.Stdout = os.Stdout
-	pullCmd.Stderr = os.Stderr
-	if err := pullCmd.Run(); err != nil {
+	if err := repo.Stream("pull", "--ff-only"); err != nil {
 		return fmt.Errorf("git pull failed: %w", err)
 	}
 
 	// Get new commit
-	newCmd := exec.Command("git", "rev-parse", "--short", "HEAD")
-	newCmd.Dir = sourceDir
-	newOut, _ := newCmd.Output()
-	newCommit := strings.TrimSpace(string(newOut))
+	newCommit, _ := repo.Run("rev-parse", "--short", "HEAD")
 
 	fmt.Printf("\nUpdated: %s -> %s\n", currentCommit, newCommit)
 
@@ -0,0 +1,164 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/howell-aikit/aiflow/internal/state"
+	"github.com/howell-aikit/aiflow/pkg/git"
+)
+
+// WIP handling choices for resume
+const (
+	wipAsk     = "ask"
+	wipRestore = "restore"
+	wipDiscard = "discard"
+	wipKeep    = "keep"
+)
+
+// preserveWIP snapshots the changes interrupted tasks left in the worktree
+// into WIP refs and restores a clean tree, so the next attempt does not
+// build on half-finished files
+func preserveWIP(store state.Store, run *state.Run) error {
+	var interrupted []*state.Task
+	for _, t := range run.Tasks {
+		if t.Status == state.TaskStatusRunning {
+			interrupted = append(interrupted, t)
+		}
+	}
+	if len(interrupted) == 0 {
+		return nil
+	}
+
+	repo, err := git.Open(run.WorktreePath)
+	if err != nil {
+		return err
+	}
+	dirty, err := repo.IsDirty()
+	if err != nil {
+		return fmt.Errorf("failed to check worktree status: %w", err)
+	}
+	if !dirty {
+		return nil
+	}
+
+	// Parallel tasks share the worktree, so one snapshot holds the work of
+	// every interrupted task and each task's ref points at it
+	ids := make([]string, len(interrupted))
+	for i, t := range interrupted {
+		ids[i] = t.ID
+	}
+	message := fmt.Sprintf("aiflow WIP: run %s, interrupted task(s) %s", run.ID, strings.Join(ids, ", "))
+
+	var sha string
+	for _, t := range interrupted {
+		ref := git.WIPRef(run.ID, t.ID)
+		if sha == "" {
+			if sha, err = repo.SnapshotWIP(ref, message); err != nil {
+				return err
+			}
+		} else if err := repo.UpdateRef(ref, sha); err != nil {
+			return err
+		}
+		t.WIPRef = ref
+		if err := state.RecordEvent(store, run.ID, state.EventWIPSaved, t.ID, ref, map[string]string{"sha": sha}); err != nil {
+			fmt.Printf("Warning: failed to record WIP event: %v\n", err)
+		}
+	}
+
+	if err := repo.CleanWorkingTree(); err != nil {
+		return err
+	}
+	fmt.Printf("Saved work in progress of %s to %s\n", strings.Join(ids, ", "), interrupted[0].WIPRef)
+	return nil
+}
+
+// resolveWIP applies the chosen handling to every task with a saved WIP
+// ref, asking per task when mode is wipAsk
+func resolveWIP(store state.Store, run *state.Run, mode string) error {
+	var pending []*state.Task
+	for _, t := range run.Tasks {
+		if t.WIPRef != "" && t.Status != state.TaskStatusCompleted {
+			pending = append(pending, t)
+		}
+	}
+	if len(pending) == 0 || mode == wipKeep {
+		return nil
+	}
+
+	repo, err := git.Open(run.WorktreePath)
+	if err != nil {
+		return err
+	}
+
+	restored := make(map[string]bool) // Snapshot SHAs already applied
+	for _, t := range pending {
+		sha, err := repo.ResolveRef(t.WIPRef)
+		if err != nil {
+			fmt.Printf("Warning: work in progress of %s is gone: %v\n", t.ID, err)
+			t.WIPRef = ""
+			continue
+		}
+
+		choice := mode
+		if choice == wipAsk {
+			choice = askWIP(repo, t)
+		}
+
+		switch choice {
+		case wipRestore:
+			if !restored[sha] {
+				if err := repo.RestoreWIP(t.WIPRef); err != nil {
+					return fmt.Errorf("failed to restore work in progress of %s (kept at %s): %w", t.ID, t.WIPRef, err)
+				}
+				restored[sha] = true
+				fmt.Printf("Restored work in progress of %s as a starting point\n", t.ID)
+			}
+		case wipDiscard:
+			fmt.Printf("Discarded work in progress of %s\n", t.ID)
+		default:
+			fmt.Printf("Kept work in progress of %s at %s\n", t.ID, t.WIPRef)
+			continue
+		}
+
+		if err := repo.DeleteRef(t.WIPRef); err != nil {
+			return err
+		}
+		if err := state.RecordEvent(store, run.ID, state.EventWIPResolved, t.ID, choice, map[string]string{"sha": sha}); err != nil {
+			fmt.Printf("Warning: failed to record WIP event: %v\n", err)
+		}
+		t.WIPRef = ""
+	}
+
+	return nil
+}
+
+// askWIP prompts for what to do with a task's saved work in progress
+func askWIP(repo git.Git, task *state.Task) string {
+	fmt.Printf("\nTask %s (%s) was interrupted; its work in progress is saved at %s\n", task.ID, task.Title, task.WIPRef)
+	if stat, err := repo.WIPDiff(task.WIPRef, true); err == nil {
+		fmt.Println(stat)
+	}
+
+	for {
+		fmt.Print("[r]estore as starting point, [d]iscard, [s]how diff, [k]eep for later? [k] ")
+
+		var response string
+		fmt.Scanln(&response)
+		switch strings.ToLower(response) {
+		case "r", "restore":
+			return wipRestore
+		case "d", "discard":
+			return wipDiscard
+		case "s", "show", "diff":
+			diff, err := repo.WIPDiff(task.WIPRef, false)
+			if err != nil {
+				fmt.Printf("Warning: %v\n", err)
+				continue
+			}
+			fmt.Println(diff)
+		default:
+			return wipKeep
+		}
+	}
+}
@@ -10,17 +10,26 @@ import (
 
 // Config holds all aiflow configuration
 type Config struct {
-	WorktreeDir      string        `toml:"worktree_dir"`
-	MaxParallel      int           `toml:"max_parallel"`
-	ClaudeCodePath   string        `toml:"claude_code_path"`
-	DefaultBranch    string        `toml:"default_branch"`
-	ContextMaxFiles  int           `toml:"context_max_files"`
-	ContextMaxTokens int           `toml:"context_max_tokens"`
-	StateDir         string        `toml:"state_dir"`
-	LockTimeout      string        `toml:"lock_timeout"`
-	SourceDir        string        `toml:"source_dir"` // aiflow source directory for self-update
-	Summaries        SummaryConfig `toml:"summaries"`
-	Spec             SpecConfig    `toml:"spec"`
+	WorktreeDir      string            `toml:"worktree_dir"`
+	MaxParallel      int               `toml:"max_parallel"`
+	ClaudeCodePath   string            `toml:"claude_code_path"`
+	DefaultBranch    string            `toml:"default_branch"`
+	ContextMaxFiles  int               `toml:"context_max_files"`
+	ContextMaxTokens int               `toml:"context_max_tokens"`
+	StateDir         string            `toml:"state_dir"`
+	StateBackend     string            `toml:"state_backend"` // "json" or "bolt"
+	GitBackend       string            `toml:"git_backend"`   // "go-git" or "exec"
+	LockTimeout      string            `toml:"lock_timeout"`
+	SourceDir        string            `toml:"source_dir"` // aiflow source directory for self-update
+	Summaries        SummaryConfig     `toml:"summaries"`
+	Spec             SpecConfig        `toml:"spec"`
+	Redaction        RedactionConfig   `toml:"redaction"`
+	Integration      IntegrationConfig `toml:"integration"`
+	Sync             SyncConfig        `toml:"sync"`
+	Verify           VerifyConfig      `toml:"verify"`
+	Worktree         WorktreeConfig    `toml:"worktree"`
+	Commit           CommitConfig      `toml:"commit"`
+	BestOf           BestOfConfig      `toml:"best_of"`
 }
 
 // SummaryConfig holds settings for task summary inclusion
@@ -35,6 +44,74 @@ type SpecConfig struct {
 	SafetyLimit int `toml:"safety_limit"` // Max questions before forcing breakdown (safety valve)
 }
 
+// RedactionConfig controls secret redaction in everything aiflow persists
+type RedactionConfig struct {
+	Enabled          bool               `toml:"enabled"`
+	HighEntropy      bool               `toml:"high_entropy"`       // Redact long random-looking tokens
+	EntropyThreshold float64            `toml:"entropy_threshold"`  // Shannon bits per character
+	EntropyMinLength int                `toml:"entropy_min_length"` // Shortest token considered
+	Patterns         []RedactionPattern `toml:"patterns"`
+}
+
+// RedactionPattern is a user-defined secret detector
+type RedactionPattern struct {
+	Name  string `toml:"name"`  // Used in the [REDACTED:<name>] marker
+	Regex string `toml:"regex"` // Go regexp; the whole match is replaced
+}
+
+// IntegrationConfig controls how finished feature branches reach the
+// source repository
+type IntegrationConfig struct {
+	MergeStrategy string `toml:"merge_strategy"` // "ff", "no-ff" or "squash"
+	Remote        string `toml:"remote"`         // Remote of the source repository that PR branches are pushed to
+	History       string `toml:"history"`        // "keep", "squash" or "group": the commits integrated on completion
+}
+
+// SyncConfig controls how a run's branch is brought up to date with its
+// base branch
+type SyncConfig struct {
+	Mode             string `toml:"mode"`              // "rebase" or "merge"
+	ResolveConflicts bool   `toml:"resolve_conflicts"` // Let Claude resolve conflicts, then run the verify commands
+	BeforeMerge      bool   `toml:"before_merge"`      // Sync automatically before offering a merge on completion
+}
+
+// VerifyConfig lists the commands that check a worktree is healthy, such as
+// the build and test suite
+type VerifyConfig struct {
+	Commands []string `toml:"commands"` // Run with sh -c in the worktree, in order
+	Timeout  string   `toml:"timeout"`  // Per command
+}
+
+// WorktreeConfig controls what is set up in a new run worktree besides
+// the checkout itself
+type WorktreeConfig struct {
+	Submodules    bool     `toml:"submodules"`     // Initialize submodules recursively
+	LFS           bool     `toml:"lfs"`            // Check out LFS files from the local LFS store
+	Sparse        bool     `toml:"sparse"`         // Narrow the worktree to the directories the plan touches
+	SparseInclude []string `toml:"sparse_include"` // Directories always kept in a sparse worktree
+}
+
+// CommitConfig controls the commits aiflow makes for completed tasks.
+// Message and trailers are text/template strings.
+type CommitConfig struct {
+	AuthorName     string   `toml:"author_name"`     // Defaults to git's user.name
+	AuthorEmail    string   `toml:"author_email"`    // Defaults to git's user.email
+	CommitterName  string   `toml:"committer_name"`  // Defaults to git's committer identity
+	CommitterEmail string   `toml:"committer_email"` // Defaults to git's committer identity
+	Message        string   `toml:"message"`         // Subject, optionally followed by a blank line and body
+	Trailers       []string `toml:"trailers"`        // "Key: value" lines; empty values are dropped
+	Sign           string   `toml:"sign"`            // "", "off", "openpgp" or "ssh"; empty follows git's commit.gpgsign
+	SigningKey     string   `toml:"signing_key"`     // OpenPGP key ID or SSH key path; defaults to git's user.signingkey
+	SigningKeyring string   `toml:"signing_keyring"` // OpenPGP secret keyring to sign with instead of gpg
+}
+
+// BestOfConfig controls best-of-N execution, where a task is attempted
+// several times in parallel and the best candidate is kept
+type BestOfConfig struct {
+	Attempts int      `toml:"attempts"` // Candidates for every task; tasks may ask for more. 1 disables
+	Metrics  []string `toml:"metrics"`  // Tie-breakers after the verify commands: "diff_size", "test_count"
+}
+
 // Default returns the default configuration
 func Default() *Config {
 	homeDir, _ := os.UserHomeDir()
@@ -46,6 +123,8 @@ func Default() *Config {
 		ContextMaxFiles:  20,
 		ContextMaxTokens: 8000,
 		StateDir:         filepath.Join(homeDir, ".aiflow", "state"),
+		StateBackend:     "json",
+		GitBackend:       "go-git",
 		LockTimeout:      "5m",
 		Summaries: SummaryConfig{
 			IncludeForDependencies: true,
@@ -55,6 +134,38 @@ func Default() *Config {
 		Spec: SpecConfig{
 			SafetyLimit: 10,
 		},
+		Redaction: RedactionConfig{
+			Enabled:          true,
+			HighEntropy:      true,
+			EntropyThreshold: 4.3,
+			EntropyMinLength: 24,
+		},
+		Integration: IntegrationConfig{
+			MergeStrategy: "no-ff",
+			Remote:        "origin",
+			History:       "keep",
+		},
+		Sync: SyncConfig{
+			Mode:        "rebase",
+			BeforeMerge: true,
+		},
+		Verify: VerifyConfig{
+			Timeout: "10m",
+		},
+		Worktree: WorktreeConfig{
+			Submodules: true,
+			LFS:        true,
+		},
+		Commit: CommitConfig{
+			Message: "aiflow: {{.Task.Title}}",
+			Trailers: []string{
+				"Aiflow-Run: {{.Run.ID}}",
+				"Aiflow-Task: {{.Task.ID}}",
+			},
+		},
+		BestOf: BestOfConfig{
+			Attempts: 1,
+		},
 	}
 }
 
@@ -67,6 +178,15 @@ func (c *Config) LockTimeoutDuration() time.Duration {
 	return d
 }
 
+// VerifyTimeoutDuration returns the per-command verify timeout
+func (c *Config) VerifyTimeoutDuration() time.Duration {
+	d, err := time.ParseDuration(c.Verify.Timeout)
+	if err != nil {
+		return 10 * time.Minute
+	}
+	return d
+}
+
 // Load reads configuration from the config file
 func Load() (*Config, error) {
 	cfg := Default()
@@ -0,0 +1,359 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/howell-aikit/aiflow/internal/config"
+	"github.com/howell-aikit/aiflow/internal/state"
+	"github.com/howell-aikit/aiflow/internal/transcript"
+	"github.com/howell-aikit/aiflow/internal/verify"
+	"github.com/howell-aikit/aiflow/pkg/git"
+)
+
+// Metrics that break ties between best-of-N candidates that fared the same
+// with the verify commands
+const (
+	MetricDiffSize  = "diff_size"  // Fewer lines added and removed wins
+	MetricTestCount = "test_count" // More test functions added wins
+)
+
+// testPattern matches an added line that declares a test in Go, Python,
+// JavaScript, Java or Rust
+var testPattern = regexp.MustCompile(`^\+\s*(func (\([^)]*\) )?Test\w*\(|def test_\w*\(|(it|test)\(|@Test\b|#\[test\])`)
+
+// CheckBestOfConfig validates the [best_of] settings
+func CheckBestOfConfig(c config.BestOfConfig) error {
+	if c.Attempts < 0 {
+		return fmt.Errorf("best_of.attempts must not be negative")
+	}
+	for _, m := range c.Metrics {
+		if m != MetricDiffSize && m != MetricTestCount {
+			return fmt.Errorf("unknown best_of metric %q: use %s or %s", m, MetricDiffSize, MetricTestCount)
+		}
+	}
+	return nil
+}
+
+// Candidate is the outcome and score of one attempt of a best-of-N task.
+// It is stored with the attempt's transcript.
+type Candidate struct {
+	Attempt     int    `json:"attempt"`
+	CommitSHA   string `json:"commit_sha,omitempty"` // Scratch commit; empty when nothing changed
+	Error       string `json:"error,omitempty"`      // The agent or commit failed; the candidate is out
+	Verified    bool   `json:"verified"`             // Every verify command passed
+	VerifyError string `json:"verify_error,omitempty"`
+	DiffSize    int    `json:"diff_size"`  // Lines added plus removed
+	TestCount   int    `json:"test_count"` // Tests declared in added lines
+	Chosen      bool   `json:"chosen"`
+}
+
+// candidateRun is a candidate being executed in its scratch worktree
+type candidateRun struct {
+	Candidate
+	attempt *state.Attempt
+	exec    *Executor
+	rec     *transcript.Recorder
+	cleanup func()
+}
+
+// bestOf returns how many candidates to run for a task: its own best_of or
+// the configured default, whichever is larger
+func (e *Executor) bestOf(task *state.Task) int {
+	n := task.BestOf
+	if e.cfg.BestOf.Attempts > n {
+		n = e.cfg.BestOf.Attempts
+	}
+	return n
+}
+
+// executeBestOf runs n independent attempts of a task in parallel, each in
+// a scratch worktree from the task's base commit. The best candidate's
+// changes are applied to the run's worktree and committed as the task's;
+// every candidate's score and diff is recorded with its transcript.
+func (e *Executor) executeBestOf(ctx context.Context, task *state.Task, n int, result *TaskResult) {
+	e.recordEvent(state.EventTaskStarted, task.ID, task.Title, map[string]string{
+		"best_of": strconv.Itoa(n),
+	})
+
+	// Attempt numbers are handed out before anything runs concurrently
+	candidates := make([]*candidateRun, n)
+	for i := range candidates {
+		attempt := e.beginAttempt(task, result.LockWait)
+		attempt.Candidate = true
+		candidates[i] = &candidateRun{Candidate: Candidate{Attempt: attempt.Number}, attempt: attempt}
+	}
+	defer func() {
+		for _, c := range candidates {
+			if c.rec != nil {
+				c.rec.Close()
+			}
+			if c.cleanup != nil {
+				c.cleanup()
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for _, c := range candidates {
+		wg.Add(1)
+		go func(c *candidateRun) {
+			defer wg.Done()
+			e.runCandidate(ctx, task, c)
+		}(c)
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		result.Error = ctx.Err()
+		e.finishCandidates(task, candidates, "")
+		return
+	}
+
+	best := chooseCandidate(candidates, e.cfg.BestOf.Metrics)
+	if best == nil {
+		var errs []string
+		for _, c := range candidates {
+			errs = append(errs, fmt.Sprintf("attempt %d: %s", c.Attempt, c.Error))
+		}
+		result.Error = fmt.Errorf("all %d candidates failed: %s", n, strings.Join(errs, "; "))
+		e.store.SetTaskError(e.run.ID, task.ID, result.Error.Error())
+		e.finishCandidates(task, candidates, "")
+		e.recordEvent(state.EventTaskFailed, task.ID, result.Error.Error(), nil)
+		return
+	}
+	best.Chosen = true
+	if !best.Verified && len(e.cfg.Verify.Commands) > 0 {
+		fmt.Printf("Warning: no candidate of task %s passed the verify commands; keeping attempt %d\n", task.ID, best.Attempt)
+	}
+	e.recordEvent(state.EventCandidateChosen, task.ID, "", map[string]string{
+		"attempt": strconv.Itoa(best.Attempt),
+		"sha":     best.CommitSHA,
+	})
+
+	if err := e.applyCandidate(best.CommitSHA); err != nil {
+		result.Error = err
+		e.store.SetTaskError(e.run.ID, task.ID, err.Error())
+		e.finishCandidates(task, candidates, "")
+		e.recordEvent(state.EventTaskFailed, task.ID, err.Error(), nil)
+		return
+	}
+
+	// The chosen changes are now uncommitted in the run's worktree, where
+	// the summary agent sees them as on a single attempt
+	var summaryRec *transcript.Recorder
+	if best.rec != nil {
+		summaryRec, _ = best.rec.Sub("summary")
+		if summaryRec != nil {
+			defer summaryRec.Close()
+		}
+	}
+	summary, err := e.extractSummary(ctx, task.ID, summaryRec)
+	if err != nil {
+		fmt.Printf("Warning: failed to extract summary for task %s: %v\n", task.ID, err)
+	}
+
+	e.finishTask(task, summary, result)
+	e.finishCandidates(task, candidates, task.CommitSHA)
+	eventType := state.EventTaskCompleted
+	if !result.Success {
+		eventType = state.EventTaskFailed
+	}
+	e.recordEvent(eventType, task.ID, "", map[string]string{
+		"attempt": strconv.Itoa(best.Attempt),
+	})
+}
+
+// runCandidate executes one candidate in a new scratch worktree, commits
+// its changes there and scores them
+func (e *Executor) runCandidate(ctx context.Context, task *state.Task, c *candidateRun) {
+	name := fmt.Sprintf("%s-%s-candidate-%d", e.run.ID, task.ID, c.Attempt)
+	dir, cleanup, err := scratchWorktree(e.cfg, e.run, name, task.BaseSHA)
+	if err != nil {
+		c.Error = err.Error()
+		return
+	}
+	c.cleanup = cleanup
+
+	// Candidate commits are never integrated as they are, so they are not
+	// signed; the chosen changes are committed again in the run's worktree
+	c.exec = NewExecutor(e.cfg, dir, e.store, e.run)
+	c.exec.signing = &git.Signing{}
+
+	if c.rec, err = e.transcripts.NewAttempt(e.run.ID, task.ID, c.Attempt); err != nil {
+		fmt.Printf("Warning: transcript will not be recorded: %v\n", err)
+		c.rec = nil
+	}
+
+	if err := c.exec.widenForTask(task); err != nil {
+		fmt.Printf("Warning: failed to widen worktree for %s: %v\n", task.ID, err)
+	}
+
+	prompt, err := c.exec.ctxBuilder.BuildTaskPrompt(task)
+	if err != nil {
+		c.Error = fmt.Sprintf("failed to build prompt: %v", err)
+		return
+	}
+	if _, err := c.exec.runClaudeCode(ctx, prompt, c.rec); err != nil {
+		c.Error = err.Error()
+		return
+	}
+	sha, err := c.exec.commitTask(task, nil)
+	if err != nil {
+		c.Error = err.Error()
+		return
+	}
+	c.CommitSHA = sha
+
+	c.Verified = true
+	if len(e.cfg.Verify.Commands) > 0 {
+		report := verify.Run(ctx, dir, e.cfg.Verify.Commands, e.cfg.VerifyTimeoutDuration())
+		if err := report.Err(); err != nil {
+			c.Verified = false
+			c.VerifyError = err.Error()
+		}
+	}
+
+	if sha != "" {
+		if err := c.measure(dir, task.BaseSHA); err != nil {
+			fmt.Printf("Warning: failed to measure attempt %d of task %s: %v\n", c.Attempt, task.ID, err)
+		}
+	}
+}
+
+// measure records the candidate's diff metrics and saves its patch with
+// the transcript
+func (c *candidateRun) measure(dir, base string) error {
+	numstat, err := git.Run(dir, "diff", "--numstat", base, c.CommitSHA)
+	if err != nil {
+		return err
+	}
+	for _, line := range strings.Split(numstat, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		// Binary files report "-"
+		added, _ := strconv.Atoi(fields[0])
+		removed, _ := strconv.Atoi(fields[1])
+		c.DiffSize += added + removed
+	}
+
+	patch, err := git.Run(dir, "diff", base, c.CommitSHA)
+	if err != nil {
+		return err
+	}
+	for _, line := range strings.Split(patch, "\n") {
+		if !strings.HasPrefix(line, "+++") && testPattern.MatchString(line) {
+			c.TestCount++
+		}
+	}
+	if c.rec != nil {
+		return c.rec.WriteFile(transcript.PatchFile, []byte(patch+"\n"))
+	}
+	return nil
+}
+
+// chooseCandidate returns the best candidate that ran to completion, or
+// nil. Candidates passing the verify commands come first, then those that
+// changed something, then the configured metrics decide in order; the
+// earliest attempt wins a tie.
+func chooseCandidate(candidates []*candidateRun, metrics []string) *candidateRun {
+	var ok []*candidateRun
+	for _, c := range candidates {
+		if c.Error == "" {
+			ok = append(ok, c)
+		}
+	}
+	if len(ok) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(ok, func(i, j int) bool {
+		a, b := ok[i], ok[j]
+		if a.Verified != b.Verified {
+			return a.Verified
+		}
+		if (a.CommitSHA != "") != (b.CommitSHA != "") {
+			return a.CommitSHA != ""
+		}
+		for _, m := range metrics {
+			switch {
+			case m == MetricDiffSize && a.DiffSize != b.DiffSize:
+				return a.DiffSize < b.DiffSize
+			case m == MetricTestCount && a.TestCount != b.TestCount:
+				return a.TestCount > b.TestCount
+			}
+		}
+		return a.Attempt < b.Attempt
+	})
+	return ok[0]
+}
+
+// applyCandidate brings a candidate's changes into the run's worktree
+// uncommitted, ready to be committed as the task's
+func (e *Executor) applyCandidate(sha string) error {
+	if sha == "" {
+		return nil
+	}
+	repo, err := git.Open(e.workDir)
+	if err != nil {
+		return fmt.Errorf("failed to open repository: %w", err)
+	}
+	if _, err := repo.Run("cherry-pick", "--no-commit", sha); err != nil {
+		repo.Run("reset", "--merge")
+		return fmt.Errorf("failed to apply the chosen candidate %s: %w", sha, err)
+	}
+	// Leave the changes unstaged, as an agent would
+	if _, err := repo.Run("reset", "-q"); err != nil {
+		return fmt.Errorf("failed to unstage the chosen candidate: %w", err)
+	}
+	return nil
+}
+
+// finishCandidates records every candidate's outcome as its attempt and
+// with its transcript. The chosen one's attempt gets the task's commit.
+func (e *Executor) finishCandidates(task *state.Task, candidates []*candidateRun, commitSHA string) {
+	now := time.Now()
+	for _, c := range candidates {
+		attempt := c.attempt
+		attempt.EndedAt = &now
+		if c.Error != "" {
+			attempt.Status = state.TaskStatusFailed
+			attempt.Error = c.Error
+		} else {
+			attempt.Status = state.TaskStatusCompleted
+			if c.Chosen {
+				attempt.CommitSHA = commitSHA
+			}
+		}
+		if err := e.store.RecordAttempt(e.run.ID, task.ID, attempt); err != nil {
+			fmt.Printf("Warning: failed to record attempt for task %s: %v\n", task.ID, err)
+		}
+
+		if c.rec != nil {
+			if data, err := json.MarshalIndent(c.Candidate, "", "  "); err == nil {
+				if err := c.rec.WriteFile(transcript.CandidateFile, append(data, '\n')); err != nil {
+					fmt.Printf("Warning: %v\n", err)
+				}
+			}
+		}
+		data := map[string]string{
+			"attempt":    strconv.Itoa(c.Attempt),
+			"verified":   strconv.FormatBool(c.Verified),
+			"diff_size":  strconv.Itoa(c.DiffSize),
+			"test_count": strconv.Itoa(c.TestCount),
+		}
+		if c.Error != "" {
+			data["error"] = c.Error
+		}
+		e.recordEvent(state.EventCandidateScored, task.ID, "", data)
+	}
+}
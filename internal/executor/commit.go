@@ -0,0 +1,157 @@
+package executor
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"text/template"
+
+	"github.com/howell-aikit/aiflow/internal/config"
+	"github.com/howell-aikit/aiflow/internal/state"
+	"github.com/howell-aikit/aiflow/pkg/git"
+)
+
+// CommitData is what the [commit] message and trailer templates can refer
+// to
+type CommitData struct {
+	Run     *state.Run
+	Task    *state.Task
+	Summary *state.TaskSummary // Empty when no summary was extracted
+	Scope   string             // Top-level directory all of the task's files share, if any
+}
+
+// commitFuncs are the helpers available in commit templates
+var commitFuncs = template.FuncMap{
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"trim":  strings.TrimSpace,
+	"join":  strings.Join,
+}
+
+// CheckCommitConfig validates the sign mode and renders the [commit]
+// templates for a sample task so mistakes surface before any task runs
+func CheckCommitConfig(c config.CommitConfig) error {
+	switch c.Sign {
+	case "", "off", "openpgp", "ssh":
+	default:
+		return fmt.Errorf("unknown commit sign mode %q: use off, openpgp or ssh", c.Sign)
+	}
+	task := &state.Task{ID: "task-1", Title: "Example task"}
+	_, err := CommitMessage(c, newCommitData(&state.Run{ID: "run-1"}, task, nil))
+	return err
+}
+
+// CommitMessage renders a task's commit message from the [commit] config:
+// the message template followed by a paragraph of trailers
+func CommitMessage(c config.CommitConfig, data *CommitData) (string, error) {
+	message, err := renderCommitTemplate("message", c.Message, data)
+	if err != nil {
+		return "", err
+	}
+	message = strings.TrimSpace(message)
+	if message == "" {
+		return "", fmt.Errorf("commit message template produced an empty message")
+	}
+
+	var trailers []string
+	for i, t := range c.Trailers {
+		trailer, err := renderCommitTemplate(fmt.Sprintf("trailer %d", i+1), t, data)
+		if err != nil {
+			return "", err
+		}
+		key, value, ok := strings.Cut(strings.TrimSpace(trailer), ":")
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			return "", fmt.Errorf("trailer %q is not of the form Key: value", trailer)
+		}
+		if value = strings.TrimSpace(value); value != "" {
+			trailers = append(trailers, key+": "+value)
+		}
+	}
+	if len(trailers) > 0 {
+		message += "\n\n" + strings.Join(trailers, "\n")
+	}
+
+	return message + "\n", nil
+}
+
+// CommitOptions returns the identities configured under [commit] along
+// with how commits are signed
+func CommitOptions(c config.CommitConfig, sign *git.Signing) *git.CommitOptions {
+	return &git.CommitOptions{
+		Author:    git.Signature{Name: c.AuthorName, Email: c.AuthorEmail},
+		Committer: git.Signature{Name: c.CommitterName, Email: c.CommitterEmail},
+		Sign:      sign,
+	}
+}
+
+// ResolveSigning returns how commits in the repository at dir are signed
+// under the [commit] config and that repository's git config
+func ResolveSigning(c config.CommitConfig, dir string) (*git.Signing, error) {
+	return git.ResolveSigning(dir, c.Sign, c.SigningKey, c.SigningKeyring)
+}
+
+// commitSigning resolves how task commits are signed, once per executor
+func (e *Executor) commitSigning() (*git.Signing, error) {
+	e.signingMu.Lock()
+	defer e.signingMu.Unlock()
+	if e.signing == nil {
+		sign, err := ResolveSigning(e.cfg.Commit, e.workDir)
+		if err != nil {
+			return nil, err
+		}
+		e.signing = sign
+	}
+	return e.signing, nil
+}
+
+// newCommitData gathers the template data for a task's commit
+func newCommitData(run *state.Run, task *state.Task, summary *state.TaskSummary) *CommitData {
+	if summary == nil {
+		summary = &state.TaskSummary{TaskID: task.ID}
+	}
+	files := append(append([]string{}, task.FilesWrite...), task.FilesCreate...)
+	if len(files) == 0 {
+		files = append(append(files, summary.FilesChanged...), summary.FilesCreated...)
+	}
+	return &CommitData{
+		Run:     run,
+		Task:    task,
+		Summary: summary,
+		Scope:   commitScope(files),
+	}
+}
+
+// commitScope returns the top-level directory shared by every path, or ""
+// when they span several or include files in the repository root
+func commitScope(paths []string) string {
+	scope := ""
+	for _, p := range paths {
+		p = strings.TrimPrefix(path.Clean("/"+strings.ReplaceAll(p, "\\", "/")), "/")
+		top, _, nested := strings.Cut(p, "/")
+		if !nested || (scope != "" && top != scope) {
+			return ""
+		}
+		scope = top
+	}
+	return scope
+}
+
+func parseCommitTemplate(name, text string) (*template.Template, error) {
+	t, err := template.New(name).Funcs(commitFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid commit %s template: %w", name, err)
+	}
+	return t, nil
+}
+
+func renderCommitTemplate(name, text string, data *CommitData) (string, error) {
+	t, err := parseCommitTemplate(name, text)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("failed to render commit %s: %w", name, err)
+	}
+	return b.String(), nil
+}
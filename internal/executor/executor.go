@@ -4,52 +4,75 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/howell-aikit/aiflow/internal/claude"
 	"github.com/howell-aikit/aiflow/internal/config"
 	ctxpkg "github.com/howell-aikit/aiflow/internal/context"
+	"github.com/howell-aikit/aiflow/internal/redact"
 	"github.com/howell-aikit/aiflow/internal/scheduler"
 	"github.com/howell-aikit/aiflow/internal/state"
+	"github.com/howell-aikit/aiflow/internal/transcript"
+	"github.com/howell-aikit/aiflow/internal/worktree"
 	"github.com/howell-aikit/aiflow/pkg/git"
 )
 
 // Executor handles Claude Code invocation for tasks
 type Executor struct {
-	cfg       *config.Config
-	workDir   string
-	store     *state.Store
-	run       *state.Run
-	fileLock  *scheduler.FileLock
-	ctxBuilder *ctxpkg.Builder
+	cfg         *config.Config
+	workDir     string
+	store       state.Store
+	run         *state.Run
+	fileLock    *scheduler.FileLock
+	ctxBuilder  *ctxpkg.Builder
+	transcripts *transcript.Store
+	sparseMu    sync.Mutex
+	signing     *git.Signing // Resolved on first use by commitSigning
+	signingMu   sync.Mutex
 }
 
 // NewExecutor creates a new executor
-func NewExecutor(cfg *config.Config, workDir string, store *state.Store, run *state.Run) *Executor {
+func NewExecutor(cfg *config.Config, workDir string, store state.Store, run *state.Run) *Executor {
 	return &Executor{
-		cfg:        cfg,
-		workDir:    workDir,
-		store:      store,
-		run:        run,
-		fileLock:   scheduler.NewFileLock(workDir, cfg.LockTimeoutDuration()),
-		ctxBuilder: ctxpkg.NewBuilder(workDir, cfg, run),
+		cfg:         cfg,
+		workDir:     workDir,
+		store:       store,
+		run:         run,
+		fileLock:    scheduler.NewFileLock(workDir, run.ID, cfg.LockTimeoutDuration()),
+		ctxBuilder:  ctxpkg.NewBuilder(workDir, cfg, run),
+		transcripts: transcript.NewStore(cfg.StateDir, redact.ForConfig(cfg)),
 	}
 }
 
+// Tasks whose locks stay busy are requeued at most maxRequeues times before
+// they are reported as blocked. A batch in which every task was requeued is
+// followed by a pause that starts at requeueBackoff and doubles up to
+// maxRequeueBackoff.
+const (
+	maxRequeues       = 5
+	requeueBackoff    = 2 * time.Second
+	maxRequeueBackoff = 30 * time.Second
+)
+
 // TaskResult contains the result of task execution
 type TaskResult struct {
-	TaskID    string
-	Success   bool
-	Output    string
-	Error     error
-	Summary   *state.TaskSummary
-	Duration  time.Duration
+	TaskID   string
+	Success  bool
+	Requeued bool // Locks were busy; the task went back to the ready queue and Error says why
+	Output   string
+	Error    error
+	Summary  *state.TaskSummary
+	Duration time.Duration
+	LockWait time.Duration
 }
 
 // ExecuteTask executes a single task with Claude Code
@@ -58,18 +81,59 @@ func (e *Executor) ExecuteTask(ctx context.Context, task *state.Task) *TaskResul
 	result := &TaskResult{TaskID: task.ID}
 
 	// Acquire file locks
-	lockSet, err := e.fileLock.AcquireLockSet(task.FilesWrite, task.FilesCreate)
+	lockStart := time.Now()
+	lockSet, err := e.fileLock.AcquireLockSet(ctx, task.ID, task.FilesWrite, task.FilesCreate)
+	result.LockWait = time.Since(lockStart)
+	e.recordLockWait(task, result.LockWait)
 	if err != nil {
+		if errors.Is(err, scheduler.ErrLocksBusy) {
+			// Someone else still holds the files; try again in a later batch
+			result.Requeued = true
+			result.Error = err
+			e.store.SetTaskStatus(e.run.ID, task.ID, state.TaskStatusReady)
+			e.recordEvent(state.EventTaskRequeued, task.ID, "file locks busy", map[string]string{
+				"lock_wait": result.LockWait.String(),
+			})
+			return result
+		}
 		result.Error = fmt.Errorf("failed to acquire locks: %w", err)
 		return result
 	}
 	defer lockSet.Release()
+	e.recordEvent(state.EventLockAcquired, task.ID, "", map[string]string{
+		"files":     strings.Join(append(append([]string{}, task.FilesWrite...), task.FilesCreate...), ","),
+		"lock_wait": result.LockWait.String(),
+	})
 
 	// Update task status
 	if err := e.store.SetTaskStatus(e.run.ID, task.ID, state.TaskStatusRunning); err != nil {
 		result.Error = fmt.Errorf("failed to update task status: %w", err)
 		return result
 	}
+	e.recordTaskBase(task)
+	if n := e.bestOf(task); n > 1 {
+		e.executeBestOf(ctx, task, n, result)
+		result.Duration = time.Since(startTime)
+		return result
+	}
+	attempt := e.beginAttempt(task, result.LockWait)
+	defer func() { e.finishAttempt(task, attempt, result) }()
+	e.recordEvent(state.EventTaskStarted, task.ID, task.Title, map[string]string{
+		"attempt": strconv.Itoa(attempt.Number),
+	})
+
+	rec, err := e.transcripts.NewAttempt(e.run.ID, task.ID, attempt.Number)
+	if err != nil {
+		fmt.Printf("Warning: transcript will not be recorded: %v\n", err)
+		rec = nil
+	} else {
+		defer rec.Close()
+	}
+
+	// The task may reference paths outside the sparse cone
+	if err := e.widenForTask(task); err != nil {
+		fmt.Printf("Warning: failed to widen worktree for %s: %v\n", task.ID, err)
+	}
 
 	// Build the prompt
 	prompt, err := e.ctxBuilder.BuildTaskPrompt(task)
@@ -80,34 +144,69 @@ func (e *Executor) ExecuteTask(ctx context.Context, task *state.Task) *TaskResul
 	}
 
 	// Execute Claude Code
-	output, err := e.runClaudeCode(ctx, prompt)
+	agentStart := time.Now()
+	output, err := e.runClaudeCode(ctx, prompt, rec)
 	result.Output = output
 	result.Duration = time.Since(startTime)
 
+	agentData := map[string]string{"duration": time.Since(agentStart).Round(time.Millisecond).String()}
+	if err != nil {
+		agentData["error"] = err.Error()
+	}
+	e.recordEvent(state.EventAgentFinished, task.ID, "", agentData)
+
 	if err != nil {
 		result.Error = err
-		e.store.SetTaskError(e.run.ID, task.ID, err.Error())
+		if ctx.Err() == nil {
+			e.store.SetTaskError(e.run.ID, task.ID, err.Error())
+		}
 		return result
 	}
 
 	// Extract summary
-	summary, err := e.extractSummary(ctx, task.ID)
+	var summaryRec *transcript.Recorder
+	if rec != nil {
+		summaryRec, _ = rec.Sub("summary")
+		if summaryRec != nil {
+			defer summaryRec.Close()
+		}
+	}
+	summary, err := e.extractSummary(ctx, task.ID, summaryRec)
 	if err != nil {
 		// Non-fatal: log warning but continue
 		fmt.Printf("Warning: failed to extract summary for task %s: %v\n", task.ID, err)
-	} else {
+	}
+
+	e.finishTask(task, summary, result)
+	return result
+}
+
+// finishTask records the summary of a task whose agent succeeded, marks it
+// completed and commits its changes
+func (e *Executor) finishTask(task *state.Task, summary *state.TaskSummary, result *TaskResult) {
+	if summary != nil {
 		result.Summary = summary
 		e.store.SetTaskSummary(e.run.ID, task.ID, summary)
+		e.recordEvent(state.EventSummaryExtracted, task.ID, "", map[string]string{
+			"files_changed": strconv.Itoa(len(summary.FilesChanged)),
+			"files_created": strconv.Itoa(len(summary.FilesCreated)),
+		})
 	}
 
 	// Mark completed
 	if err := e.store.SetTaskStatus(e.run.ID, task.ID, state.TaskStatusCompleted); err != nil {
 		result.Error = fmt.Errorf("failed to update task status: %w", err)
-		return result
+		return
 	}
 
 	// Create git commit for this task
-	if sha, err := e.commitTask(task); err != nil {
+	if sha, err := e.commitTask(task, result.Summary); errors.Is(err, git.ErrSigning) {
+		// Required signatures are never skipped; the work stays in the
+		// worktree uncommitted
+		result.Error = fmt.Errorf("failed to create signed commit: %w", err)
+		e.store.SetTaskError(e.run.ID, task.ID, result.Error.Error())
+		return
+	} else if err != nil {
 		// Non-fatal: log warning but continue
 		fmt.Printf("Warning: failed to create commit for task %s: %v\n", task.ID, err)
 	} else if sha != "" {
@@ -115,14 +214,100 @@ func (e *Executor) ExecuteTask(ctx context.Context, task *state.Task) *TaskResul
 		e.store.UpdateTask(e.run.ID, task.ID, func(t *state.Task) {
 			t.CommitSHA = sha
 		})
+		e.recordEvent(state.EventCommitMade, task.ID, "", map[string]string{"sha": sha})
 	}
 
 	result.Success = true
-	return result
+}
+
+// beginAttempt records the start of a new execution attempt for a task
+func (e *Executor) beginAttempt(task *state.Task, lockWait time.Duration) *state.Attempt {
+	number := len(task.Attempts) + 1
+	if attempts, err := e.store.ListAttempts(e.run.ID, task.ID); err == nil && len(attempts) >= number {
+		number = len(attempts) + 1
+	}
+
+	attempt := &state.Attempt{
+		Number:     number,
+		Status:     state.TaskStatusRunning,
+		StartedAt:  time.Now(),
+		LockWaitMS: lockWait.Milliseconds(),
+	}
+	task.Attempts = append(task.Attempts, attempt)
+	if err := e.store.RecordAttempt(e.run.ID, task.ID, attempt); err != nil {
+		fmt.Printf("Warning: failed to record attempt for task %s: %v\n", task.ID, err)
+	}
+	return attempt
+}
+
+// finishAttempt records the outcome of an execution attempt
+func (e *Executor) finishAttempt(task *state.Task, attempt *state.Attempt, result *TaskResult) {
+	now := time.Now()
+	attempt.EndedAt = &now
+	defer func() {
+		eventType := state.EventTaskCompleted
+		if !result.Success {
+			eventType = state.EventTaskFailed
+		}
+		e.recordEvent(eventType, task.ID, attempt.Error, map[string]string{
+			"attempt": strconv.Itoa(attempt.Number),
+		})
+	}()
+	switch {
+	case result.Success:
+		attempt.Status = state.TaskStatusCompleted
+		attempt.CommitSHA = task.CommitSHA
+	case result.Error != nil:
+		attempt.Status = state.TaskStatusFailed
+		attempt.Error = result.Error.Error()
+	default:
+		attempt.Status = state.TaskStatusPending
+	}
+
+	if err := e.store.RecordAttempt(e.run.ID, task.ID, attempt); err != nil {
+		fmt.Printf("Warning: failed to record attempt for task %s: %v\n", task.ID, err)
+	}
+}
+
+// recordEvent appends an entry to the run's journal. Journal failures never
+// fail a task.
+func (e *Executor) recordEvent(eventType, taskID, message string, data map[string]string) {
+	if err := state.RecordEvent(e.store, e.run.ID, eventType, taskID, message, data); err != nil {
+		fmt.Printf("Warning: failed to record %s event: %v\n", eventType, err)
+	}
+}
+
+// recordTaskBase remembers the commit a task starts from, so the run can
+// be rolled back to just before it
+func (e *Executor) recordTaskBase(task *state.Task) {
+	repo, err := git.Open(e.workDir)
+	if err != nil {
+		return
+	}
+	sha, err := repo.GetCommitHash()
+	if err != nil {
+		return
+	}
+	task.BaseSHA = sha
+	e.store.UpdateTask(e.run.ID, task.ID, func(t *state.Task) {
+		t.BaseSHA = sha
+	})
+}
+
+// recordLockWait adds time spent waiting for locks to the task's total
+func (e *Executor) recordLockWait(task *state.Task, wait time.Duration) {
+	ms := wait.Milliseconds()
+	if ms == 0 {
+		return
+	}
+	task.LockWaitMS += ms
+	e.store.UpdateTask(e.run.ID, task.ID, func(t *state.Task) {
+		t.LockWaitMS += ms
+	})
 }
 
 // commitTask creates a git commit for the completed task
-func (e *Executor) commitTask(task *state.Task) (string, error) {
+func (e *Executor) commitTask(task *state.Task, summary *state.TaskSummary) (string, error) {
 	repo, err := git.Open(e.workDir)
 	if err != nil {
 		return "", fmt.Errorf("failed to open repository: %w", err)
@@ -137,74 +322,72 @@ func (e *Executor) commitTask(task *state.Task) (string, error) {
 		return "", nil // Nothing to commit
 	}
 
-	// Stage all changes
-	if err := repo.StageAll(); err != nil {
+	// Stage all changes except aiflow's own files
+	excludes := worktree.ManagedExcludes(e.cfg.WorktreeDir)
+	if err := repo.StageAll(excludes...); err != nil {
 		return "", fmt.Errorf("failed to stage changes: %w", err)
 	}
 
-	// Create commit
-	commitMsg := fmt.Sprintf("aiflow: %s", task.Title)
-	sha, err := repo.Commit(commitMsg)
+	// Refuse to commit aiflow-controlled paths, even ones that were already
+	// tracked or that the agent staged itself
+	staged, err := repo.StagedFiles()
 	if err != nil {
-		return "", fmt.Errorf("failed to commit: %w", err)
+		return "", fmt.Errorf("failed to list staged changes: %w", err)
 	}
-
-	return sha, nil
-}
-
-// runClaudeCode invokes Claude Code with the given prompt
-func (e *Executor) runClaudeCode(ctx context.Context, prompt string) (string, error) {
-	// Find Claude Code binary
-	claudePath := e.cfg.ClaudeCodePath
-	if claudePath == "" {
-		var err error
-		claudePath, err = exec.LookPath("claude")
-		if err != nil {
-			return "", fmt.Errorf("claude code not found in PATH")
+	var refused []string
+	for _, path := range staged {
+		if git.MatchesAny(excludes, path) {
+			refused = append(refused, path)
+		}
+	}
+	if len(refused) > 0 {
+		fmt.Printf("Warning: not committing aiflow-controlled paths: %s\n", strings.Join(refused, ", "))
+		if err := repo.Unstage(refused); err != nil {
+			return "", fmt.Errorf("failed to unstage aiflow paths: %w", err)
+		}
+		if len(refused) == len(staged) {
+			return "", nil // Nothing else to commit
 		}
 	}
 
-	// Write prompt to temp file
-	promptFile, err := os.CreateTemp("", "aiflow-prompt-*.md")
+	// Create commit
+	commitMsg, err := CommitMessage(e.cfg.Commit, newCommitData(e.run, task, summary))
 	if err != nil {
-		return "", fmt.Errorf("failed to create prompt file: %w", err)
+		fmt.Printf("Warning: %v; using the default commit message\n", err)
+		commitMsg = fmt.Sprintf("aiflow: %s", task.Title)
 	}
-	defer os.Remove(promptFile.Name())
-
-	if _, err := promptFile.WriteString(prompt); err != nil {
-		return "", fmt.Errorf("failed to write prompt: %w", err)
+	sign, err := e.commitSigning()
+	if err != nil {
+		return "", err
+	}
+	sha, err := repo.Commit(commitMsg, CommitOptions(e.cfg.Commit, sign))
+	if err != nil {
+		return "", fmt.Errorf("failed to commit: %w", err)
 	}
-	promptFile.Close()
-
-	// Build command
-	cmd := exec.CommandContext(ctx, claudePath,
-		"--print",           // Non-interactive mode
-		"--dangerously-skip-permissions", // Skip permission prompts
-	)
-	cmd.Dir = e.workDir
-
-	// Set up stdin with the prompt
-	cmd.Stdin = strings.NewReader(prompt)
 
-	// Capture output
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	return sha, nil
+}
 
-	// Run
-	err = cmd.Run()
-	if err != nil {
-		return stdout.String(), fmt.Errorf("claude code failed: %w: %s", err, stderr.String())
+// runClaudeCode invokes Claude Code with the given prompt, recording the
+// prompt, transcript and stderr when rec is set
+func (e *Executor) runClaudeCode(ctx context.Context, prompt string, rec *transcript.Recorder) (string, error) {
+	var transcriptW, stderrW io.Writer
+	if rec != nil {
+		if err := rec.WritePrompt(prompt); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+		transcriptW, stderrW = rec.Transcript(), rec.Stderr()
 	}
 
-	return stdout.String(), nil
+	client := claude.NewClient(e.cfg.ClaudeCodePath, e.workDir)
+	return client.ExecuteStream(ctx, prompt, transcriptW, stderrW)
 }
 
 // extractSummary asks Claude to extract a summary of the changes
-func (e *Executor) extractSummary(ctx context.Context, taskID string) (*state.TaskSummary, error) {
+func (e *Executor) extractSummary(ctx context.Context, taskID string, rec *transcript.Recorder) (*state.TaskSummary, error) {
 	prompt := ctxpkg.SummaryExtractionPrompt
 
-	output, err := e.runClaudeCode(ctx, prompt)
+	output, err := e.runClaudeCode(ctx, prompt, rec)
 	if err != nil {
 		return nil, err
 	}
@@ -234,6 +417,33 @@ func (e *Executor) ExecuteAll(ctx context.Context, progressFn func(completed, to
 	sched := scheduler.NewScheduler(e.run, e.cfg.MaxParallel)
 	total := len(e.run.Tasks)
 	completed := len(e.run.GetCompletedTasks())
+	requeues := make(map[string]int)
+	backoff := requeueBackoff
+
+	// Clear out locks left behind by crashed runs
+	if err := e.fileLock.CleanupStaleLocks(); err != nil {
+		fmt.Printf("Warning: failed to clean up stale locks: %v\n", err)
+	}
+
+	// Keep aiflow's own files out of git status, including in worktrees
+	// created before excludes were managed
+	if repo, err := git.Open(e.workDir); err == nil {
+		if err := repo.EnsureExcludes(worktree.ManagedExcludes(e.cfg.WorktreeDir)); err != nil {
+			fmt.Printf("Warning: failed to update git excludes: %v\n", err)
+		}
+	}
+
+	// Materialize only what the plan needs in sparse worktrees; a full
+	// tree still works if this fails
+	if err := e.scopeWorktree(); err != nil {
+		fmt.Printf("Warning: failed to narrow worktree: %v\n", err)
+	}
+
+	// Don't run agents whose work could not be committed with the
+	// required signature
+	if _, err := e.commitSigning(); err != nil {
+		return err
+	}
 
 	if progressFn != nil {
 		progressFn(completed, total)
@@ -256,15 +466,49 @@ func (e *Executor) ExecuteAll(ctx context.Context, progressFn func(completed, to
 		// Execute batch
 		results := e.ExecuteBatch(ctx, batch)
 
+		// Cancellation is not a task failure; leave the run resumable
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
 		// Process results
+		progressed := false
 		for _, result := range results {
+			if result.Requeued {
+				requeues[result.TaskID]++
+				if requeues[result.TaskID] < maxRequeues {
+					continue
+				}
+				// Give up on locks that never come free
+				result.Requeued = false
+				result.Error = fmt.Errorf("blocked after %d tries: %w", maxRequeues, result.Error)
+				e.store.SetTaskError(e.run.ID, result.TaskID, result.Error.Error())
+				e.recordEvent(state.EventTaskBlocked, result.TaskID, result.Error.Error(), nil)
+			}
 			if !result.Success {
-				// Update run status
+				// Update run status without clobbering concurrent task updates
 				e.run.Status = state.RunStatusFailed
-				e.store.SaveRun(e.run)
+				e.store.UpdateRun(e.run.ID, func(r *state.Run) error {
+					r.Status = state.RunStatusFailed
+					return nil
+				})
+				e.recordEvent(state.EventRunStatus, "", string(state.RunStatusFailed), nil)
 				return fmt.Errorf("task %s failed: %v", result.TaskID, result.Error)
 			}
 			completed++
+			progressed = true
+		}
+
+		// Only requeued tasks: wait before trying their locks again
+		if progressed {
+			backoff = requeueBackoff
+		} else {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff = min(2*backoff, maxRequeueBackoff)
 		}
 
 		// Reload run state (tasks updated)
@@ -282,7 +526,11 @@ func (e *Executor) ExecuteAll(ctx context.Context, progressFn func(completed, to
 	// Mark run complete
 	if e.run.IsComplete() {
 		e.run.Status = state.RunStatusCompleted
-		e.store.SaveRun(e.run)
+		e.store.UpdateRun(e.run.ID, func(r *state.Run) error {
+			r.Status = state.RunStatusCompleted
+			return nil
+		})
+		e.recordEvent(state.EventRunStatus, "", string(state.RunStatusCompleted), nil)
 	}
 
 	return nil
@@ -297,12 +545,12 @@ type StreamingExecutor struct {
 // OutputEvent represents a streaming output event
 type OutputEvent struct {
 	TaskID string
-	Type   string // "start", "output", "complete", "error"
+	Type   string // "start", "output", "complete", "requeued", "error"
 	Data   string
 }
 
 // NewStreamingExecutor creates an executor with streaming output
-func NewStreamingExecutor(cfg *config.Config, workDir string, store *state.Store, run *state.Run) *StreamingExecutor {
+func NewStreamingExecutor(cfg *config.Config, workDir string, store state.Store, run *state.Run) *StreamingExecutor {
 	return &StreamingExecutor{
 		Executor:   NewExecutor(cfg, workDir, store, run),
 		outputChan: make(chan OutputEvent, 100),
@@ -320,10 +568,15 @@ func (se *StreamingExecutor) ExecuteTaskStreaming(ctx context.Context, task *sta
 
 	result := se.ExecuteTask(ctx, task)
 
-	if result.Success {
+	switch {
+	case result.Success:
 		se.outputChan <- OutputEvent{TaskID: task.ID, Type: "complete", Data: "success"}
-	} else {
+	case result.Requeued:
+		se.outputChan <- OutputEvent{TaskID: task.ID, Type: "requeued", Data: "file locks busy"}
+	case result.Error != nil:
 		se.outputChan <- OutputEvent{TaskID: task.ID, Type: "error", Data: result.Error.Error()}
+	default:
+		se.outputChan <- OutputEvent{TaskID: task.ID, Type: "error", Data: "task failed"}
 	}
 
 	return result
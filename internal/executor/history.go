@@ -0,0 +1,211 @@
+package executor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/howell-aikit/aiflow/internal/config"
+	"github.com/howell-aikit/aiflow/internal/state"
+	"github.com/howell-aikit/aiflow/internal/worktree"
+	"github.com/howell-aikit/aiflow/pkg/git"
+)
+
+// CurateHistory prepares the branch a finished run is integrated from.
+// keep returns the run's own branch. squash and group write a curated copy
+// next to it, named <branch>-<strategy>, so the per-task history stays
+// available for rollback.
+func CurateHistory(cfg *config.Config, store state.Store, run *state.Run, strategy worktree.HistoryStrategy) (string, error) {
+	in, err := worktree.NewIntegrator(run.RepoPath, run.WorktreePath)
+	if err != nil {
+		return "", err
+	}
+	branch, err := in.FeatureBranch()
+	if err != nil {
+		return "", err
+	}
+	if strategy == worktree.HistoryKeep {
+		return branch, nil
+	}
+
+	base := run.BaseSHA
+	if base == "" {
+		base = run.BaseBranch
+	}
+	commits, fork, err := in.Commits(branch, base)
+	if err != nil {
+		return "", err
+	}
+	if len(commits) == 0 {
+		return "", fmt.Errorf("%s has no commits to curate", branch)
+	}
+
+	var segments []worktree.HistorySegment
+	switch strategy {
+	case worktree.HistorySquash:
+		segments = []worktree.HistorySegment{{
+			Last:    commits[len(commits)-1],
+			Message: historyMessage(run.FeatureDesc, completedTasks(run)),
+		}}
+	case worktree.HistoryGroup:
+		if in.HasMerges(fork, commits[len(commits)-1]) {
+			return "", fmt.Errorf("per-group history needs a linear branch; sync with rebase or squash instead")
+		}
+		if segments, err = groupSegments(in, run, commits); err != nil {
+			return "", err
+		}
+	}
+
+	sign, err := ResolveSigning(cfg.Commit, run.WorktreePath)
+	if err != nil {
+		return "", err
+	}
+	in.SetSigning(sign)
+
+	curated := fmt.Sprintf("%s-%s", branch, strategy)
+	tip, err := in.Curate(curated, fork, segments, identityEnv(cfg.Commit, run.WorktreePath))
+	if err != nil {
+		return "", err
+	}
+
+	run.HistoryBranch = curated
+	if err := store.UpdateRun(run.ID, func(r *state.Run) error {
+		r.HistoryBranch = curated
+		return nil
+	}); err != nil {
+		return "", fmt.Errorf("failed to record curated branch: %w", err)
+	}
+	state.RecordEvent(store, run.ID, state.EventHistoryCurated, "", curated, map[string]string{
+		"strategy": string(strategy),
+		"sha":      tip,
+		"commits":  strconv.Itoa(len(segments)),
+		"original": strconv.Itoa(len(commits)),
+	})
+	return curated, nil
+}
+
+// completedTasks returns the run's completed tasks in plan order
+func completedTasks(run *state.Run) []*state.Task {
+	var tasks []*state.Task
+	for _, t := range run.Tasks {
+		if t.Status == state.TaskStatusCompleted {
+			tasks = append(tasks, t)
+		}
+	}
+	return tasks
+}
+
+// historyGroup is a run of consecutive task commits from one parallel
+// group
+type historyGroup struct {
+	name  string
+	tasks []*state.Task
+	last  string
+}
+
+// groupSegments folds the run's commits into one segment per run of
+// consecutive commits from the same parallel group. Commits the agent made
+// itself go with the task commit that follows them, trailing ones with the
+// last group. A group whose tasks did not commit back to back gets more
+// than one segment.
+func groupSegments(in *worktree.Integrator, run *state.Run, commits []string) ([]worktree.HistorySegment, error) {
+	byCommit := make(map[string]*state.Task)
+	for _, t := range run.Tasks {
+		if t.CommitSHA != "" {
+			byCommit[t.CommitSHA] = t
+		}
+	}
+
+	var groups []*historyGroup
+	for _, sha := range commits {
+		t := byCommit[sha]
+		if t == nil {
+			continue
+		}
+		name := t.ParallelGroup
+		if name == "" {
+			name = t.ID
+		}
+		if n := len(groups); n > 0 && groups[n-1].name == name {
+			groups[n-1].tasks = append(groups[n-1].tasks, t)
+			groups[n-1].last = sha
+			continue
+		}
+		groups = append(groups, &historyGroup{name: name, tasks: []*state.Task{t}, last: sha})
+	}
+
+	last := commits[len(commits)-1]
+	if len(groups) == 0 {
+		return []worktree.HistorySegment{{Last: last, Message: historyMessage(run.FeatureDesc, nil)}}, nil
+	}
+	groups[len(groups)-1].last = last
+
+	segments := make([]worktree.HistorySegment, 0, len(groups))
+	for _, g := range groups {
+		message := historyMessage(g.name, g.tasks)
+		if len(g.tasks) == 1 {
+			// A lone task keeps its own commit message
+			msg, err := in.CommitMessage(g.tasks[0].CommitSHA)
+			if err != nil {
+				return nil, err
+			}
+			message = msg
+		}
+		segments = append(segments, worktree.HistorySegment{Last: g.last, Message: message})
+	}
+	return segments, nil
+}
+
+// historyMessage writes the message of a curated commit covering tasks,
+// listing each with the files its summary reports
+func historyMessage(subject string, tasks []*state.Task) string {
+	subject, _, _ = strings.Cut(strings.TrimSpace(subject), "\n")
+	if len(subject) > 64 {
+		subject = subject[:61] + "..."
+	}
+
+	var b strings.Builder
+	b.WriteString("aiflow: " + subject + "\n")
+	if len(tasks) > 0 {
+		b.WriteString("\nTasks:\n")
+	}
+	for _, t := range tasks {
+		fmt.Fprintf(&b, "- %s (%s)\n", t.Title, t.ID)
+		files := append(append([]string{}, t.FilesWrite...), t.FilesCreate...)
+		if t.Summary != nil {
+			files = append(append([]string{}, t.Summary.FilesChanged...), t.Summary.FilesCreated...)
+		}
+		if len(files) > 0 {
+			fmt.Fprintf(&b, "  Files: %s\n", strings.Join(files, ", "))
+		}
+	}
+	return b.String()
+}
+
+// identityEnv passes the [commit] identity to git commands that create
+// commits in dir. Unset parts fall back to git's own identity; only when
+// git has no committer does the author stand in.
+func identityEnv(c config.CommitConfig, dir string) []string {
+	committerName, committerEmail := c.CommitterName, c.CommitterEmail
+	if _, ok := git.CommitterIdent(dir); !ok {
+		if committerName == "" {
+			committerName = c.AuthorName
+		}
+		if committerEmail == "" {
+			committerEmail = c.AuthorEmail
+		}
+	}
+
+	var env []string
+	for _, v := range []struct{ key, value string }{
+		{"GIT_AUTHOR_NAME", c.AuthorName},
+		{"GIT_AUTHOR_EMAIL", c.AuthorEmail},
+		{"GIT_COMMITTER_NAME", committerName},
+		{"GIT_COMMITTER_EMAIL", committerEmail},
+	} {
+		if v.value != "" {
+			env = append(env, v.key+"="+v.value)
+		}
+	}
+	return env
+}
@@ -0,0 +1,332 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/howell-aikit/aiflow/internal/config"
+	"github.com/howell-aikit/aiflow/internal/state"
+	"github.com/howell-aikit/aiflow/internal/transcript"
+	"github.com/howell-aikit/aiflow/internal/worktree"
+	"github.com/howell-aikit/aiflow/pkg/git"
+)
+
+// RerunOptions controls where a task is re-run
+type RerunOptions struct {
+	// FreshWorktree runs the task in a new scratch worktree instead of the
+	// run's own, so no ignored files or build output carry over
+	FreshWorktree bool
+}
+
+// RerunResult is the outcome of re-running a task from its starting point
+type RerunResult struct {
+	TaskID   string
+	Attempt  int
+	BaseSHA  string // Commit the rerun started from
+	OldSHA   string // The task's current commit, if any
+	NewSHA   string // Commit of the rerun; BaseSHA when it changed nothing
+	Ref      string // Holds NewSHA until the result is kept or discarded
+	Summary  *state.TaskSummary
+	Duration time.Duration
+}
+
+// Changed reports whether the rerun committed anything
+func (r *RerunResult) Changed() bool {
+	return r.NewSHA != r.BaseSHA
+}
+
+// RerunTask executes one task again from the commit it last started from,
+// with the summaries of the tasks that had completed by then as context.
+// The run's state is left alone: the attempt is recorded as a rerun and its
+// commit is kept at a rerun ref for KeepRerun or DiscardRerun. The run's
+// worktree must be clean unless opts.FreshWorktree is set.
+func RerunTask(ctx context.Context, cfg *config.Config, store state.Store, run *state.Run, taskID string, opts RerunOptions) (*RerunResult, error) {
+	fresh, err := store.LoadRun(run.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load run: %w", err)
+	}
+	target := fresh.GetTask(taskID)
+	if target == nil {
+		return nil, fmt.Errorf("task %s not found in run %s", taskID, run.ID)
+	}
+	if target.BaseSHA == "" {
+		return nil, fmt.Errorf("task %s has no recorded starting point; it has not run yet", taskID)
+	}
+
+	repo, err := git.Open(fresh.WorktreePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open worktree: %w", err)
+	}
+	if _, err := repo.ResolveRef(target.BaseSHA); err != nil {
+		return nil, fmt.Errorf("starting point %s of task %s no longer exists", target.BaseSHA, taskID)
+	}
+
+	var dir string
+	if opts.FreshWorktree {
+		var cleanup func()
+		if dir, cleanup, err = scratchWorktree(cfg, fresh, fmt.Sprintf("%s-rerun-%s-%d", fresh.ID, taskID, time.Now().Unix()), target.BaseSHA); err != nil {
+			return nil, err
+		}
+		defer cleanup()
+	} else {
+		restore, err := detachAt(repo, target.BaseSHA)
+		if err != nil {
+			return nil, err
+		}
+		defer restore()
+		dir = fresh.WorktreePath
+	}
+
+	asOf := runBefore(repo, fresh, target)
+	e := NewExecutor(cfg, dir, store, asOf)
+	return e.rerunTask(ctx, asOf.GetTask(taskID), target.CommitSHA)
+}
+
+// rerunTask runs the agent, extracts a summary and commits, like
+// ExecuteTask, but only records the attempt
+func (e *Executor) rerunTask(ctx context.Context, task *state.Task, oldSHA string) (*RerunResult, error) {
+	startTime := time.Now()
+	result := &RerunResult{
+		TaskID:  task.ID,
+		BaseSHA: task.BaseSHA,
+		OldSHA:  oldSHA,
+		Ref:     git.RerunRef(e.run.ID, task.ID),
+	}
+
+	attempt := e.beginAttempt(task, 0)
+	attempt.Rerun = true
+	result.Attempt = attempt.Number
+	finish := func(err error) (*RerunResult, error) {
+		now := time.Now()
+		attempt.EndedAt = &now
+		attempt.Status = state.TaskStatusCompleted
+		if err != nil {
+			attempt.Status = state.TaskStatusFailed
+			attempt.Error = err.Error()
+		} else if result.Changed() {
+			attempt.CommitSHA = result.NewSHA
+		}
+		if err := e.store.RecordAttempt(e.run.ID, task.ID, attempt); err != nil {
+			fmt.Printf("Warning: failed to record attempt for task %s: %v\n", task.ID, err)
+		}
+		result.Duration = time.Since(startTime)
+
+		data := map[string]string{
+			"attempt": strconv.Itoa(attempt.Number),
+			"base":    result.BaseSHA,
+		}
+		if err != nil {
+			data["error"] = err.Error()
+		} else {
+			data["sha"] = result.NewSHA
+		}
+		e.recordEvent(state.EventTaskRerun, task.ID, task.Title, data)
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+
+	rec, err := e.transcripts.NewAttempt(e.run.ID, task.ID, attempt.Number)
+	if err != nil {
+		fmt.Printf("Warning: transcript will not be recorded: %v\n", err)
+		rec = nil
+	} else {
+		defer rec.Close()
+	}
+
+	if err := e.widenForTask(task); err != nil {
+		fmt.Printf("Warning: failed to widen worktree for %s: %v\n", task.ID, err)
+	}
+
+	prompt, err := e.ctxBuilder.BuildTaskPrompt(task)
+	if err != nil {
+		return finish(fmt.Errorf("failed to build prompt: %w", err))
+	}
+	if _, err := e.runClaudeCode(ctx, prompt, rec); err != nil {
+		return finish(err)
+	}
+
+	var summaryRec *transcript.Recorder
+	if rec != nil {
+		summaryRec, _ = rec.Sub("summary")
+		if summaryRec != nil {
+			defer summaryRec.Close()
+		}
+	}
+	summary, err := e.extractSummary(ctx, task.ID, summaryRec)
+	if err != nil {
+		fmt.Printf("Warning: failed to extract summary for task %s: %v\n", task.ID, err)
+	}
+	result.Summary = summary
+
+	sha, err := e.commitTask(task, summary)
+	if err != nil {
+		return finish(fmt.Errorf("failed to commit rerun: %w", err))
+	}
+	result.NewSHA = result.BaseSHA
+	if sha != "" {
+		result.NewSHA = sha
+	}
+
+	repo, err := git.Open(e.workDir)
+	if err != nil {
+		return finish(fmt.Errorf("failed to open repository: %w", err))
+	}
+	if err := repo.UpdateRef(result.Ref, result.NewSHA); err != nil {
+		return finish(err)
+	}
+	return finish(nil)
+}
+
+// KeepRerun makes a rerun's result the task's own. The run is rolled back
+// to the start of the task, so later tasks run again on top of the new
+// result; the rerun's commit and summary then stand in for the task's.
+func KeepRerun(store state.Store, run *state.Run, result *RerunResult) (*RollbackResult, error) {
+	rollback, err := RollbackRun(store, run, result.TaskID)
+	if err != nil {
+		return nil, err
+	}
+
+	repo, err := git.Open(run.WorktreePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open worktree: %w", err)
+	}
+	if err := repo.ResetHard(result.NewSHA); err != nil {
+		return nil, fmt.Errorf("failed to apply rerun of %s: %w", result.TaskID, err)
+	}
+
+	now := time.Now()
+	apply := func(t *state.Task) {
+		t.Status = state.TaskStatusCompleted
+		t.Summary = result.Summary
+		t.BaseSHA = result.BaseSHA
+		t.CommitSHA = ""
+		if result.Changed() {
+			t.CommitSHA = result.NewSHA
+		}
+		t.CompletedAt = &now
+	}
+	if err := store.UpdateTask(run.ID, result.TaskID, apply); err != nil {
+		return nil, fmt.Errorf("failed to update task %s: %w", result.TaskID, err)
+	}
+	if t := run.GetTask(result.TaskID); t != nil {
+		apply(t)
+	}
+
+	resolveRerun(store, repo, run, result, "keep")
+	return rollback, nil
+}
+
+// DiscardRerun drops a rerun's result, leaving the task as it was
+func DiscardRerun(store state.Store, run *state.Run, result *RerunResult) error {
+	repo, err := git.Open(run.WorktreePath)
+	if err != nil {
+		return fmt.Errorf("failed to open worktree: %w", err)
+	}
+	resolveRerun(store, repo, run, result, "discard")
+	return nil
+}
+
+// resolveRerun deletes the rerun ref and journals what became of it
+func resolveRerun(store state.Store, repo git.Git, run *state.Run, result *RerunResult, choice string) {
+	if err := repo.DeleteRef(result.Ref); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+	if err := state.RecordEvent(store, run.ID, state.EventRerunResolved, result.TaskID, choice, map[string]string{
+		"attempt": strconv.Itoa(result.Attempt),
+		"sha":     result.NewSHA,
+	}); err != nil {
+		fmt.Printf("Warning: failed to record rerun event: %v\n", err)
+	}
+}
+
+// runBefore returns a copy of run as it stood when target last started:
+// tasks whose work came later are pending without summaries, so the
+// context built for target is the one it originally had
+func runBefore(repo git.Git, run *state.Run, target *state.Task) *state.Run {
+	asOf := *run
+	asOf.Tasks = make([]*state.Task, len(run.Tasks))
+	for i, t := range run.Tasks {
+		c := *t
+		if t == target || !keptByRollback(repo, t, target) {
+			c.Status = state.TaskStatusPending
+			c.Summary = nil
+			c.CommitSHA = ""
+		}
+		asOf.Tasks[i] = &c
+	}
+	return &asOf
+}
+
+// detachAt checks out sha on a detached HEAD in a clean worktree and
+// returns a function that cleans up after the task and puts the original
+// branch back
+func detachAt(repo git.Git, sha string) (func(), error) {
+	dirty, err := repo.IsDirty()
+	if err != nil {
+		return nil, fmt.Errorf("failed to check worktree status: %w", err)
+	}
+	if dirty {
+		return nil, fmt.Errorf("the run's worktree has uncommitted changes; commit or roll them back first, or use a fresh worktree")
+	}
+
+	// A detached HEAD reports "HEAD" as its branch; go back to the commit
+	back, err := repo.CurrentBranch()
+	if err != nil || back == "HEAD" {
+		if back, err = repo.GetCommitHash(); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := repo.Run("checkout", "-q", "--detach", sha); err != nil {
+		return nil, fmt.Errorf("failed to check out %s: %w", sha, err)
+	}
+
+	return func() {
+		if err := repo.CleanWorkingTree(); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+		if _, err := repo.Run("checkout", "-q", back); err != nil {
+			fmt.Printf("Warning: failed to switch the worktree back to %s: %v\n", back, err)
+		}
+	}, nil
+}
+
+// scratchWorktree adds a worktree detached at sha next to the run's,
+// prepared and narrowed like the run's worktree, and returns it with a
+// function removing it
+func scratchWorktree(cfg *config.Config, run *state.Run, name, sha string) (string, func(), error) {
+	repoPath := run.RepoPath
+	if repoPath == "" {
+		var err error
+		if repoPath, err = worktree.SourceRepo(run.WorktreePath); err != nil {
+			return "", nil, err
+		}
+	}
+	mgr, err := worktree.NewManager(repoPath, cfg.WorktreeDir)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to initialize worktree manager: %w", err)
+	}
+
+	// Keep the run's sparse cone, so parallel candidates on a large
+	// repository don't each check out the whole tree
+	dir, err := mgr.CreateScratch(name, sha, run.SparseDirs)
+	if err != nil {
+		return "", nil, err
+	}
+	setup := mgr.Prepare(dir, worktree.SetupOptions{
+		Submodules: cfg.Worktree.Submodules,
+		LFS:        cfg.Worktree.LFS,
+	})
+	for _, skipped := range setup.Skipped {
+		fmt.Printf("Warning: worktree setup skipped %s\n", skipped)
+	}
+
+	return dir, func() {
+		if err := mgr.Remove(dir); err != nil {
+			fmt.Printf("Warning: failed to remove %s: %v\n", dir, err)
+		}
+	}, nil
+}
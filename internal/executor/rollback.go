@@ -0,0 +1,122 @@
+package executor
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/howell-aikit/aiflow/internal/state"
+	"github.com/howell-aikit/aiflow/pkg/git"
+)
+
+// RollbackResult describes a rollback of a run to a task boundary
+type RollbackResult struct {
+	TaskID    string
+	SHA       string   // Commit the worktree was reset to
+	BackupRef string   // Discarded history, with any uncommitted work on top
+	Reset     []string // Tasks marked pending again
+}
+
+// RollbackRun hard-resets the run's worktree to the commit taskID started
+// from. That task and every task whose work is not part of that commit go
+// back to pending with their summaries and commits cleared. The discarded
+// history, including uncommitted work, is kept at a backup ref first. run
+// is updated in place.
+func RollbackRun(store state.Store, run *state.Run, taskID string) (*RollbackResult, error) {
+	fresh, err := store.LoadRun(run.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load run: %w", err)
+	}
+	target := fresh.GetTask(taskID)
+	if target == nil {
+		return nil, fmt.Errorf("task %s not found in run %s", taskID, run.ID)
+	}
+	if target.BaseSHA == "" {
+		return nil, fmt.Errorf("task %s has no recorded starting point; it has not run yet", taskID)
+	}
+
+	repo, err := git.Open(fresh.WorktreePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open worktree: %w", err)
+	}
+	if _, err := repo.ResolveRef(target.BaseSHA); err != nil {
+		return nil, fmt.Errorf("starting point %s of task %s no longer exists", target.BaseSHA, taskID)
+	}
+
+	result := &RollbackResult{
+		TaskID:    taskID,
+		SHA:       target.BaseSHA,
+		BackupRef: git.BackupRef(run.ID, time.Now()),
+	}
+	message := fmt.Sprintf("aiflow: backup before rolling back %s to %s", run.ID, taskID)
+	if _, err := repo.SnapshotWIP(result.BackupRef, message); err != nil {
+		return nil, fmt.Errorf("failed to back up history: %w", err)
+	}
+	if err := repo.ResetHard(target.BaseSHA); err != nil {
+		return nil, fmt.Errorf("failed to roll back: %w", err)
+	}
+	if err := repo.CleanWorkingTree(); err != nil {
+		return nil, err
+	}
+
+	reset := make(map[string]bool)
+	for _, t := range fresh.Tasks {
+		if t == target || !keptByRollback(repo, t, target) {
+			reset[t.ID] = true
+			result.Reset = append(result.Reset, t.ID)
+		}
+	}
+
+	apply := func(r *state.Run) {
+		for _, t := range r.Tasks {
+			if reset[t.ID] {
+				resetTask(t)
+			}
+		}
+		if r.Status == state.RunStatusCompleted || r.Status == state.RunStatusFailed {
+			r.Status = state.RunStatusReady
+		}
+	}
+	if err := store.UpdateRun(run.ID, func(r *state.Run) error {
+		apply(r)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed to update run after rollback: %w", err)
+	}
+	apply(fresh)
+	*run = *fresh
+
+	state.RecordEvent(store, run.ID, state.EventRunRolledBack, taskID, "", map[string]string{
+		"sha":    result.SHA,
+		"backup": result.BackupRef,
+		"reset":  strings.Join(result.Reset, ","),
+	})
+	return result, nil
+}
+
+// keptByRollback reports whether a task's completed work survives a
+// rollback to the start of target: its commit is part of the history
+// rolled back to, or it made no commit and finished before target started
+func keptByRollback(repo git.Git, t, target *state.Task) bool {
+	if t.Status != state.TaskStatusCompleted {
+		return t.Status == state.TaskStatusPending && t.BaseSHA == ""
+	}
+	if t.CommitSHA != "" {
+		_, err := repo.Run("merge-base", "--is-ancestor", t.CommitSHA, target.BaseSHA)
+		return err == nil
+	}
+	return t.CompletedAt != nil && target.StartedAt != nil && t.CompletedAt.Before(*target.StartedAt)
+}
+
+// resetTask returns a task to pending as if it had not run. Its attempts
+// are kept as history.
+func resetTask(t *state.Task) {
+	t.Status = state.TaskStatusPending
+	t.Error = ""
+	t.Summary = nil
+	t.CommitSHA = ""
+	t.BaseSHA = ""
+	t.WIPRef = ""
+	t.StartedAt = nil
+	t.CompletedAt = nil
+}
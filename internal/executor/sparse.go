@@ -0,0 +1,128 @@
+package executor
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/howell-aikit/aiflow/internal/state"
+	"github.com/howell-aikit/aiflow/pkg/git"
+)
+
+// taskPaths returns every path a task declares
+func taskPaths(task *state.Task) []string {
+	paths := append([]string{}, task.FilesRead...)
+	paths = append(paths, task.FilesWrite...)
+	return append(paths, task.FilesCreate...)
+}
+
+// sparseEnabled reports whether the run's worktree may be narrowed. Runs
+// started with --no-worktree work in the user's own checkout, which is
+// never made sparse.
+func (e *Executor) sparseEnabled() bool {
+	if !e.cfg.Worktree.Sparse {
+		return false
+	}
+	if e.run.RepoPath == "" {
+		return true
+	}
+	a, errA := filepath.EvalSymlinks(e.workDir)
+	b, errB := filepath.EvalSymlinks(e.run.RepoPath)
+	return errA != nil || errB != nil || a != b
+}
+
+// scopeWorktree narrows the worktree to the directories the plan touches
+// plus worktree.sparse_include, once the breakdown exists. A worktree that
+// is already sparse is only widened, so resumed runs keep their cone.
+func (e *Executor) scopeWorktree() error {
+	if !e.sparseEnabled() || len(e.run.Tasks) == 0 {
+		return nil
+	}
+
+	var paths []string
+	for _, dir := range e.cfg.Worktree.SparseInclude {
+		paths = append(paths, strings.TrimSuffix(dir, "/")+"/")
+	}
+	for _, t := range e.run.Tasks {
+		paths = append(paths, taskPaths(t)...)
+	}
+
+	repo, err := git.Open(e.workDir)
+	if err != nil {
+		return err
+	}
+	if repo.IsSparse() {
+		return e.widenWorktree(repo, "", paths)
+	}
+
+	dirs := git.ConeDirs(paths)
+	if err := repo.SetSparse(dirs); err != nil {
+		return err
+	}
+	e.recordEvent(state.EventSparseNarrowed, "", strings.Join(dirs, ","), nil)
+	return e.saveSparseDirs(repo)
+}
+
+// widenForTask adds the directories a task references outside the cone
+func (e *Executor) widenForTask(task *state.Task) error {
+	if !e.sparseEnabled() {
+		return nil
+	}
+	repo, err := git.Open(e.workDir)
+	if err != nil {
+		return err
+	}
+	if !repo.IsSparse() {
+		return nil
+	}
+	return e.widenWorktree(repo, task.ID, taskPaths(task))
+}
+
+// widenWorktree adds the directories of paths the cone does not cover.
+// Parallel tasks share the worktree, so changes to the cone are serialized.
+func (e *Executor) widenWorktree(repo git.Git, taskID string, paths []string) error {
+	e.sparseMu.Lock()
+	defer e.sparseMu.Unlock()
+
+	cone, err := repo.SparseDirs()
+	if err != nil {
+		return err
+	}
+	var outside []string
+	for _, p := range paths {
+		if !git.ConeCovers(cone, p) {
+			outside = append(outside, p)
+		}
+	}
+	if len(outside) == 0 {
+		return nil
+	}
+
+	dirs := git.ConeDirs(outside)
+	if err := repo.AddSparse(dirs); err != nil {
+		return err
+	}
+	e.recordEvent(state.EventSparseWidened, taskID, strings.Join(dirs, ","), nil)
+	return e.saveSparseDirs(repo)
+}
+
+// saveSparseDirs records the worktree's current cone on the run. Scratch
+// worktrees of candidates and reruns keep theirs to themselves.
+func (e *Executor) saveSparseDirs(repo git.Git) error {
+	if e.workDir != e.run.WorktreePath {
+		return nil
+	}
+	cone, err := repo.SparseDirs()
+	if err != nil {
+		return err
+	}
+	err = e.store.UpdateRun(e.run.ID, func(r *state.Run) error {
+		r.SparseDirs = cone
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record sparse-checkout cone: %w", err)
+	}
+	e.run.SparseDirs = cone
+	return nil
+}
@@ -0,0 +1,163 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/howell-aikit/aiflow/internal/claude"
+	"github.com/howell-aikit/aiflow/internal/config"
+	"github.com/howell-aikit/aiflow/internal/redact"
+	"github.com/howell-aikit/aiflow/internal/state"
+	"github.com/howell-aikit/aiflow/internal/transcript"
+	"github.com/howell-aikit/aiflow/internal/verify"
+	"github.com/howell-aikit/aiflow/internal/worktree"
+)
+
+// SyncOptions selects how SyncRun brings a run up to date
+type SyncOptions struct {
+	Mode             worktree.SyncMode
+	ResolveConflicts bool // Let Claude resolve conflicts, then run the verify commands
+}
+
+// SyncRun brings the run's branch up to date with its base branch. After a
+// rebase the tasks' commit SHAs are moved to the rewritten commits. When
+// Claude resolved conflicts, the verify commands must pass or the worktree
+// is reset to where it was.
+func SyncRun(ctx context.Context, cfg *config.Config, store state.Store, run *state.Run, opts SyncOptions) (*worktree.SyncResult, error) {
+	in, err := worktree.NewIntegrator(run.RepoPath, run.WorktreePath)
+	if err != nil {
+		return nil, err
+	}
+	sign, err := ResolveSigning(cfg.Commit, run.WorktreePath)
+	if err != nil {
+		return nil, err
+	}
+	in.SetSigning(sign)
+
+	var resolve worktree.ConflictResolver
+	if opts.ResolveConflicts {
+		resolve = func(files []string) error {
+			return resolveConflicts(ctx, cfg, store, run, opts.Mode, files)
+		}
+	}
+
+	result, err := in.Sync(run.BaseBranch, opts.Mode, cfg.Integration.Remote, resolve)
+	if err != nil {
+		data := map[string]string{"mode": string(opts.Mode)}
+		if result != nil && len(result.Conflicts) > 0 {
+			data["conflicts"] = strings.Join(result.Conflicts, ",")
+		}
+		recordSyncEvent(store, run, err.Error(), data)
+		return result, err
+	}
+	if result.UpToDate {
+		return result, saveSyncedRun(store, run, result)
+	}
+
+	if result.Resolved && len(cfg.Verify.Commands) > 0 {
+		report := verify.Run(ctx, run.WorktreePath, cfg.Verify.Commands, cfg.VerifyTimeoutDuration())
+		if verr := report.Err(); verr != nil {
+			if err := in.ResetTo(result.OldHead); err != nil {
+				return result, fmt.Errorf("%v; additionally failed to undo the sync: %w", verr, err)
+			}
+			recordSyncEvent(store, run, "verify failed after conflict resolution; sync undone", map[string]string{
+				"mode":    string(opts.Mode),
+				"command": report.Failed().Command,
+			})
+			return result, fmt.Errorf("sync undone: %w", verr)
+		}
+	}
+
+	if err := saveSyncedRun(store, run, result); err != nil {
+		return result, err
+	}
+
+	recordSyncEvent(store, run, "", map[string]string{
+		"mode":      string(opts.Mode),
+		"base":      result.BaseRef,
+		"base_sha":  result.BaseSHA,
+		"old_head":  result.OldHead,
+		"new_head":  result.NewHead,
+		"conflicts": strings.Join(result.Conflicts, ","),
+		"resolved":  strconv.FormatBool(result.Resolved),
+	})
+	return result, nil
+}
+
+// saveSyncedRun records the base commit the run now builds on and moves
+// task commits to their rebased counterparts
+func saveSyncedRun(store state.Store, run *state.Run, result *worktree.SyncResult) error {
+	if run.BaseSHA == result.BaseSHA && len(result.Rewritten) == 0 {
+		return nil
+	}
+	rewritten := make(map[string]string, len(result.Rewritten)+1)
+	for old, sha := range result.Rewritten {
+		rewritten[old] = sha
+	}
+	if result.Mode == worktree.SyncRebase && run.BaseSHA != "" {
+		// Tasks that started on the old base now start on the new one
+		rewritten[run.BaseSHA] = result.BaseSHA
+	}
+	apply := func(r *state.Run) {
+		r.BaseSHA = result.BaseSHA
+		updateCommitSHAs(r, rewritten)
+	}
+	apply(run)
+	err := store.UpdateRun(run.ID, func(r *state.Run) error {
+		apply(r)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update run after sync: %w", err)
+	}
+	return nil
+}
+
+// updateCommitSHAs points task commits and starting points at their
+// rebased counterparts
+func updateCommitSHAs(run *state.Run, rewritten map[string]string) {
+	for _, t := range run.Tasks {
+		if sha, ok := rewritten[t.CommitSHA]; ok {
+			t.CommitSHA = sha
+		}
+		if sha, ok := rewritten[t.BaseSHA]; ok {
+			t.BaseSHA = sha
+		}
+	}
+}
+
+// resolveConflicts runs one Claude pass over the conflicted files, recorded
+// as an attempt of the sync pseudo-task
+func resolveConflicts(ctx context.Context, cfg *config.Config, store state.Store, run *state.Run, mode worktree.SyncMode, files []string) error {
+	transcripts := transcript.NewStore(cfg.StateDir, redact.ForConfig(cfg))
+	attempts, _ := transcripts.ListAttempts(run.ID, transcript.SyncTaskID)
+	number := 1
+	if n := len(attempts); n > 0 {
+		number = attempts[n-1] + 1
+	}
+
+	rec, err := transcripts.NewAttempt(run.ID, transcript.SyncTaskID, number)
+	if err != nil {
+		fmt.Printf("Warning: failed to record conflict resolution: %v\n", err)
+		rec = nil
+	}
+	if rec != nil {
+		defer rec.Close()
+	}
+
+	prompt := claude.BuildConflictPrompt(run.FeatureDesc, run.BaseBranch, string(mode), files)
+	e := &Executor{cfg: cfg, workDir: run.WorktreePath, store: store, run: run}
+	if _, err := e.runClaudeCode(ctx, prompt, rec); err != nil {
+		return fmt.Errorf("claude failed: %w", err)
+	}
+	return nil
+}
+
+// recordSyncEvent appends a sync entry to the run's journal
+func recordSyncEvent(store state.Store, run *state.Run, message string, data map[string]string) {
+	if err := state.RecordEvent(store, run.ID, state.EventRunSynced, "", message, data); err != nil {
+		fmt.Printf("Warning: failed to record sync event: %v\n", err)
+	}
+}
@@ -0,0 +1,281 @@
+// Package redact removes secrets from text before aiflow persists it. Each
+// detected secret is replaced with a typed marker such as
+// [REDACTED:github-token].
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+
+	"github.com/howell-aikit/aiflow/internal/config"
+)
+
+// rule is a named secret detector
+type rule struct {
+	name    string
+	pattern *regexp.Regexp
+	group   int // Submatch to replace; 0 replaces the whole match
+}
+
+// builtinRules detect well-known credential formats. Private key blocks come
+// first so their base64 body is not reported piecemeal as high-entropy text.
+var builtinRules = []rule{
+	{name: "private-key", pattern: regexp.MustCompile(`-----BEGIN [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----[\s\S]*?-----END [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----`)},
+	{name: "aws-access-key", pattern: regexp.MustCompile(`\b(?:AKIA|ASIA|AGPA|AIDA|AROA|ANPA|ANVA|AIPA)[0-9A-Z]{16}\b`)},
+	{name: "aws-secret-key", pattern: regexp.MustCompile(`(?i)aws_?secret_?(?:access_?)?key["']?\s*[:=]\s*["']?([A-Za-z0-9/+=]{40})\b`), group: 1},
+	{name: "github-token", pattern: regexp.MustCompile(`\b(?:ghp|gho|ghu|ghs|ghr)_[A-Za-z0-9]{36,}\b`)},
+	{name: "github-token", pattern: regexp.MustCompile(`\bgithub_pat_[A-Za-z0-9_]{22,}\b`)},
+	{name: "anthropic-key", pattern: regexp.MustCompile(`\bsk-ant-[A-Za-z0-9_-]{20,}`)},
+}
+
+// entropyCandidate matches tokens that could be random secrets
+var entropyCandidate = regexp.MustCompile(`[A-Za-z0-9+_-]+={0,2}`)
+
+// Redactor replaces secrets in strings. A nil Redactor leaves input unchanged.
+type Redactor struct {
+	rules            []rule
+	highEntropy      bool
+	entropyThreshold float64
+	entropyMinLength int
+}
+
+// New builds a redactor from configuration. It returns nil when redaction
+// is disabled and an error when a user pattern does not compile.
+func New(cfg config.RedactionConfig) (*Redactor, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	r := &Redactor{
+		rules:            append([]rule{}, builtinRules...),
+		highEntropy:      cfg.HighEntropy,
+		entropyThreshold: cfg.EntropyThreshold,
+		entropyMinLength: cfg.EntropyMinLength,
+	}
+	if r.entropyMinLength <= 0 {
+		r.entropyMinLength = 24
+	}
+	if r.entropyThreshold <= 0 {
+		r.entropyThreshold = 4.3
+	}
+
+	for _, p := range cfg.Patterns {
+		re, err := regexp.Compile(p.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", p.Name, err)
+		}
+		name := p.Name
+		if name == "" {
+			name = "custom"
+		}
+		r.rules = append(r.rules, rule{name: name, pattern: re})
+	}
+
+	return r, nil
+}
+
+// ForConfig builds the redactor for cfg, falling back to the built-in
+// detectors if a user pattern is invalid. Patterns are validated at startup,
+// so the fallback only matters for programmatic callers.
+func ForConfig(cfg *config.Config) *Redactor {
+	if cfg == nil {
+		return nil
+	}
+	r, err := New(cfg.Redaction)
+	if err != nil {
+		fallback := cfg.Redaction
+		fallback.Patterns = nil
+		r, _ = New(fallback)
+	}
+	return r
+}
+
+// String returns s with all detected secrets replaced by markers
+func (r *Redactor) String(s string) string {
+	return r.redact(s, r != nil && r.highEntropy)
+}
+
+// redact applies the detectors to s, with the high-entropy rule only when
+// entropy is set
+func (r *Redactor) redact(s string, entropy bool) string {
+	if r == nil || s == "" {
+		return s
+	}
+
+	for _, rl := range r.rules {
+		s = rl.replace(s)
+	}
+
+	if entropy {
+		s = entropyCandidate.ReplaceAllStringFunc(s, func(token string) string {
+			if r.isHighEntropy(token) {
+				return marker("high-entropy")
+			}
+			return token
+		})
+	}
+
+	return s
+}
+
+// Bytes is String for byte slices
+func (r *Redactor) Bytes(b []byte) []byte {
+	if r == nil {
+		return b
+	}
+	return []byte(r.String(string(b)))
+}
+
+// JSON redacts every string literal in a JSON document or JSONL line while
+// leaving its structure and formatting intact. Input that is not JSON is
+// still handled string-by-string, so it never gets less redaction than
+// Bytes.
+func (r *Redactor) JSON(data []byte) []byte {
+	return r.Fields(data, nil)
+}
+
+// Fields is JSON for documents that mix free text with identifiers such as
+// paths, branches and slugs, which the high-entropy rule would mangle. The
+// rule only applies to values under a key for which freeText returns true;
+// the credential patterns still apply everywhere. A nil freeText treats
+// every string as free text.
+func (r *Redactor) Fields(data []byte, freeText func(key string) bool) []byte {
+	if r == nil || bytes.IndexByte(data, '"') < 0 {
+		return r.Bytes(data)
+	}
+
+	var out []byte
+	var key string
+	last := 0
+	for i := 0; i < len(data); i++ {
+		if data[i] != '"' {
+			continue
+		}
+
+		// Find the closing quote, skipping escapes
+		j := i + 1
+		for j < len(data) && data[j] != '"' {
+			if data[j] == '\\' {
+				j++
+			}
+			j++
+		}
+		if j >= len(data) {
+			break
+		}
+
+		var s string
+		if err := json.Unmarshal(data[i:j+1], &s); err == nil {
+			isKey := isObjectKey(data[j+1:])
+			entropy := r.highEntropy && (freeText == nil || !isKey && freeText(key))
+			if isKey {
+				key = s
+			}
+			if redacted := r.redact(s, entropy); redacted != s {
+				out = append(out, data[last:i]...)
+				out = append(out, encodeString(redacted)...)
+				last = j + 1
+			}
+		}
+		i = j
+	}
+
+	if out == nil {
+		return data
+	}
+	return append(out, data[last:]...)
+}
+
+// isObjectKey reports whether the string literal followed by rest is an
+// object key
+func isObjectKey(rest []byte) bool {
+	rest = bytes.TrimLeft(rest, " \t\r\n")
+	return len(rest) > 0 && rest[0] == ':'
+}
+
+// replace applies one rule to s
+func (rl rule) replace(s string) string {
+	if rl.group == 0 {
+		return rl.pattern.ReplaceAllString(s, marker(rl.name))
+	}
+
+	matches := rl.pattern.FindAllStringSubmatchIndex(s, -1)
+	if matches == nil {
+		return s
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		start, end := m[2*rl.group], m[2*rl.group+1]
+		if start < 0 {
+			continue
+		}
+		b.WriteString(s[last:start])
+		b.WriteString(marker(rl.name))
+		last = end
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// isHighEntropy reports whether a token looks like a random secret: long,
+// mixing letters and digits, and with high Shannon entropy. Hex strings such
+// as commit SHAs stay below the threshold.
+func (r *Redactor) isHighEntropy(token string) bool {
+	if len(token) < r.entropyMinLength {
+		return false
+	}
+	if strings.HasPrefix(token, "REDACTED") {
+		return false
+	}
+
+	var hasLetter, hasDigit bool
+	for _, c := range token {
+		switch {
+		case c >= '0' && c <= '9':
+			hasDigit = true
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+			hasLetter = true
+		}
+	}
+	if !hasLetter || !hasDigit {
+		return false
+	}
+
+	return shannonEntropy(token) >= r.entropyThreshold
+}
+
+// shannonEntropy returns the bits of entropy per character of s
+func shannonEntropy(s string) float64 {
+	counts := make(map[rune]int)
+	for _, c := range s {
+		counts[c]++
+	}
+
+	n := float64(len(s))
+	var entropy float64
+	for _, count := range counts {
+		p := float64(count) / n
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// marker returns the replacement text for a secret of the given kind
+func marker(kind string) string {
+	return "[REDACTED:" + kind + "]"
+}
+
+// encodeString renders s as a JSON string literal without HTML escaping
+func encodeString(s string) []byte {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return bytes.TrimRight(buf.Bytes(), "\n")
+}
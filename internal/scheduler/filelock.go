@@ -1,9 +1,14 @@
 package scheduler
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -12,55 +17,83 @@ import (
 
 const lockSuffix = ".aiflow.lock"
 
+// LockDirName is the directory inside a worktree that holds lock files
+const LockDirName = ".aiflow-locks"
+
+// lockRetryDelay is how often a busy lock is polled while waiting
+const lockRetryDelay = 100 * time.Millisecond
+
+// ErrLocksBusy is returned when locks could not be acquired before the lock
+// timeout expired because another holder still has them
+var ErrLocksBusy = errors.New("locks busy")
+
+// LockHolder identifies the owner of a lock and is written into the lock file
+type LockHolder struct {
+	RunID      string    `json:"run_id"`
+	TaskID     string    `json:"task_id"`
+	File       string    `json:"file"`
+	PID        int       `json:"pid"`
+	Hostname   string    `json:"hostname"`
+	AcquiredAt time.Time `json:"acquired_at"`
+}
+
+// LockInfo describes a lock file found on disk
+type LockInfo struct {
+	Path   string      // Lock file path
+	File   string      // Locked file, relative to the worktree
+	Holder *LockHolder // Nil if the holder metadata is missing or unreadable
+	Stale  bool        // True if no process holds the lock anymore
+}
+
 // FileLock manages file locking for parallel execution
 type FileLock struct {
-	workDir     string
-	timeout     time.Duration
-	locks       map[string]*flock.Flock
-	mu          sync.Mutex
+	workDir string
+	runID   string
+	timeout time.Duration
+	locks   map[string]*flock.Flock
+	mu      sync.Mutex
 }
 
-// NewFileLock creates a new file lock manager
-func NewFileLock(workDir string, timeout time.Duration) *FileLock {
+// NewFileLock creates a new file lock manager for a run
+func NewFileLock(workDir, runID string, timeout time.Duration) *FileLock {
 	return &FileLock{
 		workDir: workDir,
+		runID:   runID,
 		timeout: timeout,
 		locks:   make(map[string]*flock.Flock),
 	}
 }
 
-// LockFiles acquires locks for the given files
-func (fl *FileLock) LockFiles(files []string) error {
-	fl.mu.Lock()
-	defer fl.mu.Unlock()
+// LockFiles acquires locks for the given files on behalf of a task, waiting
+// up to the lock timeout for busy locks. Cancelling ctx interrupts the wait
+// and returns ctx.Err(); running out of time returns ErrLocksBusy. Either way
+// no locks are held on error.
+func (fl *FileLock) LockFiles(ctx context.Context, taskID string, files []string) error {
+	lockCtx, cancel := context.WithTimeout(ctx, fl.timeout)
+	defer cancel()
 
 	var acquired []string
 
 	for _, file := range files {
-		lockPath := fl.lockPath(file)
-
-		// Ensure lock directory exists
-		lockDir := filepath.Dir(lockPath)
-		if err := os.MkdirAll(lockDir, 0755); err != nil {
-			fl.unlockFilesLocked(acquired)
-			return fmt.Errorf("failed to create lock directory: %w", err)
-		}
-
-		lock := flock.New(lockPath)
-		ctx, cancel := contextWithTimeout(fl.timeout)
-		defer cancel()
-
-		locked, err := lock.TryLockContext(ctx, 100*time.Millisecond)
+		lock, err := fl.newLock(file)
 		if err != nil {
-			fl.unlockFilesLocked(acquired)
-			return fmt.Errorf("failed to acquire lock for %s: %w", file, err)
+			fl.UnlockFiles(acquired)
+			return err
 		}
+
+		locked, err := lock.TryLockContext(lockCtx, lockRetryDelay)
 		if !locked {
-			fl.unlockFilesLocked(acquired)
-			return fmt.Errorf("timeout waiting for lock on %s", file)
+			fl.UnlockFiles(acquired)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err == nil || errors.Is(err, context.DeadlineExceeded) {
+				return fmt.Errorf("%w: timeout waiting for lock on %s", ErrLocksBusy, file)
+			}
+			return fmt.Errorf("failed to acquire lock for %s: %w", file, err)
 		}
 
-		fl.locks[file] = lock
+		fl.register(taskID, file, lock)
 		acquired = append(acquired, file)
 	}
 
@@ -121,98 +154,236 @@ func (fl *FileLock) IsLocked(file string) bool {
 	return ok
 }
 
-// TryLockFiles attempts to lock files without blocking
-func (fl *FileLock) TryLockFiles(files []string) (bool, error) {
-	fl.mu.Lock()
-	defer fl.mu.Unlock()
-
+// TryLockFiles attempts to lock files for a task without blocking
+func (fl *FileLock) TryLockFiles(taskID string, files []string) (bool, error) {
 	var acquired []string
 
 	for _, file := range files {
-		lockPath := fl.lockPath(file)
-
-		// Ensure lock directory exists
-		lockDir := filepath.Dir(lockPath)
-		if err := os.MkdirAll(lockDir, 0755); err != nil {
-			fl.unlockFilesLocked(acquired)
-			return false, fmt.Errorf("failed to create lock directory: %w", err)
+		lock, err := fl.newLock(file)
+		if err != nil {
+			fl.UnlockFiles(acquired)
+			return false, err
 		}
 
-		lock := flock.New(lockPath)
 		locked, err := lock.TryLock()
 		if err != nil {
-			fl.unlockFilesLocked(acquired)
+			fl.UnlockFiles(acquired)
 			return false, fmt.Errorf("failed to try lock for %s: %w", file, err)
 		}
 		if !locked {
-			fl.unlockFilesLocked(acquired)
+			fl.UnlockFiles(acquired)
 			return false, nil
 		}
 
-		fl.locks[file] = lock
+		fl.register(taskID, file, lock)
 		acquired = append(acquired, file)
 	}
 
 	return true, nil
 }
 
+// register records a freshly acquired lock and writes holder metadata into
+// the lock file. The metadata is informational, so write errors are ignored.
+func (fl *FileLock) register(taskID, file string, lock *flock.Flock) {
+	hostname, _ := os.Hostname()
+	holder := LockHolder{
+		RunID:      fl.runID,
+		TaskID:     taskID,
+		File:       file,
+		PID:        os.Getpid(),
+		Hostname:   hostname,
+		AcquiredAt: time.Now(),
+	}
+	if data, err := json.MarshalIndent(holder, "", "  "); err == nil {
+		os.WriteFile(lock.Path(), data, 0600)
+	}
+
+	fl.mu.Lock()
+	fl.locks[file] = lock
+	fl.mu.Unlock()
+}
+
+// newLock prepares the lock file for a file and returns an unlocked handle
+func (fl *FileLock) newLock(file string) (*flock.Flock, error) {
+	lockPath := fl.lockPath(file)
+
+	// Ensure lock directory exists
+	lockDir := filepath.Dir(lockPath)
+	if err := os.MkdirAll(lockDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create lock directory: %w", err)
+	}
+
+	return flock.New(lockPath), nil
+}
+
 // lockPath returns the lock file path for a given file
 func (fl *FileLock) lockPath(file string) string {
-	// Store locks in a .aiflow-locks directory
-	lockDir := filepath.Join(fl.workDir, ".aiflow-locks")
-	// Use the file path as the lock name (replace path separators)
+	return lockPathFor(fl.workDir, file)
+}
+
+// lockPathFor returns the lock file path for a file within a worktree
+func lockPathFor(workDir, file string) string {
+	// Store locks in a .aiflow-locks directory, mirroring the file's path
+	lockDir := filepath.Join(workDir, LockDirName)
 	lockName := file + lockSuffix
 	return filepath.Join(lockDir, lockName)
 }
 
-// CleanupStaleLocks removes any stale lock files
+// CleanupStaleLocks removes lock files left behind by holders that are gone
 func (fl *FileLock) CleanupStaleLocks() error {
-	lockDir := filepath.Join(fl.workDir, ".aiflow-locks")
-
-	entries, err := os.ReadDir(lockDir)
+	locks, err := ListLocks(fl.workDir)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil
-		}
 		return err
 	}
 
-	for _, entry := range entries {
-		if entry.IsDir() {
+	for _, info := range locks {
+		if !info.Stale {
 			continue
 		}
 
-		lockPath := filepath.Join(lockDir, entry.Name())
-		lock := flock.New(lockPath)
-
-		// Try to acquire lock - if successful, it's stale
+		// Hold the lock while removing so nobody grabs the old inode
+		lock := flock.New(info.Path)
 		locked, err := lock.TryLock()
-		if err != nil {
+		if err != nil || !locked {
 			continue
 		}
-		if locked {
-			lock.Unlock()
-			os.Remove(lockPath)
-		}
+		os.Remove(info.Path)
+		lock.Unlock()
 	}
 
+	removeEmptyDirs(filepath.Join(fl.workDir, LockDirName))
 	return nil
 }
 
+// ListLocks returns all lock files in a worktree along with their holders
+func ListLocks(workDir string) ([]LockInfo, error) {
+	lockDir := filepath.Join(workDir, LockDirName)
+
+	var locks []LockInfo
+	err := filepath.WalkDir(lockDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == lockDir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(path, lockSuffix) {
+			return nil
+		}
+
+		rel, _ := filepath.Rel(lockDir, path)
+		info := LockInfo{
+			Path:   path,
+			File:   filepath.ToSlash(strings.TrimSuffix(rel, lockSuffix)),
+			Holder: readHolder(path),
+			Stale:  isStale(path),
+		}
+		locks = append(locks, info)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lock directory: %w", err)
+	}
+
+	return locks, nil
+}
+
+// BreakLock force-releases a lock by removing its lock file. target may be
+// the locked file (relative to the worktree) or the lock file itself. It
+// returns the holder that was recorded in the lock, if any. Only lock files
+// inside the worktree's lock directory are ever removed.
+func BreakLock(workDir, target string) (*LockHolder, error) {
+	lockDir := filepath.Join(workDir, LockDirName)
+	lockPath := filepath.Clean(target)
+	switch {
+	case filepath.IsAbs(lockPath):
+	case strings.HasSuffix(lockPath, lockSuffix):
+		// Lock files are named relative to the lock directory, as listed
+		lockPath = strings.TrimPrefix(lockPath, LockDirName+string(filepath.Separator))
+		lockPath = filepath.Join(lockDir, lockPath)
+	default:
+		lockPath = lockPathFor(workDir, lockPath)
+	}
+
+	rel, err := filepath.Rel(lockDir, lockPath)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) ||
+		!strings.HasSuffix(lockPath, lockSuffix) {
+		return nil, fmt.Errorf("%s is not a lock in %s", target, lockDir)
+	}
+
+	if _, err := os.Stat(lockPath); err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("no lock found for %s", target)
+		}
+		return nil, err
+	}
+
+	holder := readHolder(lockPath)
+	if err := os.Remove(lockPath); err != nil {
+		return nil, fmt.Errorf("failed to remove lock file: %w", err)
+	}
+
+	removeEmptyDirs(filepath.Join(workDir, LockDirName))
+	return holder, nil
+}
+
+// readHolder parses the holder metadata stored in a lock file
+func readHolder(lockPath string) *LockHolder {
+	data, err := os.ReadFile(lockPath)
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+
+	var holder LockHolder
+	if err := json.Unmarshal(data, &holder); err != nil {
+		return nil
+	}
+	return &holder
+}
+
+// isStale reports whether nobody holds the lock at the given path
+func isStale(lockPath string) bool {
+	lock := flock.New(lockPath)
+	locked, err := lock.TryLock()
+	if err != nil || !locked {
+		return false
+	}
+	lock.Unlock()
+	return true
+}
+
+// removeEmptyDirs prunes empty subdirectories left behind by removed locks
+func removeEmptyDirs(root string) {
+	var dirs []string
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && d.IsDir() && path != root {
+			dirs = append(dirs, path)
+		}
+		return nil
+	})
+
+	// Deepest first so parents become empty as children go
+	for i := len(dirs) - 1; i >= 0; i-- {
+		os.Remove(dirs[i])
+	}
+}
+
 // LockSet represents a set of locks for a task
 type LockSet struct {
 	fl    *FileLock
 	files []string
 }
 
-// AcquireLockSet acquires locks for all task files
-func (fl *FileLock) AcquireLockSet(writeFiles, createFiles []string) (*LockSet, error) {
-	allFiles := append(writeFiles, createFiles...)
+// AcquireLockSet acquires locks for all files a task touches. It returns
+// ErrLocksBusy if the files are still held by someone else once the lock
+// timeout expires.
+func (fl *FileLock) AcquireLockSet(ctx context.Context, taskID string, writeFiles, createFiles []string) (*LockSet, error) {
+	allFiles := uniqueFiles(writeFiles, createFiles)
 	if len(allFiles) == 0 {
 		return &LockSet{fl: fl, files: nil}, nil
 	}
 
-	if err := fl.LockFiles(allFiles); err != nil {
+	if err := fl.LockFiles(ctx, taskID, allFiles); err != nil {
 		return nil, err
 	}
 
@@ -227,37 +398,19 @@ func (ls *LockSet) Release() error {
 	return ls.fl.UnlockFiles(ls.files)
 }
 
-// contextWithTimeout creates a context that times out
-// Simple implementation since we don't want to import context package
-type timeoutContext struct {
-	deadline time.Time
-}
-
-func contextWithTimeout(timeout time.Duration) (*timeoutContext, func()) {
-	ctx := &timeoutContext{deadline: time.Now().Add(timeout)}
-	return ctx, func() {}
-}
-
-func (c *timeoutContext) Done() <-chan struct{} {
-	ch := make(chan struct{})
-	go func() {
-		time.Sleep(time.Until(c.deadline))
-		close(ch)
-	}()
-	return ch
-}
-
-func (c *timeoutContext) Err() error {
-	if time.Now().After(c.deadline) {
-		return fmt.Errorf("context deadline exceeded")
+// uniqueFiles merges file lists, dropping duplicates so a task never waits
+// on a lock it already holds
+func uniqueFiles(lists ...[]string) []string {
+	seen := make(map[string]bool)
+	var files []string
+	for _, list := range lists {
+		for _, f := range list {
+			if seen[f] {
+				continue
+			}
+			seen[f] = true
+			files = append(files, f)
+		}
 	}
-	return nil
-}
-
-func (c *timeoutContext) Deadline() (time.Time, bool) {
-	return c.deadline, true
-}
-
-func (c *timeoutContext) Value(key interface{}) interface{} {
-	return nil
+	return files
 }
@@ -0,0 +1,765 @@
+package state
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/howell-aikit/aiflow/internal/redact"
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltFileName is the database file inside the state directory
+const boltFileName = "aiflow.db"
+
+// boltTimeout bounds how long we wait for another process to release the
+// database file
+const boltTimeout = 10 * time.Second
+
+var (
+	bucketRuns       = []byte("runs")
+	bucketTasks      = []byte("tasks")    // run ID -> task index -> task
+	bucketAttempts   = []byte("attempts") // run ID -> task ID + number -> attempt
+	bucketIdxStatus  = []byte("idx_status")
+	bucketIdxCreated = []byte("idx_created")
+	bucketIdxRepo    = []byte("idx_repo")
+	bucketMeta       = []byte("meta")
+
+	keyCurrentRun = []byte("current_run")
+)
+
+// BoltStore keeps runs in an embedded bbolt database. Tasks and attempts
+// live in their own buckets so updating one task does not rewrite the
+// whole run, and secondary indexes make status, date and repository queries
+// cheap.
+//
+// The database is opened per operation rather than held open, because bbolt
+// takes an exclusive file lock and other aiflow processes (status, list)
+// must be able to read while a run is executing. Reads open it read-only,
+// which only takes a shared lock.
+type BoltStore struct {
+	stateDir string
+	path     string
+	journal  *Journal
+	redactor *redact.Redactor
+	mu       sync.Mutex
+}
+
+// NewBoltStore opens (creating if needed) the bbolt store in stateDir. A new
+// database imports any runs already saved by the JSON file backend.
+func NewBoltStore(stateDir string) (*BoltStore, error) {
+	if err := os.MkdirAll(stateDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	s := &BoltStore{
+		stateDir: stateDir,
+		path:     filepath.Join(stateDir, boltFileName),
+		journal:  NewJournal(stateDir),
+	}
+	_, statErr := os.Stat(s.path)
+	fresh := os.IsNotExist(statErr)
+
+	err := s.update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bucketRuns, bucketTasks, bucketAttempts, bucketIdxStatus,
+			bucketIdxCreated, bucketIdxRepo, bucketMeta} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize state database: %w", err)
+	}
+
+	if fresh {
+		if err := s.importFileStore(stateDir); err != nil {
+			return nil, fmt.Errorf("failed to import existing runs: %w", err)
+		}
+	}
+
+	return s, nil
+}
+
+// importFileStore copies runs saved by the JSON backend. Their journals are
+// already where this store expects them.
+func (s *BoltStore) importFileStore(stateDir string) error {
+	if _, err := os.Stat(filepath.Join(stateDir, "runs")); err != nil {
+		return nil
+	}
+
+	files, err := NewFileStore(stateDir)
+	if err != nil {
+		return err
+	}
+	runs, err := files.ListRuns()
+	if err != nil {
+		return err
+	}
+	currentID, _ := files.GetCurrentRunID()
+
+	return s.update(func(tx *bolt.Tx) error {
+		for _, run := range runs {
+			if err := s.putRun(tx, run); err != nil {
+				return err
+			}
+		}
+		if currentID != "" {
+			return tx.Bucket(bucketMeta).Put(keyCurrentRun, []byte(currentID))
+		}
+		return nil
+	})
+}
+
+// Close releases store resources; the database is only open during
+// operations
+func (s *BoltStore) Close() error {
+	return nil
+}
+
+// update runs fn in a read-write transaction, holding the database file
+// only for its duration
+func (s *BoltStore) update(fn func(tx *bolt.Tx) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	db, err := s.open(false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(fn)
+}
+
+// view runs fn in a read-only transaction
+func (s *BoltStore) view(fn func(tx *bolt.Tx) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	db, err := s.open(true)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.View(fn)
+}
+
+// open opens the database file, waiting up to boltTimeout for a writer in
+// another process to finish
+func (s *BoltStore) open(readOnly bool) (*bolt.DB, error) {
+	db, err := bolt.Open(s.path, 0644, &bolt.Options{Timeout: boltTimeout, ReadOnly: readOnly})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return nil, fmt.Errorf("state database %s is busy in another aiflow process", s.path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state database: %w", err)
+	}
+	return db, nil
+}
+
+// CreateRun creates a new run and persists it
+func (s *BoltStore) CreateRun(featureDesc, worktreePath, baseBranch string) (*Run, error) {
+	run := newRun(uuid.New().String()[:8], featureDesc, worktreePath, baseBranch)
+
+	err := s.update(func(tx *bolt.Tx) error {
+		if err := s.putRun(tx, run); err != nil {
+			return err
+		}
+		return tx.Bucket(bucketMeta).Put(keyCurrentRun, []byte(run.ID))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return run, nil
+}
+
+// SaveRun persists a run
+func (s *BoltStore) SaveRun(run *Run) error {
+	run.UpdatedAt = time.Now()
+	return s.update(func(tx *bolt.Tx) error {
+		return s.putRun(tx, run)
+	})
+}
+
+// LoadRun loads a run with its tasks and attempts
+func (s *BoltStore) LoadRun(id string) (*Run, error) {
+	var run *Run
+	err := s.view(func(tx *bolt.Tx) error {
+		var err error
+		run, err = getRun(tx, id)
+		return err
+	})
+	return run, err
+}
+
+// UpdateRun loads a run, applies updateFn and saves it in one transaction
+func (s *BoltStore) UpdateRun(runID string, updateFn func(*Run) error) error {
+	return s.update(func(tx *bolt.Tx) error {
+		run, err := getRun(tx, runID)
+		if err != nil {
+			return err
+		}
+		if err := updateFn(run); err != nil {
+			return err
+		}
+		run.UpdatedAt = time.Now()
+		return s.putRun(tx, run)
+	})
+}
+
+// DeleteRun removes a run and everything recorded for it
+func (s *BoltStore) DeleteRun(id string) error {
+	s.journal.Remove(id)
+	RemoveLease(s.stateDir, id)
+	os.RemoveAll(RunDataDir(s.stateDir, id))
+	return s.update(func(tx *bolt.Tx) error {
+		runs := tx.Bucket(bucketRuns)
+		if data := runs.Get([]byte(id)); data != nil {
+			var prev Run
+			if err := json.Unmarshal(data, &prev); err == nil {
+				if err := deleteIndexes(tx, &prev); err != nil {
+					return err
+				}
+			}
+		}
+		if err := runs.Delete([]byte(id)); err != nil {
+			return err
+		}
+
+		for _, name := range [][]byte{bucketTasks, bucketAttempts} {
+			err := tx.Bucket(name).DeleteBucket([]byte(id))
+			if err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+				return err
+			}
+		}
+
+		meta := tx.Bucket(bucketMeta)
+		if string(meta.Get(keyCurrentRun)) == id {
+			return meta.Delete(keyCurrentRun)
+		}
+		return nil
+	})
+}
+
+// ListRuns returns all runs sorted by creation time (newest first)
+func (s *BoltStore) ListRuns() ([]*Run, error) {
+	return s.QueryRuns(RunQuery{})
+}
+
+// QueryRuns returns runs matching q, newest first, using the most selective
+// index available
+func (s *BoltStore) QueryRuns(q RunQuery) ([]*Run, error) {
+	var runs []*Run
+	err := s.view(func(tx *bolt.Tx) error {
+		var ids []string
+		switch {
+		case q.Status != "":
+			ids = scanPrefix(tx.Bucket(bucketIdxStatus), []byte(string(q.Status)+"\x00"))
+		case q.Repo != "" && q.CommonDir == "":
+			// The repo index only knows the path a run was started from
+			ids = scanPrefix(tx.Bucket(bucketIdxRepo), []byte(q.Repo+"\x00"))
+		default:
+			ids = scanCreated(tx.Bucket(bucketIdxCreated), q.Since, q.Until)
+		}
+
+		for _, id := range ids {
+			run, err := getRun(tx, id)
+			if err != nil {
+				return err
+			}
+			if q.Matches(run) {
+				runs = append(runs, run)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return q.sortAndLimit(runs), nil
+}
+
+// AddTask adds a task to a run
+func (s *BoltStore) AddTask(runID string, task *Task) error {
+	return s.UpdateRun(runID, func(run *Run) error {
+		run.Tasks = append(run.Tasks, task)
+		return nil
+	})
+}
+
+// UpdateTask updates a single task record without rewriting the run
+func (s *BoltStore) UpdateTask(runID, taskID string, updateFn func(*Task)) error {
+	return s.update(func(tx *bolt.Tx) error {
+		// Older runs are upgraded as a whole first
+		if !runIsCurrent(tx, runID) {
+			run, err := getRun(tx, runID)
+			if err != nil {
+				return err
+			}
+			task := run.GetTask(taskID)
+			if task == nil {
+				return fmt.Errorf("task %s not found in run %s", taskID, runID)
+			}
+			updateFn(task)
+			run.UpdatedAt = time.Now()
+			return s.putRun(tx, run)
+		}
+
+		tasks := tx.Bucket(bucketTasks).Bucket([]byte(runID))
+		if tasks == nil {
+			return fmt.Errorf("run %s not found", runID)
+		}
+
+		c := tasks.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			var task Task
+			if err := json.Unmarshal(v, &task); err != nil {
+				return fmt.Errorf("failed to unmarshal task: %w", err)
+			}
+			if task.ID != taskID {
+				continue
+			}
+
+			updateFn(&task)
+			if err := s.putTask(tasks, k, &task); err != nil {
+				return err
+			}
+			return s.touchRun(tx, runID)
+		}
+
+		return fmt.Errorf("task %s not found in run %s", taskID, runID)
+	})
+}
+
+// SetTaskStatus updates a task's status
+func (s *BoltStore) SetTaskStatus(runID, taskID string, status TaskStatus) error {
+	return s.UpdateTask(runID, taskID, func(t *Task) {
+		applyTaskStatus(t, status)
+	})
+}
+
+// SetTaskSummary sets the summary for a completed task
+func (s *BoltStore) SetTaskSummary(runID, taskID string, summary *TaskSummary) error {
+	return s.UpdateTask(runID, taskID, func(t *Task) {
+		t.Summary = summary
+	})
+}
+
+// SetTaskError sets an error message for a failed task
+func (s *BoltStore) SetTaskError(runID, taskID, errMsg string) error {
+	return s.UpdateTask(runID, taskID, func(t *Task) {
+		applyTaskError(t, errMsg)
+	})
+}
+
+// RecordAttempt adds or replaces an attempt (matched by number) on a task
+func (s *BoltStore) RecordAttempt(runID, taskID string, attempt *Attempt) error {
+	return s.update(func(tx *bolt.Tx) error {
+		if tx.Bucket(bucketRuns).Get([]byte(runID)) == nil {
+			return fmt.Errorf("run %s not found", runID)
+		}
+		return s.putAttempt(tx, runID, taskID, attempt)
+	})
+}
+
+// ListAttempts returns a task's attempts in order
+func (s *BoltStore) ListAttempts(runID, taskID string) ([]*Attempt, error) {
+	var attempts []*Attempt
+	err := s.view(func(tx *bolt.Tx) error {
+		var err error
+		attempts, err = getAttempts(tx, runID, taskID)
+		return err
+	})
+	return attempts, err
+}
+
+// AppendEvent appends an event to the run's journal
+func (s *BoltStore) AppendEvent(runID string, event *Event) error {
+	return s.journal.Append(runID, event)
+}
+
+// ListEvents returns all events recorded for a run in order
+func (s *BoltStore) ListEvents(runID string) ([]*Event, error) {
+	return s.journal.Read(runID)
+}
+
+// SetCurrentRun sets the current active run
+func (s *BoltStore) SetCurrentRun(id string) error {
+	return s.update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketMeta).Put(keyCurrentRun, []byte(id))
+	})
+}
+
+// GetCurrentRunID returns the ID of the current run
+func (s *BoltStore) GetCurrentRunID() (string, error) {
+	var id string
+	err := s.view(func(tx *bolt.Tx) error {
+		id = string(tx.Bucket(bucketMeta).Get(keyCurrentRun))
+		return nil
+	})
+	return id, err
+}
+
+// GetCurrentRun returns the current active run
+func (s *BoltStore) GetCurrentRun() (*Run, error) {
+	id, err := s.GetCurrentRunID()
+	if err != nil {
+		return nil, err
+	}
+	if id == "" {
+		return nil, nil
+	}
+	return s.LoadRun(id)
+}
+
+// ClearCurrentRun clears the current run pointer
+func (s *BoltStore) ClearCurrentRun() error {
+	return s.update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketMeta).Delete(keyCurrentRun)
+	})
+}
+
+// putRun writes a run record, its tasks, attempts and index entries
+func (s *BoltStore) putRun(tx *bolt.Tx, run *Run) error {
+	runs := tx.Bucket(bucketRuns)
+	if data := runs.Get([]byte(run.ID)); data != nil {
+		var prev Run
+		if err := json.Unmarshal(data, &prev); err == nil {
+			if err := deleteIndexes(tx, &prev); err != nil {
+				return err
+			}
+		}
+	}
+
+	record := *run
+	record.Tasks = nil
+	data, err := json.Marshal(&record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal run: %w", err)
+	}
+	data = redactState(s.redactor, data)
+	if err := runs.Put([]byte(run.ID), data); err != nil {
+		return err
+	}
+	if err := putIndexes(tx, run); err != nil {
+		return err
+	}
+
+	// Replace the task list wholesale so removed tasks disappear
+	taskRoot := tx.Bucket(bucketTasks)
+	if err := taskRoot.DeleteBucket([]byte(run.ID)); err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+		return err
+	}
+	tasks, err := taskRoot.CreateBucket([]byte(run.ID))
+	if err != nil {
+		return err
+	}
+	if err := deleteOrphanAttempts(tx, run); err != nil {
+		return err
+	}
+	for i, task := range run.Tasks {
+		if err := s.putTask(tasks, taskKey(i), task); err != nil {
+			return err
+		}
+		for _, attempt := range task.Attempts {
+			if err := s.putAttempt(tx, run.ID, task.ID, attempt); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// getRun reads a run record, reassembles its tasks and attempts, and
+// upgrades older schema versions in memory
+func getRun(tx *bolt.Tx, id string) (*Run, error) {
+	doc, err := getRunDoc(tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	run, err := decodeMigratedRun(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, task := range run.Tasks {
+		attempts, err := getAttempts(tx, id, task.ID)
+		if err != nil {
+			return nil, err
+		}
+		task.Attempts = attempts
+	}
+
+	return run, nil
+}
+
+// getRunDoc assembles the raw JSON document of a run from its record and
+// task records, as the JSON backend would store it
+func getRunDoc(tx *bolt.Tx, id string) ([]byte, error) {
+	data := tx.Bucket(bucketRuns).Get([]byte(id))
+	if data == nil {
+		return nil, fmt.Errorf("run %s not found", id)
+	}
+
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal run: %w", err)
+	}
+
+	tasks := []json.RawMessage{}
+	if b := tx.Bucket(bucketTasks).Bucket([]byte(id)); b != nil {
+		b.ForEach(func(k, v []byte) error {
+			tasks = append(tasks, append(json.RawMessage{}, v...))
+			return nil
+		})
+	}
+	encoded, err := json.Marshal(tasks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal tasks: %w", err)
+	}
+	doc["tasks"] = encoded
+
+	return json.Marshal(doc)
+}
+
+// runIsCurrent reports whether a stored run uses the current schema
+func runIsCurrent(tx *bolt.Tx, id string) bool {
+	var header struct {
+		SchemaVersion int `json:"schema_version"`
+	}
+	data := tx.Bucket(bucketRuns).Get([]byte(id))
+	return data != nil && json.Unmarshal(data, &header) == nil && header.SchemaVersion == CurrentSchemaVersion
+}
+
+// MigrateRuns upgrades every stored run to the current schema
+func (s *BoltStore) MigrateRuns(dryRun bool) ([]*MigrationReport, error) {
+	var reports []*MigrationReport
+	migrate := func(tx *bolt.Tx) error {
+		var ids []string
+		tx.Bucket(bucketRuns).ForEach(func(k, v []byte) error {
+			ids = append(ids, string(k))
+			return nil
+		})
+
+		for _, id := range ids {
+			doc, err := getRunDoc(tx, id)
+			var report *MigrationReport
+			if err == nil {
+				_, report, err = MigrateRunJSON(doc)
+			}
+			if report == nil {
+				report = &MigrationReport{RunID: id}
+			}
+			report.Err = err
+			reports = append(reports, report)
+
+			if err != nil || dryRun || !report.NeedsMigration() {
+				continue
+			}
+			run, err := getRun(tx, id)
+			if err == nil {
+				err = s.putRun(tx, run)
+			}
+			if err != nil {
+				report.Err = err
+			}
+		}
+		return nil
+	}
+
+	var err error
+	if dryRun {
+		err = s.view(migrate)
+	} else {
+		err = s.update(migrate)
+	}
+	return reports, err
+}
+
+// touchRun bumps a run's UpdatedAt without touching its tasks
+func (s *BoltStore) touchRun(tx *bolt.Tx, id string) error {
+	runs := tx.Bucket(bucketRuns)
+	data := runs.Get([]byte(id))
+	if data == nil {
+		return fmt.Errorf("run %s not found", id)
+	}
+
+	var run Run
+	if err := json.Unmarshal(data, &run); err != nil {
+		return fmt.Errorf("failed to unmarshal run: %w", err)
+	}
+	run.UpdatedAt = time.Now()
+
+	data, err := json.Marshal(&run)
+	if err != nil {
+		return fmt.Errorf("failed to marshal run: %w", err)
+	}
+	return runs.Put([]byte(id), redactState(s.redactor, data))
+}
+
+// putTask writes a task record; attempts are stored separately
+func (s *BoltStore) putTask(b *bolt.Bucket, key []byte, task *Task) error {
+	record := *task
+	record.Attempts = nil
+	data, err := json.Marshal(&record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal task: %w", err)
+	}
+	data = redactState(s.redactor, data)
+	return b.Put(key, data)
+}
+
+// putAttempt writes an attempt record
+func (s *BoltStore) putAttempt(tx *bolt.Tx, runID, taskID string, attempt *Attempt) error {
+	b, err := tx.Bucket(bucketAttempts).CreateBucketIfNotExists([]byte(runID))
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(attempt)
+	if err != nil {
+		return fmt.Errorf("failed to marshal attempt: %w", err)
+	}
+	data = redactState(s.redactor, data)
+	return b.Put(attemptKey(taskID, attempt.Number), data)
+}
+
+// deleteOrphanAttempts removes the attempts of tasks no longer in run
+func deleteOrphanAttempts(tx *bolt.Tx, run *Run) error {
+	b := tx.Bucket(bucketAttempts).Bucket([]byte(run.ID))
+	if b == nil {
+		return nil
+	}
+
+	keep := make(map[string]bool, len(run.Tasks))
+	for _, task := range run.Tasks {
+		keep[task.ID] = true
+	}
+	var orphans [][]byte
+	b.ForEach(func(k, _ []byte) error {
+		if taskID, _, _ := bytes.Cut(k, []byte("\x00")); !keep[string(taskID)] {
+			orphans = append(orphans, append([]byte{}, k...))
+		}
+		return nil
+	})
+	for _, k := range orphans {
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getAttempts reads a task's attempts in order
+func getAttempts(tx *bolt.Tx, runID, taskID string) ([]*Attempt, error) {
+	b := tx.Bucket(bucketAttempts).Bucket([]byte(runID))
+	if b == nil {
+		return nil, nil
+	}
+
+	var attempts []*Attempt
+	prefix := []byte(taskID + "\x00")
+	c := b.Cursor()
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		var attempt Attempt
+		if err := json.Unmarshal(v, &attempt); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal attempt: %w", err)
+		}
+		attempts = append(attempts, &attempt)
+	}
+	return attempts, nil
+}
+
+// putIndexes adds a run's secondary index entries
+func putIndexes(tx *bolt.Tx, run *Run) error {
+	for bucket, key := range indexKeys(run) {
+		if err := tx.Bucket([]byte(bucket)).Put(key, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteIndexes removes a run's secondary index entries
+func deleteIndexes(tx *bolt.Tx, run *Run) error {
+	for bucket, key := range indexKeys(run) {
+		if err := tx.Bucket([]byte(bucket)).Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexKeys returns the index entry for a run in each index bucket
+func indexKeys(run *Run) map[string][]byte {
+	keys := map[string][]byte{
+		string(bucketIdxStatus):  []byte(string(run.Status) + "\x00" + run.ID),
+		string(bucketIdxCreated): []byte(createdKey(run.CreatedAt) + "\x00" + run.ID),
+	}
+	if run.RepoPath != "" {
+		keys[string(bucketIdxRepo)] = []byte(run.RepoPath + "\x00" + run.ID)
+	}
+	return keys
+}
+
+// createdKey formats a timestamp so index keys sort chronologically
+func createdKey(t time.Time) string {
+	return t.UTC().Format("20060102150405.000000000")
+}
+
+// scanPrefix returns the run IDs of all index entries under prefix
+func scanPrefix(b *bolt.Bucket, prefix []byte) []string {
+	var ids []string
+	c := b.Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		ids = append(ids, string(k[len(prefix):]))
+	}
+	return ids
+}
+
+// scanCreated returns the run IDs created within [since, until)
+func scanCreated(b *bolt.Bucket, since, until time.Time) []string {
+	var ids []string
+	c := b.Cursor()
+
+	k, _ := c.First()
+	if !since.IsZero() {
+		k, _ = c.Seek([]byte(createdKey(since)))
+	}
+	var end []byte
+	if !until.IsZero() {
+		end = []byte(createdKey(until))
+	}
+
+	for ; k != nil; k, _ = c.Next() {
+		if end != nil && bytes.Compare(k, end) >= 0 {
+			break
+		}
+		if i := bytes.IndexByte(k, 0); i >= 0 {
+			ids = append(ids, string(k[i+1:]))
+		}
+	}
+	return ids
+}
+
+// taskKey orders tasks by their position in the run
+func taskKey(i int) []byte {
+	return []byte(fmt.Sprintf("%06d", i))
+}
+
+// attemptKey orders a task's attempts by number
+func attemptKey(taskID string, number int) []byte {
+	return []byte(fmt.Sprintf("%s\x00%06d", taskID, number))
+}
@@ -0,0 +1,238 @@
+package state
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gofrs/flock"
+	"github.com/howell-aikit/aiflow/internal/redact"
+)
+
+// Event types recorded in a run's journal
+const (
+	EventRunCreated        = "run.created"
+	EventRunResumed        = "run.resumed"
+	EventRunStatus         = "run.status"
+	EventRunSynced         = "run.synced"
+	EventRunRolledBack     = "run.rolled_back"
+	EventSparseNarrowed    = "run.sparse_narrowed"
+	EventSparseWidened     = "run.sparse_widened"
+	EventPlanningStarted   = "breakdown.started"
+	EventQuestionAsked     = "breakdown.question_asked"
+	EventQuestionAnswered  = "breakdown.question_answered"
+	EventBreakdownComplete = "breakdown.completed"
+	EventBreakdownApproved = "breakdown.approved"
+	EventTaskStarted       = "task.started"
+	EventTaskRequeued      = "task.requeued"
+	EventTaskBlocked       = "task.blocked"
+	EventLockAcquired      = "task.lock_acquired"
+	EventAgentFinished     = "task.agent_finished"
+	EventSummaryExtracted  = "task.summary_extracted"
+	EventCommitMade        = "task.commit_made"
+	EventTaskCompleted     = "task.completed"
+	EventTaskFailed        = "task.failed"
+	EventWIPSaved          = "task.wip_saved"
+	EventWIPResolved       = "task.wip_resolved"
+	EventTaskRerun         = "task.rerun"
+	EventRerunResolved     = "task.rerun_resolved"
+	EventCandidateScored   = "task.candidate_scored"
+	EventCandidateChosen   = "task.candidate_chosen"
+	EventFailureAction     = "failure.action"
+	EventCompletionAction  = "completion.action"
+	EventHistoryCurated    = "completion.history_curated"
+	EventPRCreated         = "completion.pr_created"
+	EventMerged            = "completion.merged"
+)
+
+// Journal is the append-only JSONL event log kept next to each run in the
+// state directory, independent of the state backend. Every line is one
+// Event; sequence numbers are assigned under a file lock so several
+// processes can append to the same run.
+type Journal struct {
+	dir      string
+	redactor *redact.Redactor
+	mu       sync.Mutex
+}
+
+// NewJournal creates a journal rooted in stateDir
+func NewJournal(stateDir string) *Journal {
+	return &Journal{dir: filepath.Join(stateDir, "runs")}
+}
+
+// Path returns the journal file for a run
+func (j *Journal) Path(runID string) string {
+	return filepath.Join(j.dir, runID+".events.jsonl")
+}
+
+// lockPath returns the lock guarding appends to a run's journal
+func (j *Journal) lockPath(runID string) string {
+	return filepath.Join(j.dir, runID+".events.lock")
+}
+
+// Append writes an event to the run's journal, assigning its sequence
+// number and timestamp
+func (j *Journal) Append(runID string, event *Event) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if err := os.MkdirAll(j.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create journal directory: %w", err)
+	}
+
+	lock := flock.New(j.lockPath(runID))
+	if err := lock.Lock(); err != nil {
+		return fmt.Errorf("failed to lock event log: %w", err)
+	}
+	defer lock.Unlock()
+
+	// Number after the last event on disk, which another process may
+	// have written
+	last, err := j.lastSeq(runID)
+	if err != nil {
+		return err
+	}
+	event.Seq = last + 1
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+	data = redactState(j.redactor, data)
+
+	f, err := os.OpenFile(j.Path(runID), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open event log: %w", err)
+	}
+	defer f.Close()
+
+	// Start a new line after a torn one so this event stays readable
+	if info, err := f.Stat(); err == nil && info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, info.Size()-1); err == nil && last[0] != '\n' {
+			data = append([]byte{'\n'}, data...)
+		}
+	}
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write event: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync event log: %w", err)
+	}
+
+	return nil
+}
+
+// Read returns all events recorded for a run in order. A torn final line
+// from a crash mid-append is ignored.
+func (j *Journal) Read(runID string) ([]*Event, error) {
+	f, err := os.Open(j.Path(runID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open event log: %w", err)
+	}
+	defer f.Close()
+
+	var events []*Event
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			continue
+		}
+		events = append(events, &event)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read event log: %w", err)
+	}
+
+	return events, nil
+}
+
+// journalTailChunk is how much of the end of a journal lastSeq reads at a
+// time while looking for the last complete event
+const journalTailChunk = 4096
+
+// lastSeq returns the sequence number of the last event in a run's journal,
+// or 0 if there is none. Only the tail of the file is read, so appending
+// stays cheap however long the journal grows.
+func (j *Journal) lastSeq(runID string) (int64, error) {
+	f, err := os.Open(j.Path(runID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to open event log: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read event log: %w", err)
+	}
+
+	// Read backwards until a complete line parses; a torn final line from
+	// a crash mid-append is skipped like Read does
+	var tail []byte
+	for end := info.Size(); end > 0; {
+		start := max(end-journalTailChunk, 0)
+		chunk := make([]byte, end-start)
+		if _, err := f.ReadAt(chunk, start); err != nil {
+			return 0, fmt.Errorf("failed to read event log: %w", err)
+		}
+		tail = append(chunk, tail...)
+		end = start
+
+		lines := bytes.Split(tail, []byte("\n"))
+		for i := len(lines) - 1; i >= 0; i-- {
+			// The first line may be cut off until the start of the file
+			if i == 0 && start > 0 {
+				tail = lines[0]
+				break
+			}
+			var event Event
+			if json.Unmarshal(lines[i], &event) == nil {
+				return event.Seq, nil
+			}
+		}
+	}
+	return 0, nil
+}
+
+// RunDataDir returns the directory holding a run's transcripts and other
+// per-run artifacts
+func RunDataDir(stateDir, runID string) string {
+	return filepath.Join(stateDir, "runs", runID)
+}
+
+// Remove deletes a run's journal
+func (j *Journal) Remove(runID string) {
+	os.Remove(j.Path(runID))
+	os.Remove(j.lockPath(runID))
+}
+
+// RecordEvent appends an event of the given type to a run's journal.
+// data holds optional key/value details.
+func RecordEvent(s Store, runID, eventType, taskID, message string, data map[string]string) error {
+	if s == nil || runID == "" {
+		return nil
+	}
+	return s.AppendEvent(runID, &Event{
+		Type:    eventType,
+		TaskID:  taskID,
+		Message: message,
+		Data:    data,
+	})
+}
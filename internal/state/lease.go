@@ -0,0 +1,260 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gofrs/flock"
+)
+
+// RunStatusCrashed is reported, never stored, for a run that claims to be
+// active but whose owning process is gone
+const RunStatusCrashed RunStatus = "crashed"
+
+// LeaseHeartbeat is how often the owning process refreshes its lease
+const LeaseHeartbeat = 10 * time.Second
+
+// LeaseTTL is how long a lease stays valid without a heartbeat. Owners on
+// other hosts can only be judged by their heartbeat.
+const LeaseTTL = 6 * LeaseHeartbeat
+
+// ErrRunOwned is returned when another live process owns a run
+var ErrRunOwned = errors.New("run is owned by another live process")
+
+// Owner identifies the process executing a run and is written into the
+// run's lease file
+type Owner struct {
+	PID         int       `json:"pid"`
+	Hostname    string    `json:"hostname"`
+	AcquiredAt  time.Time `json:"acquired_at"`
+	HeartbeatAt time.Time `json:"heartbeat_at"`
+}
+
+// Live reports whether the owner still holds the run: its heartbeat is
+// fresh and, on this host, its process still exists
+func (o *Owner) Live() bool {
+	if o == nil || time.Since(o.HeartbeatAt) > LeaseTTL {
+		return false
+	}
+	hostname, _ := os.Hostname()
+	if o.Hostname != hostname {
+		return true
+	}
+	return processAlive(o.PID)
+}
+
+// String describes the owner for messages
+func (o *Owner) String() string {
+	return fmt.Sprintf("pid %d on %s, last heartbeat %s ago",
+		o.PID, o.Hostname, time.Since(o.HeartbeatAt).Round(time.Second))
+}
+
+// isSelf reports whether the owner is this process
+func (o *Owner) isSelf() bool {
+	hostname, _ := os.Hostname()
+	return o.PID == os.Getpid() && o.Hostname == hostname
+}
+
+// Lease is this process's ownership of a run. It lives in the state
+// directory next to the run, independent of the state backend, and is kept
+// fresh by a background heartbeat until released.
+type Lease struct {
+	stateDir string
+	runID    string
+	owner    Owner
+	stop     chan struct{}
+	done     chan struct{}
+	once     sync.Once
+}
+
+// leasePath returns the lease file for a run
+func leasePath(stateDir, runID string) string {
+	return filepath.Join(stateDir, "runs", runID+".owner")
+}
+
+// leaseLockPath returns the lock guarding changes to a run's lease
+func leaseLockPath(stateDir, runID string) string {
+	return filepath.Join(stateDir, "runs", runID+".owner.lock")
+}
+
+// ReadOwner returns the recorded owner of a run, or nil if it has none
+func ReadOwner(stateDir, runID string) (*Owner, error) {
+	data, err := os.ReadFile(leasePath(stateDir, runID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read run lease: %w", err)
+	}
+
+	var owner Owner
+	if err := json.Unmarshal(data, &owner); err != nil {
+		// A torn lease cannot belong to a healthy owner
+		return nil, nil
+	}
+	return &owner, nil
+}
+
+// AcquireLease makes this process the owner of a run. It fails with
+// ErrRunOwned if another live process owns it; a stale owner is taken over
+// and returned so the caller can report it.
+func AcquireLease(stateDir, runID string) (*Lease, *Owner, error) {
+	var previous *Owner
+	hostname, _ := os.Hostname()
+	now := time.Now()
+	l := &Lease{
+		stateDir: stateDir,
+		runID:    runID,
+		owner: Owner{
+			PID:         os.Getpid(),
+			Hostname:    hostname,
+			AcquiredAt:  now,
+			HeartbeatAt: now,
+		},
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+
+	err := withLeaseLock(stateDir, runID, func() error {
+		current, err := ReadOwner(stateDir, runID)
+		if err != nil {
+			return err
+		}
+		if current != nil && !current.isSelf() {
+			if current.Live() {
+				return fmt.Errorf("%w: %s", ErrRunOwned, current)
+			}
+			previous = current
+		}
+		return l.write()
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	go l.heartbeat()
+	return l, previous, nil
+}
+
+// Release stops the heartbeat and gives up ownership of the run
+func (l *Lease) Release() error {
+	l.once.Do(func() { close(l.stop) })
+	<-l.done
+
+	return withLeaseLock(l.stateDir, l.runID, func() error {
+		current, err := ReadOwner(l.stateDir, l.runID)
+		if err != nil || current == nil || !current.isSelf() {
+			return err
+		}
+		if err := os.Remove(leasePath(l.stateDir, l.runID)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove run lease: %w", err)
+		}
+		return nil
+	})
+}
+
+// heartbeat refreshes the lease until it is released or lost to another
+// process that judged it stale
+func (l *Lease) heartbeat() {
+	defer close(l.done)
+
+	ticker := time.NewTicker(LeaseHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			// A failed refresh is retried on the next tick; the TTL allows
+			// for several misses
+			lost := false
+			withLeaseLock(l.stateDir, l.runID, func() error {
+				current, err := ReadOwner(l.stateDir, l.runID)
+				if err != nil {
+					return err
+				}
+				if current != nil && !current.isSelf() {
+					lost = true
+					return nil
+				}
+				l.owner.HeartbeatAt = time.Now()
+				return l.write()
+			})
+			if lost {
+				return
+			}
+		}
+	}
+}
+
+// write stores the lease file; callers hold the lease lock
+func (l *Lease) write() error {
+	data, err := json.Marshal(l.owner)
+	if err != nil {
+		return fmt.Errorf("failed to marshal run lease: %w", err)
+	}
+	if err := writeFileAtomic(leasePath(l.stateDir, l.runID), data, false); err != nil {
+		return fmt.Errorf("failed to write run lease: %w", err)
+	}
+	return nil
+}
+
+// RemoveLease deletes a run's lease files
+func RemoveLease(stateDir, runID string) {
+	os.Remove(leasePath(stateDir, runID))
+	os.Remove(leaseLockPath(stateDir, runID))
+}
+
+// EffectiveStatus returns the run's status, or RunStatusCrashed if the run
+// claims to be active but the process holding its lease is gone. A run
+// without a lease was never started under one or released it on exit, so
+// it is taken at its word.
+func EffectiveStatus(stateDir string, run *Run) RunStatus {
+	if run.Status != RunStatusRunning && run.Status != RunStatusBreakdown {
+		return run.Status
+	}
+	owner, err := ReadOwner(stateDir, run.ID)
+	if err != nil || owner == nil {
+		return run.Status
+	}
+	if !owner.Live() {
+		return RunStatusCrashed
+	}
+	return run.Status
+}
+
+// withLeaseLock runs fn while holding the run's lease lock
+func withLeaseLock(stateDir, runID string, fn func() error) error {
+	if err := os.MkdirAll(filepath.Join(stateDir, "runs"), 0755); err != nil {
+		return fmt.Errorf("failed to create runs directory: %w", err)
+	}
+
+	lock := flock.New(leaseLockPath(stateDir, runID))
+	if err := lock.Lock(); err != nil {
+		return fmt.Errorf("failed to lock run lease: %w", err)
+	}
+	defer lock.Unlock()
+
+	return fn()
+}
+
+// processAlive reports whether a process with the given PID exists on this
+// host
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = p.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,247 @@
+package state
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/howell-aikit/aiflow/internal/worktree"
+	aigit "github.com/howell-aikit/aiflow/pkg/git"
+)
+
+// Migration upgrades a persisted run document to Version. Migrations work
+// on the raw JSON document so they can handle renamed or reshaped fields
+// that no longer exist on Run.
+type Migration struct {
+	Version     int
+	Description string
+	Apply       func(doc map[string]interface{}) error
+}
+
+// migrations is the registry of schema upgrades, in version order. Append
+// new migrations here; CurrentSchemaVersion follows automatically.
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "add schema_version, normalize tasks, backfill repo_path",
+		Apply:       migrateV1,
+	},
+}
+
+// CurrentSchemaVersion is the run schema written by this version of aiflow
+var CurrentSchemaVersion = migrations[len(migrations)-1].Version
+
+// ErrSchemaTooNew is returned for runs written by a newer aiflow
+var ErrSchemaTooNew = errors.New("run schema is newer than this aiflow supports")
+
+// MigrationReport describes the upgrade of one run document
+type MigrationReport struct {
+	RunID       string
+	FromVersion int
+	ToVersion   int
+	Applied     []string // Descriptions of the migrations that ran
+	Changes     []string // Field-level differences
+	Err         error
+}
+
+// NeedsMigration reports whether the document was upgraded
+func (r *MigrationReport) NeedsMigration() bool {
+	return r.FromVersion != r.ToVersion
+}
+
+// MigrateRunJSON upgrades a run document to CurrentSchemaVersion. Current
+// documents are returned unchanged.
+func MigrateRunJSON(data []byte) ([]byte, *MigrationReport, error) {
+	doc, err := decodeDoc(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to unmarshal run: %w", err)
+	}
+
+	report := &MigrationReport{RunID: stringField(doc, "id")}
+	version, err := schemaVersion(doc)
+	if err != nil {
+		return nil, report, err
+	}
+	report.FromVersion, report.ToVersion = version, version
+
+	if version > CurrentSchemaVersion {
+		return nil, report, fmt.Errorf("%w: run %s has version %d, this aiflow supports up to %d; update aiflow",
+			ErrSchemaTooNew, report.RunID, version, CurrentSchemaVersion)
+	}
+	if version == CurrentSchemaVersion {
+		return data, report, nil
+	}
+
+	original, _ := decodeDoc(data)
+	for _, m := range migrations {
+		if m.Version <= version {
+			continue
+		}
+		if err := m.Apply(doc); err != nil {
+			return nil, report, fmt.Errorf("migration to schema version %d failed: %w", m.Version, err)
+		}
+		doc["schema_version"] = json.Number(fmt.Sprint(m.Version))
+		report.ToVersion = m.Version
+		report.Applied = append(report.Applied, fmt.Sprintf("v%d: %s", m.Version, m.Description))
+	}
+	report.Changes = diffValues("", original, doc)
+
+	out, err := json.Marshal(doc)
+	if err != nil {
+		return nil, report, fmt.Errorf("failed to marshal migrated run: %w", err)
+	}
+	return out, report, nil
+}
+
+// decodeMigratedRun migrates a run document and decodes it
+func decodeMigratedRun(data []byte) (*Run, error) {
+	migrated, _, err := MigrateRunJSON(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var run Run
+	if err := json.Unmarshal(migrated, &run); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal run: %w", err)
+	}
+	return &run, nil
+}
+
+// migrateV1 brings pre-versioning runs to the first versioned schema
+func migrateV1(doc map[string]interface{}) error {
+	// Early runs could be saved with "tasks": null
+	if tasks, ok := doc["tasks"].([]interface{}); !ok || tasks == nil {
+		doc["tasks"] = []interface{}{}
+	}
+
+	// repo_path was added later; derive it from where the worktree lives so
+	// these runs show up in repository queries
+	if stringField(doc, "repo_path") == "" {
+		if repo := guessRepoPath(stringField(doc, "worktree_path")); repo != "" {
+			doc["repo_path"] = repo
+		}
+	}
+
+	return nil
+}
+
+// guessRepoPath returns the repository a worktree was created from, as
+// worktree.SourceRepo finds it. Worktrees that are gone or no longer a git
+// working tree give no answer.
+func guessRepoPath(worktreePath string) string {
+	if worktreePath == "" || !aigit.IsGitRepo(worktreePath) {
+		return ""
+	}
+	repo, err := worktree.SourceRepo(worktreePath)
+	if err != nil {
+		return ""
+	}
+	return repo
+}
+
+// decodeDoc parses a JSON object keeping numbers exact
+func decodeDoc(data []byte) (map[string]interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc map[string]interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	if doc == nil {
+		return nil, fmt.Errorf("run document is not an object")
+	}
+	return doc, nil
+}
+
+// schemaVersion reads schema_version, treating a missing field as 0
+func schemaVersion(doc map[string]interface{}) (int, error) {
+	v, ok := doc["schema_version"]
+	if !ok || v == nil {
+		return 0, nil
+	}
+	n, ok := v.(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("invalid schema_version %v", v)
+	}
+	i, err := n.Int64()
+	if err != nil {
+		return 0, fmt.Errorf("invalid schema_version %v", v)
+	}
+	return int(i), nil
+}
+
+// stringField returns a string field of doc, or ""
+func stringField(doc map[string]interface{}, key string) string {
+	s, _ := doc[key].(string)
+	return s
+}
+
+// diffValues lists the differences between two decoded JSON values
+func diffValues(path string, before, after interface{}) []string {
+	beforeMap, okBefore := before.(map[string]interface{})
+	afterMap, okAfter := after.(map[string]interface{})
+	if okBefore && okAfter {
+		keys := make(map[string]bool)
+		for k := range beforeMap {
+			keys[k] = true
+		}
+		for k := range afterMap {
+			keys[k] = true
+		}
+		sorted := make([]string, 0, len(keys))
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+
+		var changes []string
+		for _, k := range sorted {
+			b, inBefore := beforeMap[k]
+			a, inAfter := afterMap[k]
+			child := k
+			if path != "" {
+				child = path + "." + k
+			}
+			switch {
+			case !inBefore:
+				changes = append(changes, fmt.Sprintf("%s: (unset) -> %s", child, renderValue(a)))
+			case !inAfter:
+				changes = append(changes, fmt.Sprintf("%s: %s -> (removed)", child, renderValue(b)))
+			default:
+				changes = append(changes, diffValues(child, b, a)...)
+			}
+		}
+		return changes
+	}
+
+	beforeList, okBefore := before.([]interface{})
+	afterList, okAfter := after.([]interface{})
+	if okBefore && okAfter && len(beforeList) == len(afterList) {
+		var changes []string
+		for i := range beforeList {
+			changes = append(changes, diffValues(fmt.Sprintf("%s[%d]", path, i), beforeList[i], afterList[i])...)
+		}
+		return changes
+	}
+
+	if renderValue(before) == renderValue(after) {
+		return nil
+	}
+	return []string{fmt.Sprintf("%s: %s -> %s", path, renderValue(before), renderValue(after))}
+}
+
+// renderValue formats a JSON value for a change listing
+func renderValue(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	s := string(data)
+	if len(s) > 80 {
+		s = s[:77] + "..."
+	}
+	return strings.ReplaceAll(s, "\n", " ")
+}
@@ -2,41 +2,49 @@ package state
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/gofrs/flock"
 	"github.com/google/uuid"
+	"github.com/howell-aikit/aiflow/internal/redact"
 )
 
-// Store handles persistence of run state
-type Store struct {
+// FileStore keeps each run in its own JSON file. Writes are serialized per
+// process with a mutex and across processes with a per-run file lock, and
+// every file is replaced atomically so a crash never leaves a half-written
+// run behind.
+type FileStore struct {
 	stateDir string
+	journal  *Journal
+	redactor *redact.Redactor
+	mu       sync.Mutex
 }
 
-// NewStore creates a new state store
-func NewStore(stateDir string) (*Store, error) {
+// NewFileStore creates a JSON file backed state store
+func NewFileStore(stateDir string) (*FileStore, error) {
 	runsDir := filepath.Join(stateDir, "runs")
 	if err := os.MkdirAll(runsDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create state directory: %w", err)
 	}
-	return &Store{stateDir: stateDir}, nil
+	return &FileStore{stateDir: stateDir, journal: NewJournal(stateDir)}, nil
+}
+
+// Close releases store resources
+func (s *FileStore) Close() error {
+	return nil
 }
 
 // CreateRun creates a new run and persists it
-func (s *Store) CreateRun(featureDesc, worktreePath, baseBranch string) (*Run, error) {
-	run := &Run{
-		ID:           uuid.New().String()[:8],
-		FeatureDesc:  featureDesc,
-		WorktreePath: worktreePath,
-		BaseBranch:   baseBranch,
-		Tasks:        []*Task{},
-		CreatedAt:    time.Now(),
-		UpdatedAt:    time.Now(),
-		Status:       RunStatusBreakdown,
-	}
+func (s *FileStore) CreateRun(featureDesc, worktreePath, baseBranch string) (*Run, error) {
+	run := newRun(uuid.New().String()[:8], featureDesc, worktreePath, baseBranch)
 
 	if err := s.SaveRun(run); err != nil {
 		return nil, err
@@ -50,47 +58,137 @@ func (s *Store) CreateRun(featureDesc, worktreePath, baseBranch string) (*Run, e
 }
 
 // SaveRun persists a run to disk
-func (s *Store) SaveRun(run *Run) error {
+func (s *FileStore) SaveRun(run *Run) error {
+	return s.withRunLock(run.ID, func() error {
+		return s.saveRunLocked(run)
+	})
+}
+
+// saveRunLocked writes a run (caller must hold the run lock)
+func (s *FileStore) saveRunLocked(run *Run) error {
 	run.UpdatedAt = time.Now()
 
 	data, err := json.MarshalIndent(run, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal run: %w", err)
 	}
+	data = redactState(s.redactor, data)
 
 	runPath := s.runPath(run.ID)
-	if err := os.WriteFile(runPath, data, 0644); err != nil {
+	if err := writeFileAtomic(runPath, data, true); err != nil {
 		return fmt.Errorf("failed to write run file: %w", err)
 	}
 
 	return nil
 }
 
-// LoadRun loads a run from disk
-func (s *Store) LoadRun(id string) (*Run, error) {
+// LoadRun loads a run from disk. If the run file is unreadable, the backup
+// of the previous version is used and restored in its place.
+func (s *FileStore) LoadRun(id string) (*Run, error) {
 	runPath := s.runPath(id)
-	data, err := os.ReadFile(runPath)
+	run, err := readRunFile(runPath)
+	if err == nil {
+		return run, nil
+	}
+	if errors.Is(err, ErrSchemaTooNew) {
+		return nil, err
+	}
+	if os.IsNotExist(err) {
+		if _, bakErr := os.Stat(backupPath(runPath)); bakErr != nil {
+			return nil, fmt.Errorf("run %s not found", id)
+		}
+	}
+
+	// Fall back to the previous version
+	backup, bakErr := readRunFile(backupPath(runPath))
+	if bakErr != nil {
+		return nil, fmt.Errorf("failed to load run %s: %w", id, err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Warning: run %s was unreadable (%v); recovered previous version from backup\n", id, err)
+	// Restoring is a single atomic rename, so this is safe even while
+	// another writer holds the run lock
+	if data, err := os.ReadFile(backupPath(runPath)); err == nil {
+		writeFileAtomic(runPath, data, false)
+	}
+
+	return backup, nil
+}
+
+// readRunFile reads and parses a single run file, upgrading older schema
+// versions in memory
+func readRunFile(path string) (*Run, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeMigratedRun(data)
+}
+
+// MigrateRuns upgrades every run file to the current schema. The previous
+// version of each rewritten file is kept as its backup.
+func (s *FileStore) MigrateRuns(dryRun bool) ([]*MigrationReport, error) {
+	entries, err := os.ReadDir(filepath.Join(s.stateDir, "runs"))
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil, fmt.Errorf("run %s not found", id)
+			return nil, nil
 		}
-		return nil, fmt.Errorf("failed to read run file: %w", err)
+		return nil, fmt.Errorf("failed to read runs directory: %w", err)
 	}
 
-	var run Run
-	if err := json.Unmarshal(data, &run); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal run: %w", err)
+	var reports []*MigrationReport
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		id := strings.TrimSuffix(entry.Name(), ".json")
+
+		var report *MigrationReport
+		err := s.withRunLock(id, func() error {
+			data, err := os.ReadFile(s.runPath(id))
+			if err != nil {
+				return err
+			}
+
+			var migrated []byte
+			migrated, report, err = MigrateRunJSON(data)
+			if err != nil || dryRun || !report.NeedsMigration() {
+				return err
+			}
+
+			// Re-encode through Run so the file keeps its usual layout
+			var run Run
+			if err := json.Unmarshal(migrated, &run); err != nil {
+				return fmt.Errorf("failed to unmarshal migrated run: %w", err)
+			}
+			out, err := json.MarshalIndent(&run, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to marshal run: %w", err)
+			}
+			return writeFileAtomic(s.runPath(id), redactState(s.redactor, out), true)
+		})
+		if report == nil {
+			report = &MigrationReport{RunID: id}
+		}
+		report.Err = err
+		reports = append(reports, report)
 	}
 
-	return &run, nil
+	return reports, nil
 }
 
 // DeleteRun removes a run from disk
-func (s *Store) DeleteRun(id string) error {
+func (s *FileStore) DeleteRun(id string) error {
 	runPath := s.runPath(id)
 	if err := os.Remove(runPath); err != nil && !os.IsNotExist(err) {
 		return fmt.Errorf("failed to delete run file: %w", err)
 	}
+	os.Remove(backupPath(runPath))
+	os.Remove(s.lockPath(id))
+	s.journal.Remove(id)
+	RemoveLease(s.stateDir, id)
+	os.RemoveAll(RunDataDir(s.stateDir, id))
 
 	// Clear current if this was the current run
 	currentID, _ := s.GetCurrentRunID()
@@ -102,7 +200,7 @@ func (s *Store) DeleteRun(id string) error {
 }
 
 // ListRuns returns all runs sorted by creation time (newest first)
-func (s *Store) ListRuns() ([]*Run, error) {
+func (s *FileStore) ListRuns() ([]*Run, error) {
 	runsDir := filepath.Join(s.stateDir, "runs")
 	entries, err := os.ReadDir(runsDir)
 	if err != nil {
@@ -121,7 +219,8 @@ func (s *Store) ListRuns() ([]*Run, error) {
 		id := entry.Name()[:len(entry.Name())-5] // Remove .json
 		run, err := s.LoadRun(id)
 		if err != nil {
-			continue // Skip corrupted files
+			fmt.Fprintf(os.Stderr, "Warning: skipping unreadable run %s: %v\n", id, err)
+			continue
 		}
 		runs = append(runs, run)
 	}
@@ -134,18 +233,37 @@ func (s *Store) ListRuns() ([]*Run, error) {
 	return runs, nil
 }
 
+// QueryRuns returns runs matching q, newest first
+func (s *FileStore) QueryRuns(q RunQuery) ([]*Run, error) {
+	runs, err := s.ListRuns()
+	if err != nil {
+		return nil, err
+	}
+
+	var matched []*Run
+	for _, run := range runs {
+		if q.Matches(run) {
+			matched = append(matched, run)
+		}
+	}
+	return q.sortAndLimit(matched), nil
+}
+
 // SetCurrentRun sets the current active run
-func (s *Store) SetCurrentRun(id string) error {
+func (s *FileStore) SetCurrentRun(id string) error {
 	currentPath := filepath.Join(s.stateDir, "current.json")
 	data, err := json.Marshal(map[string]string{"run_id": id})
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(currentPath, data, 0644)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return writeFileAtomic(currentPath, data, false)
 }
 
 // GetCurrentRunID returns the ID of the current run
-func (s *Store) GetCurrentRunID() (string, error) {
+func (s *FileStore) GetCurrentRunID() (string, error) {
 	currentPath := filepath.Join(s.stateDir, "current.json")
 	data, err := os.ReadFile(currentPath)
 	if err != nil {
@@ -164,7 +282,7 @@ func (s *Store) GetCurrentRunID() (string, error) {
 }
 
 // GetCurrentRun returns the current active run
-func (s *Store) GetCurrentRun() (*Run, error) {
+func (s *FileStore) GetCurrentRun() (*Run, error) {
 	id, err := s.GetCurrentRunID()
 	if err != nil {
 		return nil, err
@@ -176,70 +294,220 @@ func (s *Store) GetCurrentRun() (*Run, error) {
 }
 
 // ClearCurrentRun clears the current run pointer
-func (s *Store) ClearCurrentRun() error {
+func (s *FileStore) ClearCurrentRun() error {
 	currentPath := filepath.Join(s.stateDir, "current.json")
 	return os.Remove(currentPath)
 }
 
 // runPath returns the file path for a run
-func (s *Store) runPath(id string) string {
+func (s *FileStore) runPath(id string) string {
 	return filepath.Join(s.stateDir, "runs", id+".json")
 }
 
-// AddTask adds a task to a run
-func (s *Store) AddTask(runID string, task *Task) error {
-	run, err := s.LoadRun(runID)
+// lockPath returns the cross-process lock file path for a run
+func (s *FileStore) lockPath(id string) string {
+	return filepath.Join(s.stateDir, "runs", id+".lock")
+}
+
+// backupPath returns where the previous version of a file is kept
+func backupPath(path string) string {
+	return path + ".bak"
+}
+
+// withRunLock runs fn while holding both the in-process mutex and the
+// cross-process lock for a run
+func (s *FileStore) withRunLock(id string, fn func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lock := flock.New(s.lockPath(id))
+	if err := lock.Lock(); err != nil {
+		return fmt.Errorf("failed to lock run %s: %w", id, err)
+	}
+	defer lock.Unlock()
+
+	return fn()
+}
+
+// writeFileAtomic replaces path with data via a synced temp file and a
+// rename. With keepBackup, the previous contents stay available as a backup.
+func writeFileAtomic(path string, data []byte, keepBackup bool) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
 	if err != nil {
 		return err
 	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath) // No-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpPath, 0644); err != nil {
+		return err
+	}
 
-	run.Tasks = append(run.Tasks, task)
-	return s.SaveRun(run)
+	if keepBackup {
+		if err := backupFile(path); err != nil {
+			return fmt.Errorf("failed to back up %s: %w", filepath.Base(path), err)
+		}
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+
+	return syncDir(dir)
 }
 
-// UpdateTask updates a task within a run
-func (s *Store) UpdateTask(runID, taskID string, updateFn func(*Task)) error {
-	run, err := s.LoadRun(runID)
+// backupFile preserves the current contents of path before it is replaced.
+// A hard link is used when possible since the old inode is about to be
+// unlinked by the rename anyway.
+func backupFile(path string) error {
+	if _, err := readRunFile(path); err != nil {
+		// Never let a corrupt file overwrite a good backup
+		return nil
+	}
+
+	bak := backupPath(path)
+	os.Remove(bak)
+	if err := os.Link(path, bak); err == nil {
+		return nil
+	}
+
+	src, err := os.Open(path)
 	if err != nil {
 		return err
 	}
+	defer src.Close()
 
-	task := run.GetTask(taskID)
-	if task == nil {
-		return fmt.Errorf("task %s not found in run %s", taskID, runID)
+	dst, err := os.Create(bak)
+	if err != nil {
+		return err
 	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Sync(); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// syncDir flushes directory entries so a rename survives a crash
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
 
-	updateFn(task)
-	return s.SaveRun(run)
+	// Some filesystems do not support syncing directories
+	d.Sync()
+	return nil
+}
+
+// UpdateRun loads a run, applies updateFn and saves it, all under the run
+// lock so concurrent updates are never lost
+func (s *FileStore) UpdateRun(runID string, updateFn func(*Run) error) error {
+	return s.withRunLock(runID, func() error {
+		run, err := s.LoadRun(runID)
+		if err != nil {
+			return err
+		}
+
+		if err := updateFn(run); err != nil {
+			return err
+		}
+		return s.saveRunLocked(run)
+	})
+}
+
+// AddTask adds a task to a run
+func (s *FileStore) AddTask(runID string, task *Task) error {
+	return s.UpdateRun(runID, func(run *Run) error {
+		run.Tasks = append(run.Tasks, task)
+		return nil
+	})
+}
+
+// UpdateTask updates a task within a run
+func (s *FileStore) UpdateTask(runID, taskID string, updateFn func(*Task)) error {
+	return s.UpdateRun(runID, func(run *Run) error {
+		task := run.GetTask(taskID)
+		if task == nil {
+			return fmt.Errorf("task %s not found in run %s", taskID, runID)
+		}
+
+		updateFn(task)
+		return nil
+	})
 }
 
 // SetTaskStatus updates a task's status
-func (s *Store) SetTaskStatus(runID, taskID string, status TaskStatus) error {
+func (s *FileStore) SetTaskStatus(runID, taskID string, status TaskStatus) error {
 	return s.UpdateTask(runID, taskID, func(t *Task) {
-		t.Status = status
-		now := time.Now()
-		switch status {
-		case TaskStatusRunning:
-			t.StartedAt = &now
-		case TaskStatusCompleted, TaskStatusFailed:
-			t.CompletedAt = &now
-		}
+		applyTaskStatus(t, status)
 	})
 }
 
 // SetTaskSummary sets the summary for a completed task
-func (s *Store) SetTaskSummary(runID, taskID string, summary *TaskSummary) error {
+func (s *FileStore) SetTaskSummary(runID, taskID string, summary *TaskSummary) error {
 	return s.UpdateTask(runID, taskID, func(t *Task) {
 		t.Summary = summary
 	})
 }
 
 // SetTaskError sets an error message for a failed task
-func (s *Store) SetTaskError(runID, taskID, errMsg string) error {
+func (s *FileStore) SetTaskError(runID, taskID, errMsg string) error {
 	return s.UpdateTask(runID, taskID, func(t *Task) {
-		t.Error = errMsg
-		t.Status = TaskStatusFailed
-		now := time.Now()
-		t.CompletedAt = &now
+		applyTaskError(t, errMsg)
 	})
 }
+
+// RecordAttempt adds or replaces an attempt (matched by number) on a task
+func (s *FileStore) RecordAttempt(runID, taskID string, attempt *Attempt) error {
+	return s.UpdateTask(runID, taskID, func(t *Task) {
+		for i, a := range t.Attempts {
+			if a.Number == attempt.Number {
+				t.Attempts[i] = attempt
+				return
+			}
+		}
+		t.Attempts = append(t.Attempts, attempt)
+	})
+}
+
+// ListAttempts returns a task's attempts in order
+func (s *FileStore) ListAttempts(runID, taskID string) ([]*Attempt, error) {
+	run, err := s.LoadRun(runID)
+	if err != nil {
+		return nil, err
+	}
+
+	task := run.GetTask(taskID)
+	if task == nil {
+		return nil, fmt.Errorf("task %s not found in run %s", taskID, runID)
+	}
+	return task.Attempts, nil
+}
+
+// AppendEvent appends an event to the run's journal
+func (s *FileStore) AppendEvent(runID string, event *Event) error {
+	return s.journal.Append(runID, event)
+}
+
+// ListEvents returns all events recorded for a run in order
+func (s *FileStore) ListEvents(runID string) ([]*Event, error) {
+	return s.journal.Read(runID)
+}
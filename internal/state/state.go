@@ -40,17 +40,22 @@ type Task struct {
 	DependsOn     []string     `json:"depends_on"`
 	Priority      int          `json:"priority"`
 	ParallelGroup string       `json:"parallel_group,omitempty"` // Tasks in same group can run in parallel
+	BestOf        int          `json:"best_of,omitempty"`        // Independent attempts to keep the best of
 	Status        TaskStatus   `json:"status"`
 	Summary       *TaskSummary `json:"summary,omitempty"`
 	Error         string       `json:"error,omitempty"`
-	CommitSHA     string       `json:"commit_sha,omitempty"` // Git commit SHA after task completion
+	BaseSHA       string       `json:"base_sha,omitempty"`     // HEAD when the task last started; rollback target
+	CommitSHA     string       `json:"commit_sha,omitempty"`   // Git commit SHA after task completion
+	LockWaitMS    int64        `json:"lock_wait_ms,omitempty"` // Total time spent waiting for file locks
+	WIPRef        string       `json:"wip_ref,omitempty"`      // Snapshot of work left by an interrupted attempt
+	Attempts      []*Attempt   `json:"attempts,omitempty"`
 	StartedAt     *time.Time   `json:"started_at,omitempty"`
 	CompletedAt   *time.Time   `json:"completed_at,omitempty"`
 }
 
 // IsReady returns true if the task can be executed
 func (t *Task) IsReady(completedTasks map[string]bool) bool {
-	if t.Status != TaskStatusPending {
+	if t.Status != TaskStatusPending && t.Status != TaskStatusReady {
 		return false
 	}
 	for _, dep := range t.DependsOn {
@@ -61,6 +66,11 @@ func (t *Task) IsReady(completedTasks map[string]bool) bool {
 	return true
 }
 
+// LockWait returns the total time the task has spent waiting for file locks
+func (t *Task) LockWait() time.Duration {
+	return time.Duration(t.LockWaitMS) * time.Millisecond
+}
+
 // SpecQuestionOption represents an option for a spec question
 type SpecQuestionOption struct {
 	Label       string `json:"label"`
@@ -90,10 +100,17 @@ type SpecConversation struct {
 
 // Run represents a complete feature implementation run
 type Run struct {
+	SchemaVersion    int               `json:"schema_version"`
 	ID               string            `json:"id"`
 	FeatureDesc      string            `json:"feature_desc"`
 	WorktreePath     string            `json:"worktree_path"`
-	BaseBranch       string            `json:"base_branch"`
+	WorktreeSkipped  []string          `json:"worktree_skipped,omitempty"` // What worktree setup left out, such as submodules or LFS files
+	SparseDirs       []string          `json:"sparse_dirs,omitempty"`      // Sparse-checkout cone of the worktree, if narrowed
+	RepoPath         string            `json:"repo_path,omitempty"`        // Root of the working tree the run was started from
+	GitCommonDir     string            `json:"git_common_dir,omitempty"`   // Git directory shared by all worktrees of that repository
+	BaseBranch       string            `json:"base_branch"`                // Base revision as given: branch, remote branch, tag or SHA
+	BaseSHA          string            `json:"base_sha,omitempty"`         // Commit the base resolved to, moved forward by sync
+	HistoryBranch    string            `json:"history_branch,omitempty"`   // Curated copy of the branch integrated on completion
 	Tasks            []*Task           `json:"tasks"`
 	CreatedAt        time.Time         `json:"created_at"`
 	UpdatedAt        time.Time         `json:"updated_at"`
@@ -159,11 +176,12 @@ func (r *Run) GetRunningTasks() []*Task {
 	return running
 }
 
-// GetPendingTasks returns tasks that are pending
+// GetPendingTasks returns tasks that are pending, including tasks requeued
+// while waiting for file locks
 func (r *Run) GetPendingTasks() []*Task {
 	var pending []*Task
 	for _, t := range r.Tasks {
-		if t.Status == TaskStatusPending {
+		if t.Status == TaskStatusPending || t.Status == TaskStatusReady {
 			pending = append(pending, t)
 		}
 	}
@@ -0,0 +1,205 @@
+package state
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/howell-aikit/aiflow/internal/redact"
+)
+
+// Backend names accepted by OpenStore
+const (
+	BackendJSON = "json"
+	BackendBolt = "bolt"
+)
+
+// Store persists runs, their tasks, task attempts and run events
+type Store interface {
+	// Runs
+	CreateRun(featureDesc, worktreePath, baseBranch string) (*Run, error)
+	SaveRun(run *Run) error
+	LoadRun(id string) (*Run, error)
+	UpdateRun(runID string, updateFn func(*Run) error) error
+	DeleteRun(id string) error
+	ListRuns() ([]*Run, error)
+	QueryRuns(q RunQuery) ([]*Run, error)
+
+	// Tasks
+	AddTask(runID string, task *Task) error
+	UpdateTask(runID, taskID string, updateFn func(*Task)) error
+	SetTaskStatus(runID, taskID string, status TaskStatus) error
+	SetTaskSummary(runID, taskID string, summary *TaskSummary) error
+	SetTaskError(runID, taskID, errMsg string) error
+
+	// Attempts and events
+	RecordAttempt(runID, taskID string, attempt *Attempt) error
+	ListAttempts(runID, taskID string) ([]*Attempt, error)
+	AppendEvent(runID string, event *Event) error
+	ListEvents(runID string) ([]*Event, error)
+
+	// MigrateRuns upgrades every stored run to CurrentSchemaVersion and
+	// reports what changed; with dryRun nothing is written
+	MigrateRuns(dryRun bool) ([]*MigrationReport, error)
+
+	// Current run pointer
+	SetCurrentRun(id string) error
+	GetCurrentRunID() (string, error)
+	GetCurrentRun() (*Run, error)
+	ClearCurrentRun() error
+
+	Close() error
+}
+
+// OpenStore opens the state store for the configured backend. Everything
+// it writes, including the event journal, passes through redactor first
+// (nil disables redaction); see redactState.
+func OpenStore(backend, stateDir string, redactor *redact.Redactor) (Store, error) {
+	switch strings.ToLower(backend) {
+	case "", BackendJSON:
+		s, err := NewFileStore(stateDir)
+		if err != nil {
+			return nil, err
+		}
+		s.redactor = redactor
+		s.journal.redactor = redactor
+		return s, nil
+	case BackendBolt, "bbolt":
+		s, err := NewBoltStore(stateDir)
+		if err != nil {
+			return nil, err
+		}
+		s.redactor = redactor
+		s.journal.redactor = redactor
+		return s, nil
+	default:
+		return nil, fmt.Errorf("unknown state backend %q (expected %q or %q)", backend, BackendJSON, BackendBolt)
+	}
+}
+
+// freeTextFields are the keys of state documents that hold prose written by
+// users or the agent. Only these get the high-entropy rule: IDs, paths,
+// branches and SHAs must come back exactly as saved.
+var freeTextFields = map[string]bool{
+	"title":            true,
+	"description":      true,
+	"feature_desc":     true,
+	"question":         true,
+	"label":            true,
+	"default":          true,
+	"answer":           true,
+	"decisions":        true,
+	"conventions":      true,
+	"gotchas":          true,
+	"patterns_used":    true,
+	"public_interface": true,
+	"message":          true,
+	"error":            true,
+}
+
+// redactState redacts a marshaled state document or journal line
+func redactState(r *redact.Redactor, data []byte) []byte {
+	return r.Fields(data, func(key string) bool {
+		return freeTextFields[key]
+	})
+}
+
+// Attempt records one execution attempt of a task
+type Attempt struct {
+	Number     int        `json:"number"`
+	Status     TaskStatus `json:"status"`
+	StartedAt  time.Time  `json:"started_at"`
+	EndedAt    *time.Time `json:"ended_at,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	CommitSHA  string     `json:"commit_sha,omitempty"`
+	LockWaitMS int64      `json:"lock_wait_ms,omitempty"`
+	Rerun      bool       `json:"rerun,omitempty"`     // Made by aiflow rerun; its result is not the task's
+	Candidate  bool       `json:"candidate,omitempty"` // One of a best-of-N task's attempts; only the kept one has CommitSHA
+}
+
+// Event is a single entry in a run's history
+type Event struct {
+	Seq     int64             `json:"seq"`
+	Time    time.Time         `json:"time"`
+	Type    string            `json:"type"`
+	TaskID  string            `json:"task_id,omitempty"`
+	Message string            `json:"message,omitempty"`
+	Data    map[string]string `json:"data,omitempty"`
+}
+
+// RunQuery filters runs. Zero-valued fields match everything.
+type RunQuery struct {
+	Status    RunStatus
+	Repo      string
+	CommonDir string // Also match runs from other worktrees of the same repository
+	Since     time.Time
+	Until     time.Time
+	Limit     int
+}
+
+// Matches reports whether a run satisfies the query filters (ignoring Limit)
+func (q RunQuery) Matches(run *Run) bool {
+	if q.Status != "" && run.Status != q.Status {
+		return false
+	}
+	if q.Repo != "" && run.RepoPath != q.Repo {
+		if q.CommonDir == "" || run.GitCommonDir != q.CommonDir {
+			return false
+		}
+	}
+	if !q.Since.IsZero() && run.CreatedAt.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !run.CreatedAt.Before(q.Until) {
+		return false
+	}
+	return true
+}
+
+// sortAndLimit orders runs newest first and applies the query limit
+func (q RunQuery) sortAndLimit(runs []*Run) []*Run {
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].CreatedAt.After(runs[j].CreatedAt)
+	})
+	if q.Limit > 0 && len(runs) > q.Limit {
+		runs = runs[:q.Limit]
+	}
+	return runs
+}
+
+// newRun builds a fresh run in the breakdown state
+func newRun(id, featureDesc, worktreePath, baseBranch string) *Run {
+	now := time.Now()
+	return &Run{
+		SchemaVersion: CurrentSchemaVersion,
+		ID:            id,
+		FeatureDesc:   featureDesc,
+		WorktreePath:  worktreePath,
+		BaseBranch:    baseBranch,
+		Tasks:         []*Task{},
+		CreatedAt:     now,
+		UpdatedAt:     now,
+		Status:        RunStatusBreakdown,
+	}
+}
+
+// applyTaskStatus updates a task's status and timestamps
+func applyTaskStatus(t *Task, status TaskStatus) {
+	t.Status = status
+	now := time.Now()
+	switch status {
+	case TaskStatusRunning:
+		t.StartedAt = &now
+	case TaskStatusCompleted, TaskStatusFailed:
+		t.CompletedAt = &now
+	}
+}
+
+// applyTaskError marks a task failed with an error message
+func applyTaskError(t *Task, errMsg string) {
+	t.Error = errMsg
+	t.Status = TaskStatusFailed
+	now := time.Now()
+	t.CompletedAt = &now
+}
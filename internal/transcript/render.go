@@ -0,0 +1,192 @@
+package transcript
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/howell-aikit/aiflow/internal/claude"
+)
+
+// maxBlockLen bounds how much of a tool input or result is rendered
+const maxBlockLen = 500
+
+// Render writes a human-readable view of the recording in dir: the prompt,
+// the conversation with tool calls and results, and stderr. Recordings of
+// secondary invocations in subdirectories follow. With raw set, the JSONL
+// transcript is copied verbatim instead.
+func Render(w io.Writer, dir string, raw bool) error {
+	if _, err := os.Stat(dir); err != nil {
+		return fmt.Errorf("no transcript recorded at %s", dir)
+	}
+
+	if raw {
+		return copyFile(w, filepath.Join(dir, TranscriptFile))
+	}
+
+	if prompt, err := os.ReadFile(filepath.Join(dir, SystemPromptFile)); err == nil {
+		fmt.Fprintln(w, "=== System Prompt ===")
+		fmt.Fprintln(w, strings.TrimRight(string(prompt), "\n"))
+		fmt.Fprintln(w)
+	}
+
+	if prompt, err := os.ReadFile(filepath.Join(dir, PromptFile)); err == nil {
+		fmt.Fprintln(w, "=== Prompt ===")
+		fmt.Fprintln(w, strings.TrimRight(string(prompt), "\n"))
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprintln(w, "=== Transcript ===")
+	if err := renderTranscript(w, filepath.Join(dir, TranscriptFile)); err != nil {
+		return err
+	}
+
+	if stderr, err := os.ReadFile(filepath.Join(dir, StderrFile)); err == nil && len(strings.TrimSpace(string(stderr))) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "=== Stderr ===")
+		fmt.Fprintln(w, strings.TrimRight(string(stderr), "\n"))
+	}
+
+	if candidate, err := os.ReadFile(filepath.Join(dir, CandidateFile)); err == nil {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "=== Candidate ===")
+		fmt.Fprintln(w, strings.TrimRight(string(candidate), "\n"))
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read transcript directory: %w", err)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "##### %s #####\n", entry.Name())
+		if err := Render(w, filepath.Join(dir, entry.Name()), false); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// copyFile streams a file to w
+func copyFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open transcript: %w", err)
+	}
+	defer f.Close()
+
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// renderTranscript renders each stream-json event of a transcript file
+func renderTranscript(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			fmt.Fprintln(w, "(empty)")
+			return nil
+		}
+		return fmt.Errorf("failed to open transcript: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		event, err := claude.ParseEvent(scanner.Bytes())
+		if err != nil {
+			continue
+		}
+		renderEvent(w, event)
+	}
+	return scanner.Err()
+}
+
+// renderEvent writes one event
+func renderEvent(w io.Writer, event *claude.Event) {
+	switch event.Type {
+	case claude.EventTypeSystem:
+		fmt.Fprintf(w, "[system %s]\n", event.Subtype)
+
+	case claude.EventTypeResult:
+		status := event.Subtype
+		if event.IsError {
+			status += " (error)"
+		}
+		fmt.Fprintf(w, "[result %s]\n", status)
+
+	case claude.EventTypeError:
+		fmt.Fprintf(w, "[error] %s\n", event.Error)
+
+	case claude.EventTypeAssistant, claude.EventTypeUser:
+		if event.Message == nil {
+			return
+		}
+		for _, block := range event.Message.Content {
+			renderBlock(w, event.Type, block)
+		}
+	}
+}
+
+// renderBlock writes one message content block
+func renderBlock(w io.Writer, role claude.EventType, block claude.ContentBlock) {
+	switch block.Type {
+	case claude.ContentBlockText:
+		fmt.Fprintf(w, "%s: %s\n", role, strings.TrimSpace(block.Text))
+
+	case claude.ContentBlockToolUse:
+		fmt.Fprintf(w, "→ %s %s\n", block.Name, truncate(string(block.Input)))
+
+	case claude.ContentBlockToolResult:
+		marker := "←"
+		if block.IsError {
+			marker = "← (error)"
+		}
+		fmt.Fprintf(w, "%s %s\n", marker, truncate(contentText(block.Content)))
+	}
+}
+
+// contentText flattens tool result content, which is a string or a list of
+// content blocks
+func contentText(content interface{}) string {
+	switch c := content.(type) {
+	case string:
+		return c
+	case []interface{}:
+		var parts []string
+		for _, item := range c {
+			if m, ok := item.(map[string]interface{}); ok {
+				if text, ok := m["text"].(string); ok {
+					parts = append(parts, text)
+					continue
+				}
+			}
+			data, _ := json.Marshal(item)
+			parts = append(parts, string(data))
+		}
+		return strings.Join(parts, "\n")
+	case nil:
+		return ""
+	default:
+		data, _ := json.Marshal(c)
+		return string(data)
+	}
+}
+
+// truncate shortens s to maxBlockLen and keeps it on one line
+func truncate(s string) string {
+	s = strings.ReplaceAll(strings.TrimSpace(s), "\n", "\\n")
+	if len(s) > maxBlockLen {
+		return s[:maxBlockLen] + "…"
+	}
+	return s
+}
@@ -0,0 +1,277 @@
+// Package transcript persists the exact prompts, raw stream-json transcripts
+// and stderr of every agent invocation so failed tasks can be inspected
+// without re-running them.
+//
+// Layout under <state_dir>/runs/<run-id>/:
+//
+//	tasks/<task-id>/attempt-<n>/{prompt.md,transcript.jsonl,stderr.log}
+//	                                        system-prompt.md when one is set
+//	tasks/<task-id>/attempt-<n>/summary/...   summary extraction call
+//	tasks/<task-id>/attempt-<n>/{candidate.json,changes.patch}
+//	                                          score and diff of a best-of-N candidate
+//	planning/session-<n>/...                  breakdown planning sessions
+package transcript
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/howell-aikit/aiflow/internal/redact"
+	"github.com/howell-aikit/aiflow/internal/state"
+)
+
+// File names inside a recording directory
+const (
+	PromptFile       = "prompt.md"
+	SystemPromptFile = "system-prompt.md"
+	TranscriptFile   = "transcript.jsonl"
+	StderrFile       = "stderr.log"
+	CandidateFile    = "candidate.json"
+	PatchFile        = "changes.patch"
+)
+
+// PlanningTaskID addresses the planning sessions where a task ID is expected
+const PlanningTaskID = "planning"
+
+// SyncTaskID records Claude's conflict resolution passes during syncs, each
+// as one attempt
+const SyncTaskID = "sync"
+
+// Store locates and creates transcript recordings in the state directory
+type Store struct {
+	stateDir string
+	redactor *redact.Redactor
+}
+
+// NewStore creates a transcript store rooted in stateDir. Everything
+// recorded passes through redactor first (nil disables redaction).
+func NewStore(stateDir string, redactor *redact.Redactor) *Store {
+	return &Store{stateDir: stateDir, redactor: redactor}
+}
+
+// TaskDir returns the directory holding all attempts of a task
+func (s *Store) TaskDir(runID, taskID string) string {
+	return filepath.Join(state.RunDataDir(s.stateDir, runID), "tasks", taskID)
+}
+
+// AttemptDir returns the recording directory of one task attempt
+func (s *Store) AttemptDir(runID, taskID string, attempt int) string {
+	return filepath.Join(s.TaskDir(runID, taskID), fmt.Sprintf("attempt-%d", attempt))
+}
+
+// PlanningDir returns the directory holding all planning sessions
+func (s *Store) PlanningDir(runID string) string {
+	return filepath.Join(state.RunDataDir(s.stateDir, runID), "planning")
+}
+
+// SessionDir returns the recording directory of one planning session
+func (s *Store) SessionDir(runID string, session int) string {
+	return filepath.Join(s.PlanningDir(runID), fmt.Sprintf("session-%d", session))
+}
+
+// ListAttempts returns the recorded attempt numbers of a task in order
+func (s *Store) ListAttempts(runID, taskID string) ([]int, error) {
+	return listNumbered(s.TaskDir(runID, taskID), "attempt-")
+}
+
+// ListSessions returns the recorded planning session numbers in order
+func (s *Store) ListSessions(runID string) ([]int, error) {
+	return listNumbered(s.PlanningDir(runID), "session-")
+}
+
+// NewAttempt starts recording a task attempt
+func (s *Store) NewAttempt(runID, taskID string, attempt int) (*Recorder, error) {
+	return newRecorder(s.AttemptDir(runID, taskID, attempt), s.redactor)
+}
+
+// NewSession starts recording the next planning session
+func (s *Store) NewSession(runID string) (*Recorder, error) {
+	sessions, err := s.ListSessions(runID)
+	if err != nil {
+		return nil, err
+	}
+	next := 1
+	if n := len(sessions); n > 0 {
+		next = sessions[n-1] + 1
+	}
+	return newRecorder(s.SessionDir(runID, next), s.redactor)
+}
+
+// listNumbered returns the N of every <prefix>N entry in dir, sorted
+func listNumbered(dir, prefix string) ([]int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read transcript directory: %w", err)
+	}
+
+	var numbers []int
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), prefix) {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimPrefix(entry.Name(), prefix))
+		if err != nil {
+			continue
+		}
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+	return numbers, nil
+}
+
+// Recorder writes one agent invocation's prompt, transcript and stderr.
+// Output is redacted a line at a time so secrets split across writes are
+// still caught. It is safe for concurrent use.
+type Recorder struct {
+	dir      string
+	redactor *redact.Redactor
+	mu       sync.Mutex
+	files    map[string]*os.File
+	pending  map[string][]byte // Partial last line per file
+}
+
+// newRecorder creates the recording directory
+func newRecorder(dir string, redactor *redact.Redactor) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create transcript directory: %w", err)
+	}
+	return &Recorder{
+		dir:      dir,
+		redactor: redactor,
+		files:    make(map[string]*os.File),
+		pending:  make(map[string][]byte),
+	}, nil
+}
+
+// Dir returns the recording directory
+func (r *Recorder) Dir() string {
+	return r.dir
+}
+
+// Sub returns a recorder for a secondary invocation stored in a subdirectory
+func (r *Recorder) Sub(name string) (*Recorder, error) {
+	return newRecorder(filepath.Join(r.dir, name), r.redactor)
+}
+
+// WritePrompt stores the exact prompt sent to the agent
+func (r *Recorder) WritePrompt(prompt string) error {
+	if err := os.WriteFile(filepath.Join(r.dir, PromptFile), r.redactor.Bytes([]byte(prompt)), 0644); err != nil {
+		return fmt.Errorf("failed to write prompt: %w", err)
+	}
+	return nil
+}
+
+// WriteSystemPrompt stores the system prompt the agent was started with
+func (r *Recorder) WriteSystemPrompt(prompt string) error {
+	if err := os.WriteFile(filepath.Join(r.dir, SystemPromptFile), r.redactor.Bytes([]byte(prompt)), 0644); err != nil {
+		return fmt.Errorf("failed to write system prompt: %w", err)
+	}
+	return nil
+}
+
+// WriteFile stores another artifact of the attempt, such as a candidate's
+// score or diff
+func (r *Recorder) WriteFile(name string, data []byte) error {
+	if err := os.WriteFile(filepath.Join(r.dir, name), r.redactor.Bytes(data), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+// Transcript returns a writer appending to the raw JSONL transcript
+func (r *Recorder) Transcript() io.Writer {
+	return fileWriter{r, TranscriptFile}
+}
+
+// Stderr returns a writer appending to the stderr log
+func (r *Recorder) Stderr() io.Writer {
+	return fileWriter{r, StderrFile}
+}
+
+// Close flushes any partial lines and closes the recording files
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var firstErr error
+	for name, rest := range r.pending {
+		if err := r.writeLine(name, rest); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(r.pending, name)
+	}
+	for name, f := range r.files {
+		if err := f.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(r.files, name)
+	}
+	return firstErr
+}
+
+// write buffers p and appends every completed line to the named file
+func (r *Recorder) write(name string, p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	buf := append(r.pending[name], p...)
+	for {
+		i := bytes.IndexByte(buf, '\n')
+		if i < 0 {
+			break
+		}
+		if err := r.writeLine(name, buf[:i+1]); err != nil {
+			return 0, err
+		}
+		buf = buf[i+1:]
+	}
+	r.pending[name] = append([]byte(nil), buf...)
+
+	return len(p), nil
+}
+
+// writeLine redacts one line and appends it, opening the file on first
+// use. Transcript lines are JSON and keep their structure.
+func (r *Recorder) writeLine(name string, line []byte) error {
+	if len(line) == 0 {
+		return nil
+	}
+
+	if name == TranscriptFile {
+		line = r.redactor.JSON(line)
+	} else {
+		line = r.redactor.Bytes(line)
+	}
+
+	f, ok := r.files[name]
+	if !ok {
+		var err error
+		f, err = os.OpenFile(filepath.Join(r.dir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		r.files[name] = f
+	}
+	_, err := f.Write(line)
+	return err
+}
+
+// fileWriter adapts a Recorder file to io.Writer
+type fileWriter struct {
+	r    *Recorder
+	name string
+}
+
+func (w fileWriter) Write(p []byte) (int, error) {
+	return w.r.write(w.name, p)
+}
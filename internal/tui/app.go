@@ -5,6 +5,7 @@ import (
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/howell-aikit/aiflow/internal/config"
+	"github.com/howell-aikit/aiflow/internal/redact"
 	"github.com/howell-aikit/aiflow/internal/state"
 )
 
@@ -64,7 +65,7 @@ type Model struct {
 	// Configuration
 	cfg   *config.Config
 	run   *state.Run
-	store *state.Store
+	store state.Store
 
 	// Current screen
 	screen Screen
@@ -86,7 +87,9 @@ type Model struct {
 }
 
 // NewModel creates a new TUI model
-func NewModel(cfg *config.Config, run *state.Run, store *state.Store) Model {
+func NewModel(cfg *config.Config, run *state.Run, store state.Store) Model {
+	debugRedactor = redact.ForConfig(cfg)
+
 	return Model{
 		cfg:        cfg,
 		run:        run,
@@ -146,13 +149,19 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, m.execution.Init()
 		case ScreenComplete:
 			m.completion = NewCompletionModel(m.cfg, m.run, m.store)
-			return m, nil
+			return m, m.completion.Init()
 		}
 		return m, nil
 
 	case FailureTransitionMsg:
 		m.screen = ScreenFailure
-		m.failure = NewFailureModel(m.cfg, m.run, m.store, msg.FailedTask, msg.LastGoodSHA)
+		// Reload run so rollback sees where every task started
+		if m.store != nil {
+			if updatedRun, err := m.store.LoadRun(m.run.ID); err == nil {
+				m.run = updatedRun
+			}
+		}
+		m.failure = NewFailureModel(m.cfg, m.run, m.store, msg.FailedTask)
 		return m, nil
 
 	case ErrorMsg:
@@ -226,8 +235,7 @@ type ScreenTransitionMsg struct {
 
 // FailureTransitionMsg transitions to failure screen with context
 type FailureTransitionMsg struct {
-	FailedTask  *state.Task
-	LastGoodSHA string
+	FailedTask *state.Task
 }
 
 // ErrorMsg indicates an error occurred
@@ -265,7 +273,7 @@ func TruncateString(s string, maxLen int) string {
 }
 
 // Run starts the TUI
-func Run(cfg *config.Config, run *state.Run, store *state.Store) error {
+func Run(cfg *config.Config, run *state.Run, store state.Store) error {
 	p := tea.NewProgram(
 		NewModel(cfg, run, store),
 		tea.WithAltScreen(),
@@ -4,8 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -16,10 +18,15 @@ import (
 	"github.com/howell-aikit/aiflow/internal/breakdown"
 	"github.com/howell-aikit/aiflow/internal/claude"
 	"github.com/howell-aikit/aiflow/internal/config"
+	"github.com/howell-aikit/aiflow/internal/redact"
 	"github.com/howell-aikit/aiflow/internal/state"
+	"github.com/howell-aikit/aiflow/internal/transcript"
 )
 
-var debugLog *log.Logger
+var (
+	debugLog      *log.Logger
+	debugRedactor *redact.Redactor // Keeps secrets out of the debug log
+)
 
 func init() {
 	f, err := os.OpenFile("/tmp/aiflow-debug.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
@@ -30,7 +37,7 @@ func init() {
 
 func logDebug(format string, args ...interface{}) {
 	if debugLog != nil {
-		debugLog.Printf(format, args...)
+		debugLog.Print(debugRedactor.String(fmt.Sprintf(format, args...)))
 	}
 }
 
@@ -49,7 +56,7 @@ const (
 type BreakdownModel struct {
 	cfg     *config.Config
 	run     *state.Run
-	store   *state.Store
+	store   state.Store
 	phase   BreakdownPhase
 	spinner spinner.Model
 
@@ -86,7 +93,7 @@ type questionState struct {
 }
 
 // NewBreakdownModel creates a new breakdown model
-func NewBreakdownModel(cfg *config.Config, run *state.Run, store *state.Store) BreakdownModel {
+func NewBreakdownModel(cfg *config.Config, run *state.Run, store state.Store) BreakdownModel {
 	featureInput := textinput.New()
 	featureInput.Placeholder = "Describe what you want to build..."
 	featureInput.Focus()
@@ -156,6 +163,11 @@ func (m BreakdownModel) Update(msg tea.Msg) (BreakdownModel, tea.Cmd) {
 
 	case planningQuestionMsg:
 		logDebug("planningQuestionMsg: entering PhaseQuestion with %d questions", len(msg.questions))
+		for _, q := range msg.questions {
+			state.RecordEvent(m.store, m.run.ID, state.EventQuestionAsked, "", q.Question, map[string]string{
+				"header": q.Header,
+			})
+		}
 		m.phase = PhaseQuestion
 		otherInput := textarea.New()
 		otherInput.Placeholder = "Type your answer (Enter for new line, Ctrl+D to submit)..."
@@ -178,6 +190,9 @@ func (m BreakdownModel) Update(msg tea.Msg) (BreakdownModel, tea.Cmd) {
 		}
 		m.tasks = msg.tasks
 		m.phase = PhaseReview
+		state.RecordEvent(m.store, m.run.ID, state.EventBreakdownComplete, "", "", map[string]string{
+			"tasks": strconv.Itoa(len(msg.tasks)),
+		})
 		return m, nil
 
 	case planningErrorMsg:
@@ -334,6 +349,9 @@ func (m BreakdownModel) submitQuestionAnswer(answer string) (BreakdownModel, tea
 		key = fmt.Sprintf("q%d", q.currentIdx)
 	}
 	q.answers[key] = answer
+	state.RecordEvent(m.store, m.run.ID, state.EventQuestionAnswered, "", answer, map[string]string{
+		"header": currentQ.Header,
+	})
 
 	// Move to next question or submit all answers
 	q.currentIdx++
@@ -384,6 +402,9 @@ func (m BreakdownModel) handleReviewInput(msg tea.KeyMsg) (BreakdownModel, tea.C
 		if m.store != nil {
 			m.store.SaveRun(m.run)
 		}
+		state.RecordEvent(m.store, m.run.ID, state.EventBreakdownApproved, "", "", map[string]string{
+			"tasks": strconv.Itoa(len(m.tasks)),
+		})
 		return m, func() tea.Msg {
 			return ScreenTransitionMsg{Screen: ScreenConfirm}
 		}
@@ -588,6 +609,9 @@ func (m BreakdownModel) viewReview() string {
 		if task.ParallelGroup != "" {
 			titleLine += fmt.Sprintf(" [%s]", task.ParallelGroup)
 		}
+		if task.BestOf > 1 {
+			titleLine += fmt.Sprintf(" (best of %d)", task.BestOf)
+		}
 		b.WriteString(style.Render(titleLine))
 		b.WriteString("\n")
 
@@ -705,9 +729,28 @@ func (m *BreakdownModel) startPlanning() tea.Cmd {
 
 		prompt := claude.BuildPlanningPrompt(m.run.FeatureDesc, m.projectType)
 
+		// Record the session so planning can be inspected afterwards
+		var transcriptW, stderrW io.Writer
+		if m.cfg != nil {
+			rec, err := transcript.NewStore(m.cfg.StateDir, redact.ForConfig(m.cfg)).NewSession(m.run.ID)
+			if err != nil {
+				logDebug("startPlanning: transcript disabled: %v", err)
+			} else {
+				defer rec.Close()
+				rec.WriteSystemPrompt(claude.PlanningSystemPrompt)
+				rec.WritePrompt(prompt)
+				transcriptW, stderrW = rec.Transcript(), rec.Stderr()
+			}
+		}
+		state.RecordEvent(m.store, m.run.ID, state.EventPlanningStarted, "", m.run.FeatureDesc, map[string]string{
+			"project_type": m.projectType,
+		})
+
 		err := m.streamClient.Start(ctx, prompt, claude.StreamOptions{
 			SystemPrompt:    claude.PlanningSystemPrompt,
 			SkipPermissions: true,
+			Transcript:      transcriptW,
+			Stderr:          stderrW,
 
 			OnText: func(text string) {
 				// Check for breakdown JSON in the text
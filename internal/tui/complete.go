@@ -1,13 +1,16 @@
 package tui
 
 import (
+	"context"
 	"fmt"
 	"os/exec"
 	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/howell-aikit/aiflow/internal/config"
+	"github.com/howell-aikit/aiflow/internal/executor"
 	"github.com/howell-aikit/aiflow/internal/state"
+	"github.com/howell-aikit/aiflow/internal/worktree"
 )
 
 // CompletionAction represents the user's choice on completion
@@ -19,21 +22,42 @@ const (
 	CompletionKeepBranch
 )
 
+// String returns the action name recorded in the run journal
+func (a CompletionAction) String() string {
+	switch a {
+	case CompletionCreatePR:
+		return "create_pr"
+	case CompletionMergeDirect:
+		return "merge"
+	case CompletionKeepBranch:
+		return "keep_branch"
+	}
+	return "unknown"
+}
+
 // CompletionModel handles the completion options screen
 type CompletionModel struct {
 	cfg          *config.Config
 	run          *state.Run
-	store        *state.Store
+	store        state.Store
 	selectedItem int
 	actions      []CompletionAction
 	prURL        string
+	mergedSHA    string
 	err          error
 	done         bool
 	processing   bool
+	syncing      bool
+	synced       *worktree.SyncResult
+	history      worktree.HistoryStrategy
 }
 
 // NewCompletionModel creates a new completion model
-func NewCompletionModel(cfg *config.Config, run *state.Run, store *state.Store) CompletionModel {
+func NewCompletionModel(cfg *config.Config, run *state.Run, store state.Store) CompletionModel {
+	history, err := worktree.ParseHistoryStrategy(cfg.Integration.History)
+	if err != nil {
+		history = worktree.HistoryKeep
+	}
 	return CompletionModel{
 		cfg:   cfg,
 		run:   run,
@@ -43,7 +67,19 @@ func NewCompletionModel(cfg *config.Config, run *state.Run, store *state.Store)
 			CompletionMergeDirect,
 			CompletionKeepBranch,
 		},
+		history: history,
+	}
+}
+
+// Init syncs the run's branch with its base before the options are
+// offered, when sync.before_merge is enabled
+func (m *CompletionModel) Init() tea.Cmd {
+	if !m.cfg.Sync.BeforeMerge {
+		return nil
 	}
+	m.processing = true
+	m.syncing = true
+	return m.syncBase()
 }
 
 // Update handles messages for completion model
@@ -62,18 +98,36 @@ func (m CompletionModel) Update(msg tea.Msg) (CompletionModel, tea.Cmd) {
 			if m.selectedItem < len(m.actions)-1 {
 				m.selectedItem++
 			}
+		case "h":
+			m.history = nextHistoryStrategy(m.history)
 		case "enter":
 			return m.handleAction(m.actions[m.selectedItem])
 		case "q", "esc":
 			return m, tea.Quit
 		}
 
+	case syncCompleteMsg:
+		m.processing = false
+		m.syncing = false
+		// Sync moves the run's base and head in the store
+		if run, err := m.store.LoadRun(m.run.ID); err == nil {
+			m.run = run
+		}
+		if msg.err != nil {
+			// The branch is left as it was; the options are still offered
+			m.err = fmt.Errorf("sync with %s failed: %w", m.run.BaseBranch, msg.err)
+		} else {
+			m.synced = msg.result
+		}
+		return m, nil
+
 	case prCreatedMsg:
 		m.processing = false
 		if msg.err != nil {
 			m.err = msg.err
 		} else {
 			m.prURL = msg.url
+			state.RecordEvent(m.store, m.run.ID, state.EventPRCreated, "", msg.url, nil)
 		}
 		return m, nil
 
@@ -83,6 +137,11 @@ func (m CompletionModel) Update(msg tea.Msg) (CompletionModel, tea.Cmd) {
 			m.err = msg.err
 		} else {
 			m.done = true
+			m.mergedSHA = msg.sha
+			state.RecordEvent(m.store, m.run.ID, state.EventMerged, "", m.run.BaseBranch, map[string]string{
+				"sha":      msg.sha,
+				"strategy": string(msg.strategy),
+			})
 		}
 		return m, nil
 	}
@@ -90,6 +149,8 @@ func (m CompletionModel) Update(msg tea.Msg) (CompletionModel, tea.Cmd) {
 }
 
 func (m CompletionModel) handleAction(action CompletionAction) (CompletionModel, tea.Cmd) {
+	state.RecordEvent(m.store, m.run.ID, state.EventCompletionAction, "", action.String(), nil)
+
 	switch action {
 	case CompletionCreatePR:
 		m.processing = true
@@ -100,38 +161,106 @@ func (m CompletionModel) handleAction(action CompletionAction) (CompletionModel,
 		return m, m.mergeDirect()
 
 	case CompletionKeepBranch:
+		// Leave the curated branch next to the run's branch for review
+		if m.history != worktree.HistoryKeep {
+			run, err := m.freshRun()
+			if err == nil {
+				_, err = executor.CurateHistory(m.cfg, m.store, run, m.history)
+			}
+			if err != nil {
+				m.err = err
+				return m, nil
+			}
+		}
 		m.done = true
 		return m, tea.Quit
 	}
 	return m, nil
 }
 
+// nextHistoryStrategy cycles through the history strategies
+func nextHistoryStrategy(current worktree.HistoryStrategy) worktree.HistoryStrategy {
+	for i, s := range worktree.HistoryStrategies {
+		if s == current {
+			return worktree.HistoryStrategies[(i+1)%len(worktree.HistoryStrategies)]
+		}
+	}
+	return worktree.HistoryKeep
+}
+
 // Messages
 type prCreatedMsg struct {
 	url string
 	err error
 }
 
+type syncCompleteMsg struct {
+	result *worktree.SyncResult
+	err    error
+}
+
 type mergeCompleteMsg struct {
-	err error
+	sha      string
+	strategy worktree.MergeStrategy
+	err      error
+}
+
+// freshRun reloads the run, which a sync from another process or an earlier
+// step may have changed since the screen was opened
+func (m CompletionModel) freshRun() (*state.Run, error) {
+	run, err := m.store.LoadRun(m.run.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load run: %w", err)
+	}
+	return run, nil
+}
+
+// integrator returns the integrator for the run's worktree and source
+// repository
+func (m CompletionModel) integrator() (*worktree.Integrator, error) {
+	return worktree.NewIntegrator(m.run.RepoPath, m.run.WorktreePath)
+}
+
+func (m CompletionModel) syncBase() tea.Cmd {
+	return func() tea.Msg {
+		mode, err := worktree.ParseSyncMode(m.cfg.Sync.Mode)
+		if err != nil {
+			return syncCompleteMsg{err: err}
+		}
+		run, err := m.freshRun()
+		if err != nil {
+			return syncCompleteMsg{err: err}
+		}
+		result, err := executor.SyncRun(context.Background(), m.cfg, m.store, run, executor.SyncOptions{
+			Mode:             mode,
+			ResolveConflicts: m.cfg.Sync.ResolveConflicts,
+		})
+		return syncCompleteMsg{result: result, err: err}
+	}
 }
 
 func (m CompletionModel) createPR() tea.Cmd {
 	return func() tea.Msg {
-		// Get current branch name
-		branchCmd := exec.Command("git", "rev-parse", "--abbrev-ref", "HEAD")
-		branchCmd.Dir = m.run.WorktreePath
-		branchOutput, err := branchCmd.Output()
+		in, err := m.integrator()
+		if err != nil {
+			return prCreatedMsg{err: err}
+		}
+		run, err := m.freshRun()
+		if err != nil {
+			return prCreatedMsg{err: err}
+		}
+		branch, err := executor.CurateHistory(m.cfg, m.store, run, m.history)
 		if err != nil {
-			return prCreatedMsg{err: fmt.Errorf("failed to get branch: %w", err)}
+			return prCreatedMsg{err: err}
 		}
-		branch := strings.TrimSpace(string(branchOutput))
 
-		// Push branch to remote
-		pushCmd := exec.Command("git", "push", "-u", "origin", branch)
-		pushCmd.Dir = m.run.WorktreePath
-		if output, err := pushCmd.CombinedOutput(); err != nil {
-			return prCreatedMsg{err: fmt.Errorf("failed to push: %w: %s", err, string(output))}
+		// Push from the source repository, whose remote is the real one
+		remote := m.cfg.Integration.Remote
+		if remote == "" {
+			remote = "origin"
+		}
+		if err := in.Push(branch, remote); err != nil {
+			return prCreatedMsg{err: err}
 		}
 
 		// Create PR using gh CLI
@@ -143,8 +272,10 @@ func (m CompletionModel) createPR() tea.Cmd {
 		prCmd := exec.Command("gh", "pr", "create",
 			"--title", title,
 			"--body", fmt.Sprintf("## Summary\n\n%s\n\n---\nGenerated by aiflow", m.run.FeatureDesc),
+			"--head", branch,
+			"--base", m.run.BaseBranch,
 		)
-		prCmd.Dir = m.run.WorktreePath
+		prCmd.Dir = in.RepoPath()
 		output, err := prCmd.CombinedOutput()
 		if err != nil {
 			return prCreatedMsg{err: fmt.Errorf("failed to create PR: %w: %s", err, string(output))}
@@ -158,33 +289,47 @@ func (m CompletionModel) createPR() tea.Cmd {
 
 func (m CompletionModel) mergeDirect() tea.Cmd {
 	return func() tea.Msg {
-		// Get current branch
-		branchCmd := exec.Command("git", "rev-parse", "--abbrev-ref", "HEAD")
-		branchCmd.Dir = m.run.WorktreePath
-		branchOutput, err := branchCmd.Output()
+		in, err := m.integrator()
 		if err != nil {
-			return mergeCompleteMsg{err: fmt.Errorf("failed to get branch: %w", err)}
+			return mergeCompleteMsg{err: err}
 		}
-		branch := strings.TrimSpace(string(branchOutput))
-
-		// Checkout base branch
-		checkoutCmd := exec.Command("git", "checkout", m.run.BaseBranch)
-		checkoutCmd.Dir = m.run.WorktreePath
-		if output, err := checkoutCmd.CombinedOutput(); err != nil {
-			return mergeCompleteMsg{err: fmt.Errorf("failed to checkout %s: %w: %s", m.run.BaseBranch, err, string(output))}
+		run, err := m.freshRun()
+		if err != nil {
+			return mergeCompleteMsg{err: err}
+		}
+		branch, err := executor.CurateHistory(m.cfg, m.store, run, m.history)
+		if err != nil {
+			return mergeCompleteMsg{err: err}
 		}
 
-		// Merge feature branch
-		mergeCmd := exec.Command("git", "merge", branch, "--no-ff", "-m", fmt.Sprintf("Merge aiflow: %s", m.run.FeatureDesc))
-		mergeCmd.Dir = m.run.WorktreePath
-		if output, err := mergeCmd.CombinedOutput(); err != nil {
-			return mergeCompleteMsg{err: fmt.Errorf("failed to merge: %w: %s", err, string(output))}
+		// Merge in the source repository so the user's base branch
+		// receives the feature
+		strategy, err := worktree.ParseMergeStrategy(m.cfg.Integration.MergeStrategy)
+		if err != nil {
+			return mergeCompleteMsg{err: err}
+		}
+		sign, err := executor.ResolveSigning(m.cfg.Commit, in.RepoPath())
+		if err != nil {
+			return mergeCompleteMsg{err: err}
+		}
+		in.SetSigning(sign)
+		sha, err := in.Merge(branch, m.run.BaseBranch, strategy, fmt.Sprintf("Merge aiflow: %s", m.run.FeatureDesc))
+		if err != nil {
+			return mergeCompleteMsg{err: err}
 		}
 
-		return mergeCompleteMsg{}
+		return mergeCompleteMsg{sha: sha, strategy: strategy}
 	}
 }
 
+// mergeStrategyName returns the configured merge strategy for display
+func (m CompletionModel) mergeStrategyName() string {
+	if strategy, err := worktree.ParseMergeStrategy(m.cfg.Integration.MergeStrategy); err == nil {
+		return string(strategy)
+	}
+	return m.cfg.Integration.MergeStrategy
+}
+
 // View renders the completion screen
 func (m CompletionModel) View() string {
 	var b strings.Builder
@@ -219,16 +364,35 @@ func (m CompletionModel) View() string {
 
 	if m.done {
 		b.WriteString(successStyle.Render("Changes merged to " + m.run.BaseBranch))
-		b.WriteString("\n\n")
+		b.WriteString("\n")
+		if m.mergedSHA != "" {
+			b.WriteString(dimStyle.Render(fmt.Sprintf("%s is now at %s", m.run.BaseBranch, truncateSHA(m.mergedSHA))))
+			b.WriteString("\n")
+		}
+		b.WriteString("\n")
 		b.WriteString(dimStyle.Render("Press q to quit"))
 		return boxStyle.Render(b.String())
 	}
 
+	if m.syncing {
+		b.WriteString(fmt.Sprintf("Syncing with %s...\n", m.run.BaseBranch))
+		return boxStyle.Render(b.String())
+	}
+
 	if m.processing {
 		b.WriteString("Processing...\n")
 		return boxStyle.Render(b.String())
 	}
 
+	if m.synced != nil && !m.synced.UpToDate {
+		b.WriteString(dimStyle.Render(fmt.Sprintf("Synced with %s (%s): %s -> %s",
+			m.synced.BaseRef, m.synced.Mode, truncateSHA(m.synced.OldHead), truncateSHA(m.synced.NewHead))))
+		b.WriteString("\n\n")
+	}
+
+	b.WriteString(dimStyle.Render("History: " + historyDescription(m.history)))
+	b.WriteString("\n\n")
+
 	b.WriteString("What would you like to do?\n\n")
 
 	actionLabels := map[CompletionAction]string{
@@ -239,7 +403,7 @@ func (m CompletionModel) View() string {
 
 	actionDescs := map[CompletionAction]string{
 		CompletionCreatePR:    "Push branch and open PR for review",
-		CompletionMergeDirect: "Merge changes without PR",
+		CompletionMergeDirect: fmt.Sprintf("Merge (%s) into the source repository without PR", m.mergeStrategyName()),
 		CompletionKeepBranch:  "Exit and keep changes in worktree",
 	}
 
@@ -262,7 +426,18 @@ func (m CompletionModel) View() string {
 	}
 
 	b.WriteString("\n")
-	b.WriteString(dimStyle.Render("↑/↓ select • Enter to confirm • q to quit"))
+	b.WriteString(dimStyle.Render("↑/↓ select • h history • Enter to confirm • q to quit"))
 
 	return boxStyle.Render(b.String())
 }
+
+// historyDescription explains a history strategy on the completion screen
+func historyDescription(h worktree.HistoryStrategy) string {
+	switch h {
+	case worktree.HistorySquash:
+		return "squash into one commit (per-task commits stay on the run's branch)"
+	case worktree.HistoryGroup:
+		return "one commit per parallel group (per-task commits stay on the run's branch)"
+	}
+	return "keep one commit per task"
+}
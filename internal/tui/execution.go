@@ -19,7 +19,7 @@ import (
 type ExecutionModel struct {
 	cfg   *config.Config
 	run   *state.Run
-	store *state.Store
+	store state.Store
 
 	// UI state
 	spinner   spinner.Model
@@ -44,7 +44,7 @@ type ExecutionModel struct {
 }
 
 // NewExecutionModel creates a new execution model
-func NewExecutionModel(cfg *config.Config, run *state.Run, store *state.Store) ExecutionModel {
+func NewExecutionModel(cfg *config.Config, run *state.Run, store state.Store) ExecutionModel {
 	p := progress.New(
 		progress.WithDefaultGradient(),
 		progress.WithWidth(40),
@@ -132,8 +132,7 @@ func (m ExecutionModel) Update(msg tea.Msg) (ExecutionModel, tea.Cmd) {
 			if msg.failedTask != nil {
 				return m, func() tea.Msg {
 					return FailureTransitionMsg{
-						FailedTask:  msg.failedTask,
-						LastGoodSHA: msg.lastGoodSHA,
+						FailedTask: msg.failedTask,
 					}
 				}
 			}
@@ -250,9 +249,8 @@ type taskCompletedMsg struct {
 }
 
 type executionCompleteMsg struct {
-	err         error
-	failedTask  *state.Task
-	lastGoodSHA string
+	err        error
+	failedTask *state.Task
 }
 
 func (m ExecutionModel) startExecution() tea.Cmd {
@@ -261,9 +259,8 @@ func (m ExecutionModel) startExecution() tea.Cmd {
 		ctx := context.Background()
 		err := exec.ExecuteAll(ctx, nil)
 
-		// If error, find the failed task and last good commit
+		// If error, find the failed task
 		var failedTask *state.Task
-		var lastGoodSHA string
 
 		if err != nil {
 			// Reload run to get latest state
@@ -275,27 +272,18 @@ func (m ExecutionModel) startExecution() tea.Cmd {
 						break
 					}
 				}
-				// Find last good commit from completed tasks
-				for i := len(updatedRun.Tasks) - 1; i >= 0; i-- {
-					t := updatedRun.Tasks[i]
-					if t.Status == state.TaskStatusCompleted && t.CommitSHA != "" {
-						lastGoodSHA = t.CommitSHA
-						break
-					}
-				}
 			}
 		}
 
 		return executionCompleteMsg{
-			err:         err,
-			failedTask:  failedTask,
-			lastGoodSHA: lastGoodSHA,
+			err:        err,
+			failedTask: failedTask,
 		}
 	}
 }
 
 // RunExecutor runs the actual executor (called from outside TUI)
-func RunExecutor(cfg *config.Config, run *state.Run, store *state.Store) error {
+func RunExecutor(cfg *config.Config, run *state.Run, store state.Store) error {
 	exec := executor.NewExecutor(cfg, run.WorktreePath, store, run)
 
 	ctx := context.Background()
@@ -308,13 +296,13 @@ func RunExecutor(cfg *config.Config, run *state.Run, store *state.Store) error {
 // ConfirmModel handles the task confirmation screen
 type ConfirmModel struct {
 	run          *state.Run
-	store        *state.Store
+	store        state.Store
 	confirmed    bool
 	selectedItem int
 }
 
 // NewConfirmModel creates a new confirm model
-func NewConfirmModel(run *state.Run, store *state.Store) ConfirmModel {
+func NewConfirmModel(run *state.Run, store state.Store) ConfirmModel {
 	return ConfirmModel{
 		run:   run,
 		store: store,
@@ -332,6 +320,7 @@ func (m ConfirmModel) Update(msg tea.Msg) (ConfirmModel, tea.Cmd) {
 			if m.store != nil {
 				m.store.SaveRun(m.run)
 			}
+			state.RecordEvent(m.store, m.run.ID, state.EventRunStatus, "", string(state.RunStatusRunning), nil)
 			return m, func() tea.Msg {
 				return ScreenTransitionMsg{Screen: ScreenExecution}
 			}
@@ -6,8 +6,8 @@ import (
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/howell-aikit/aiflow/internal/config"
+	"github.com/howell-aikit/aiflow/internal/executor"
 	"github.com/howell-aikit/aiflow/internal/state"
-	"github.com/howell-aikit/aiflow/pkg/git"
 )
 
 // FailureAction represents the user's choice on failure
@@ -20,20 +20,53 @@ const (
 	ActionAbort
 )
 
+// String returns the action name recorded in the run journal
+func (a FailureAction) String() string {
+	switch a {
+	case ActionRetry:
+		return "retry"
+	case ActionRollback:
+		return "rollback"
+	case ActionSkip:
+		return "skip"
+	case ActionAbort:
+		return "abort"
+	}
+	return "unknown"
+}
+
 // FailureModel handles the task failure screen
 type FailureModel struct {
 	cfg          *config.Config
 	run          *state.Run
-	store        *state.Store
+	store        state.Store
 	failedTask   *state.Task
-	lastGoodSHA  string
 	selectedItem int
 	actions      []FailureAction
 	err          error
+
+	// Rollback target picker
+	choosingTarget bool
+	targets        []*state.Task
+	selectedTarget int
 }
 
 // NewFailureModel creates a new failure model
-func NewFailureModel(cfg *config.Config, run *state.Run, store *state.Store, failedTask *state.Task, lastGoodSHA string) FailureModel {
+func NewFailureModel(cfg *config.Config, run *state.Run, store state.Store, failedTask *state.Task) FailureModel {
+	// Any task that has started can be rolled back to, defaulting to the
+	// one that failed
+	var targets []*state.Task
+	selectedTarget := 0
+	for _, t := range run.Tasks {
+		if t.BaseSHA == "" {
+			continue
+		}
+		if failedTask != nil && t.ID == failedTask.ID {
+			selectedTarget = len(targets)
+		}
+		targets = append(targets, t)
+	}
+
 	actions := []FailureAction{
 		ActionRetry,
 		ActionRollback,
@@ -41,8 +74,8 @@ func NewFailureModel(cfg *config.Config, run *state.Run, store *state.Store, fai
 		ActionAbort,
 	}
 
-	// Remove rollback option if no previous commit available
-	if lastGoodSHA == "" {
+	// Remove rollback option if no task has a recorded starting point
+	if len(targets) == 0 {
 		actions = []FailureAction{
 			ActionRetry,
 			ActionSkip,
@@ -51,12 +84,13 @@ func NewFailureModel(cfg *config.Config, run *state.Run, store *state.Store, fai
 	}
 
 	return FailureModel{
-		cfg:         cfg,
-		run:         run,
-		store:       store,
-		failedTask:  failedTask,
-		lastGoodSHA: lastGoodSHA,
-		actions:     actions,
+		cfg:            cfg,
+		run:            run,
+		store:          store,
+		failedTask:     failedTask,
+		actions:        actions,
+		targets:        targets,
+		selectedTarget: selectedTarget,
 	}
 }
 
@@ -64,6 +98,9 @@ func NewFailureModel(cfg *config.Config, run *state.Run, store *state.Store, fai
 func (m FailureModel) Update(msg tea.Msg) (FailureModel, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		if m.choosingTarget {
+			return m.updateTarget(msg)
+		}
 		switch msg.String() {
 		case "up", "k":
 			if m.selectedItem > 0 {
@@ -82,7 +119,53 @@ func (m FailureModel) Update(msg tea.Msg) (FailureModel, tea.Cmd) {
 	return m, nil
 }
 
+// updateTarget handles keys while picking the task to roll back to
+func (m FailureModel) updateTarget(msg tea.KeyMsg) (FailureModel, tea.Cmd) {
+	switch msg.String() {
+	case "up", "k":
+		if m.selectedTarget > 0 {
+			m.selectedTarget--
+		}
+	case "down", "j":
+		if m.selectedTarget < len(m.targets)-1 {
+			m.selectedTarget++
+		}
+	case "enter":
+		return m.rollback(m.targets[m.selectedTarget])
+	case "esc":
+		m.choosingTarget = false
+	case "q":
+		return m, tea.Quit
+	}
+	return m, nil
+}
+
+// rollback resets the run to the start of target and resumes execution
+func (m FailureModel) rollback(target *state.Task) (FailureModel, tea.Cmd) {
+	state.RecordEvent(m.store, m.run.ID, state.EventFailureAction, m.failedTask.ID, m.failedTask.Error, map[string]string{
+		"action": ActionRollback.String(),
+		"to":     target.ID,
+		"sha":    target.BaseSHA,
+	})
+
+	if _, err := executor.RollbackRun(m.store, m.run, target.ID); err != nil {
+		m.err = err
+		m.choosingTarget = false
+		return m, nil
+	}
+	return m, func() tea.Msg {
+		return ScreenTransitionMsg{Screen: ScreenExecution}
+	}
+}
+
 func (m FailureModel) handleAction(action FailureAction) (FailureModel, tea.Cmd) {
+	if action == ActionRollback {
+		m.choosingTarget = true
+		m.err = nil
+		return m, nil
+	}
+	state.RecordEvent(m.store, m.run.ID, state.EventFailureAction, m.failedTask.ID, m.failedTask.Error, map[string]string{"action": action.String()})
+
 	switch action {
 	case ActionRetry:
 		// Reset task status to pending and go back to execution
@@ -96,29 +179,6 @@ func (m FailureModel) handleAction(action FailureAction) (FailureModel, tea.Cmd)
 			return ScreenTransitionMsg{Screen: ScreenExecution}
 		}
 
-	case ActionRollback:
-		if m.lastGoodSHA != "" {
-			repo, err := git.Open(m.run.WorktreePath)
-			if err != nil {
-				m.err = fmt.Errorf("failed to open repo: %w", err)
-				return m, nil
-			}
-			if err := repo.ResetHard(m.lastGoodSHA); err != nil {
-				m.err = fmt.Errorf("failed to rollback: %w", err)
-				return m, nil
-			}
-		}
-		// Reset task and go back to execution
-		m.failedTask.Status = state.TaskStatusPending
-		m.failedTask.Error = ""
-		m.store.UpdateTask(m.run.ID, m.failedTask.ID, func(t *state.Task) {
-			t.Status = state.TaskStatusPending
-			t.Error = ""
-		})
-		return m, func() tea.Msg {
-			return ScreenTransitionMsg{Screen: ScreenExecution}
-		}
-
 	case ActionSkip:
 		// Mark task as completed (skipped) and continue
 		m.store.UpdateTask(m.run.ID, m.failedTask.ID, func(t *state.Task) {
@@ -167,18 +227,22 @@ func (m FailureModel) View() string {
 		b.WriteString("\n\n")
 	}
 
+	if m.choosingTarget {
+		return boxStyle.Render(b.String() + m.targetView())
+	}
+
 	b.WriteString("What would you like to do?\n\n")
 
 	actionLabels := map[FailureAction]string{
 		ActionRetry:    "Retry task",
-		ActionRollback: "Rollback to last commit",
+		ActionRollback: "Roll back to a task",
 		ActionSkip:     "Skip and continue",
 		ActionAbort:    "Abort run",
 	}
 
 	actionDescs := map[FailureAction]string{
 		ActionRetry:    "Try running the task again",
-		ActionRollback: fmt.Sprintf("Reset to %s and retry", truncateSHA(m.lastGoodSHA)),
+		ActionRollback: "Reset to where a task started and run it and everything after again",
 		ActionSkip:     "Mark as skipped and proceed with next task",
 		ActionAbort:    "Stop execution and save current state",
 	}
@@ -207,6 +271,30 @@ func (m FailureModel) View() string {
 	return boxStyle.Render(b.String())
 }
 
+// targetView renders the rollback target picker
+func (m FailureModel) targetView() string {
+	var b strings.Builder
+
+	b.WriteString("Roll back to the start of which task?\n\n")
+	for i, t := range m.targets {
+		prefix := "  "
+		style := normalStyle
+		if i == m.selectedTarget {
+			prefix = "> "
+			style = selectedStyle
+		}
+		b.WriteString(style.Render(fmt.Sprintf("%s%s %s", prefix, t.ID, t.Title)))
+		b.WriteString(dimStyle.Render(fmt.Sprintf("  %s @ %s", t.Status, truncateSHA(t.BaseSHA))))
+		b.WriteString("\n")
+	}
+
+	b.WriteString("\n")
+	b.WriteString(dimStyle.Render("Later work is saved to a backup ref before the reset."))
+	b.WriteString("\n")
+	b.WriteString(dimStyle.Render("↑/↓ select • Enter to roll back • Esc back"))
+	return b.String()
+}
+
 func truncateSHA(sha string) string {
 	if len(sha) > 7 {
 		return sha[:7]
@@ -0,0 +1,102 @@
+package verify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// maxOutput bounds how much of a command's output is kept, from the end
+const maxOutput = 8 * 1024
+
+// Result is the outcome of one verify command
+type Result struct {
+	Command  string
+	ExitCode int
+	Output   string // Combined stdout and stderr, tail only
+	Duration time.Duration
+	Err      error // Set if the command failed or could not run
+}
+
+// Report is the outcome of running all verify commands
+type Report struct {
+	Results []Result
+}
+
+// Passed reports whether every command succeeded
+func (r *Report) Passed() bool {
+	return r.Failed() == nil
+}
+
+// Failed returns the first failing command, or nil
+func (r *Report) Failed() *Result {
+	for i := range r.Results {
+		if r.Results[i].Err != nil {
+			return &r.Results[i]
+		}
+	}
+	return nil
+}
+
+// Err returns an error describing the failing command, or nil
+func (r *Report) Err() error {
+	failed := r.Failed()
+	if failed == nil {
+		return nil
+	}
+	return fmt.Errorf("verify command %q failed: %w\n%s", failed.Command, failed.Err, failed.Output)
+}
+
+// Run executes commands with sh -c in dir, in order, stopping at the first
+// failure. Each command gets timeout.
+func Run(ctx context.Context, dir string, commands []string, timeout time.Duration) *Report {
+	report := &Report{}
+	for _, command := range commands {
+		result := runOne(ctx, dir, command, timeout)
+		report.Results = append(report.Results, result)
+		if result.Err != nil {
+			break
+		}
+	}
+	return report
+}
+
+// runOne executes a single verify command
+func runOne(ctx context.Context, dir, command string, timeout time.Duration) Result {
+	cmdCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	cmd := exec.CommandContext(cmdCtx, "sh", "-c", command)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+
+	result := Result{
+		Command:  command,
+		Output:   tail(string(output)),
+		Duration: time.Since(start),
+	}
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			result.ExitCode = exitErr.ExitCode()
+		}
+		if cmdCtx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("timed out after %s", timeout)
+		}
+		result.Err = err
+	}
+	return result
+}
+
+// tail keeps the last maxOutput bytes of output
+func tail(output string) string {
+	output = strings.TrimRight(output, "\n")
+	if len(output) <= maxOutput {
+		return output
+	}
+	return "..." + output[len(output)-maxOutput:]
+}
@@ -0,0 +1,107 @@
+package worktree
+
+import (
+	"fmt"
+	"strings"
+
+	aigit "github.com/howell-aikit/aiflow/pkg/git"
+)
+
+// HistoryStrategy selects the commit history a finished run is integrated
+// with
+type HistoryStrategy string
+
+const (
+	HistoryKeep   HistoryStrategy = "keep"   // One commit per task, as executed
+	HistorySquash HistoryStrategy = "squash" // A single commit for the whole run
+	HistoryGroup  HistoryStrategy = "group"  // One commit per parallel group
+)
+
+// HistoryStrategies lists the strategies in the order they are offered
+var HistoryStrategies = []HistoryStrategy{HistoryKeep, HistorySquash, HistoryGroup}
+
+// ParseHistoryStrategy validates a configured history strategy. Empty means
+// keep.
+func ParseHistoryStrategy(s string) (HistoryStrategy, error) {
+	switch HistoryStrategy(s) {
+	case "":
+		return HistoryKeep, nil
+	case HistoryKeep, HistorySquash, HistoryGroup:
+		return HistoryStrategy(s), nil
+	}
+	return "", fmt.Errorf("unknown history strategy %q: use keep, squash or group", s)
+}
+
+// HistorySegment is one commit of a curated history. It takes the tree of
+// Last, the final original commit it replaces.
+type HistorySegment struct {
+	Last    string
+	Message string
+}
+
+// Commits returns the first-parent commits of branch since it forked from
+// base, oldest first, along with the fork point
+func (in *Integrator) Commits(branch, base string) ([]string, string, error) {
+	fork, err := runGit(in.wtPath, "merge-base", base, "refs/heads/"+branch)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to find where %s forked from %s: %w", branch, base, err)
+	}
+	out, err := runGit(in.wtPath, "rev-list", "--reverse", "--first-parent", fork+"..refs/heads/"+branch)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list commits of %s: %w", branch, err)
+	}
+	if out == "" {
+		return nil, fork, nil
+	}
+	return strings.Split(out, "\n"), fork, nil
+}
+
+// HasMerges reports whether the commits between from and to include merges
+func (in *Integrator) HasMerges(from, to string) bool {
+	out, _ := runGit(in.wtPath, "rev-list", "--merges", "-1", from+".."+to)
+	return out != ""
+}
+
+// CommitMessage returns the full message of a commit
+func (in *Integrator) CommitMessage(sha string) (string, error) {
+	msg, err := runGit(in.wtPath, "log", "-1", "--format=%B", sha)
+	if err != nil {
+		return "", fmt.Errorf("failed to read commit %s: %w", sha, err)
+	}
+	return msg, nil
+}
+
+// Curate writes segments as the history of a new branch on top of onto and
+// returns its tip. The run's own branch is left untouched so its per-task
+// history stays available; an earlier curated branch of the same name is
+// replaced. env can carry GIT_AUTHOR_* and GIT_COMMITTER_* identities.
+func (in *Integrator) Curate(branch, onto string, segments []HistorySegment, env []string) (string, error) {
+	if len(segments) == 0 {
+		return "", fmt.Errorf("no commits to curate")
+	}
+
+	parent := onto
+	for _, seg := range segments {
+		args := append(in.sign.Args(), "commit-tree")
+		args = append(args, in.sign.CommitTreeArgs()...)
+		args = append(args, seg.Last+"^{tree}", "-p", parent, "-m", seg.Message)
+		sha, err := runGitEnv(in.wtPath, env, args...)
+		if err != nil {
+			if in.sign.Enabled() {
+				err = fmt.Errorf("%w: %v", aigit.ErrSigning, err)
+			}
+			return "", fmt.Errorf("failed to write curated commit: %w", err)
+		}
+		parent = sha
+	}
+
+	ref := "refs/heads/" + branch
+	if _, err := runGit(in.wtPath, "update-ref", "-m", "aiflow: curate history", ref, parent); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", branch, err)
+	}
+	if _, err := aigit.Resign(in.wtPath, in.sign, ref, onto); err != nil {
+		runGit(in.wtPath, "update-ref", "-d", ref)
+		return "", fmt.Errorf("failed to sign curated history: %w", err)
+	}
+	return runGit(in.wtPath, "rev-parse", ref)
+}
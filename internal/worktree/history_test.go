@@ -0,0 +1,89 @@
+package worktree
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	aigit "github.com/howell-aikit/aiflow/pkg/git"
+)
+
+// testRepo creates a repository with an initial commit on main followed by
+// commits on branch, one per file
+func testRepo(t *testing.T, branch string, files ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		if _, err := runGit(dir, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	git("init", "-q", "-b", "main")
+	git("config", "user.name", "Test")
+	git("config", "user.email", "test@example.com")
+	git("commit", "-q", "--allow-empty", "-m", "initial")
+	git("checkout", "-q", "-b", branch)
+	for _, f := range files {
+		git("commit", "-q", "--allow-empty", "-m", "add "+f)
+	}
+	return dir
+}
+
+func TestCurateSignsWithSSH(t *testing.T) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen not available")
+	}
+
+	dir := testRepo(t, "aiflow/run", "a", "b", "c")
+	key := filepath.Join(t.TempDir(), "id_ed25519")
+	if out, err := exec.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-C", "test", "-f", key).CombinedOutput(); err != nil {
+		t.Fatalf("ssh-keygen: %v: %s", err, out)
+	}
+
+	sign, err := aigit.ResolveSigning(dir, "ssh", key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	in, err := NewIntegrator(dir, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in.SetSigning(sign)
+
+	commits, fork, err := in.Commits("aiflow/run", "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commits) != 3 {
+		t.Fatalf("got %d commits, want 3", len(commits))
+	}
+
+	tip, err := in.Curate("aiflow/run-curated", fork, []HistorySegment{
+		{Last: commits[1], Message: "first two"},
+		{Last: commits[2], Message: "last"},
+	}, nil)
+	if err != nil {
+		t.Fatalf("Curate: %v", err)
+	}
+
+	curated, err := runGit(dir, "rev-list", fork+".."+tip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shas := strings.Split(curated, "\n")
+	if len(shas) != 2 {
+		t.Fatalf("got %d curated commits, want 2", len(shas))
+	}
+	for _, sha := range shas {
+		raw, err := runGit(dir, "cat-file", "commit", sha)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(raw, "\ngpgsig -----BEGIN SSH SIGNATURE-----") {
+			t.Errorf("curated commit %s is not signed:\n%s", sha, raw)
+		}
+	}
+}
@@ -0,0 +1,341 @@
+package worktree
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	aigit "github.com/howell-aikit/aiflow/pkg/git"
+)
+
+// MergeStrategy selects how a feature branch is merged into its base branch
+type MergeStrategy string
+
+const (
+	MergeFastForward MergeStrategy = "ff"
+	MergeNoFF        MergeStrategy = "no-ff"
+	MergeSquash      MergeStrategy = "squash"
+)
+
+// ParseMergeStrategy validates a configured merge strategy. Empty means
+// no-ff, the historical behavior.
+func ParseMergeStrategy(s string) (MergeStrategy, error) {
+	switch MergeStrategy(s) {
+	case "":
+		return MergeNoFF, nil
+	case MergeFastForward, MergeNoFF, MergeSquash:
+		return MergeStrategy(s), nil
+	}
+	return "", fmt.Errorf("unknown merge strategy %q: use ff, no-ff or squash", s)
+}
+
+// Integrator brings a feature branch from a run's worktree into the source
+// repository the run was started from, where it is merged or pushed to the
+// repository's real remote
+type Integrator struct {
+	repoPath string
+	wtPath   string
+	sign     *aigit.Signing
+}
+
+// NewIntegrator creates an integrator for the worktree at wtPath. If
+// repoPath is empty the source repository is derived from the worktree.
+func NewIntegrator(repoPath, wtPath string) (*Integrator, error) {
+	if repoPath == "" {
+		var err error
+		if repoPath, err = SourceRepo(wtPath); err != nil {
+			return nil, err
+		}
+	}
+	return &Integrator{repoPath: repoPath, wtPath: wtPath}, nil
+}
+
+// RepoPath returns the source repository
+func (in *Integrator) RepoPath() string {
+	return in.repoPath
+}
+
+// SetSigning makes merges and syncs sign the commits they create. Without
+// it git's own config decides.
+func (in *Integrator) SetSigning(s *aigit.Signing) {
+	in.sign = s
+}
+
+// git runs a git command that may create commits, signing them as
+// configured
+func (in *Integrator) git(dir string, args ...string) (string, error) {
+	return runGit(dir, append(in.sign.Args(), args...)...)
+}
+
+// SourceRepo returns the repository a worktree belongs to: the main
+// working tree for linked worktrees, or the local origin of clone-based
+// worktrees from earlier versions. Runs record their source repository, so
+// this is only needed for runs that predate that.
+func SourceRepo(wtPath string) (string, error) {
+	if IsLinked(wtPath) {
+		common, err := runGit(wtPath, "rev-parse", "--path-format=absolute", "--git-common-dir")
+		if err != nil {
+			return "", fmt.Errorf("failed to find source repository: %w", err)
+		}
+		// Submodules and other git dirs outside their working tree name it
+		// in core.worktree
+		if _, err := runGit(wtPath, "--git-dir="+common, "config", "core.worktree"); err == nil {
+			root, err := runGit(wtPath, "--git-dir="+common, "rev-parse", "--show-toplevel")
+			if err != nil {
+				return "", fmt.Errorf("failed to find source repository: %w", err)
+			}
+			return root, nil
+		}
+		if filepath.Base(common) != ".git" {
+			return "", fmt.Errorf("cannot tell which working tree uses %s; the run does not record its source repository", common)
+		}
+		return filepath.Dir(common), nil
+	}
+
+	if url, err := runGit(wtPath, "remote", "get-url", "origin"); err == nil {
+		if info, err := os.Stat(url); err == nil && info.IsDir() {
+			return url, nil
+		}
+	}
+	// Runs started with --no-worktree work in the repository itself
+	return wtPath, nil
+}
+
+// FeatureBranch returns the branch checked out in the worktree
+func (in *Integrator) FeatureBranch() (string, error) {
+	branch, err := runGit(in.wtPath, "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return "", fmt.Errorf("failed to get branch: %w", err)
+	}
+	if branch == "HEAD" {
+		return "", fmt.Errorf("worktree %s is not on a branch", in.wtPath)
+	}
+	return branch, nil
+}
+
+// Fetch makes the worktree's tip of branch available in the source
+// repository and returns its SHA. Linked worktrees already share refs with
+// the source; clone-based worktrees are fetched from.
+func (in *Integrator) Fetch(branch string) (string, error) {
+	tip, err := runGit(in.wtPath, "rev-parse", "--verify", "-q", "refs/heads/"+branch)
+	if err != nil {
+		return "", fmt.Errorf("branch %s not found in the worktree", branch)
+	}
+
+	if !IsLinked(in.wtPath) && !samePath(in.wtPath, in.repoPath) {
+		refspec := fmt.Sprintf("+refs/heads/%s:refs/heads/%s", branch, branch)
+		if _, err := runGit(in.repoPath, "fetch", "--no-tags", in.wtPath, refspec); err != nil {
+			return "", fmt.Errorf("failed to fetch %s into %s: %w", branch, in.repoPath, err)
+		}
+	}
+
+	got, err := runGit(in.repoPath, "rev-parse", "--verify", "-q", "refs/heads/"+branch)
+	if err != nil || got != tip {
+		return "", fmt.Errorf("branch %s in %s does not match the worktree (%s)", branch, in.repoPath, tip)
+	}
+	return tip, nil
+}
+
+// Merge merges branch into base inside the source repository using
+// strategy, verifies the result and returns the new tip of base. The merge
+// happens in the working tree that has base checked out, which must be
+// clean, or in a temporary worktree if base is not checked out anywhere.
+func (in *Integrator) Merge(branch, base string, strategy MergeStrategy, message string) (string, error) {
+	tip, err := in.Fetch(branch)
+	if err != nil {
+		return "", err
+	}
+	oldBase, err := in.baseBranchTip(base)
+	if err != nil {
+		return "", err
+	}
+
+	// Nothing to do if base already contains the feature
+	if _, err := runGit(in.repoPath, "merge-base", "--is-ancestor", tip, oldBase); err == nil {
+		return oldBase, nil
+	}
+
+	dir, cleanup, err := in.checkout(base)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+
+	switch strategy {
+	case MergeFastForward:
+		_, err = runGit(dir, "merge", "--ff-only", branch)
+	case MergeSquash:
+		if _, err = runGit(dir, "merge", "--squash", branch); err == nil {
+			_, err = in.git(dir, "commit", "-m", message)
+		}
+	default:
+		_, err = in.git(dir, "merge", "--no-ff", "-m", message, branch)
+	}
+	if err != nil {
+		// Leave the base branch as it was
+		runGit(dir, "merge", "--abort")
+		runGit(dir, "reset", "--merge")
+		if in.sign.Enabled() && strategy != MergeFastForward {
+			err = fmt.Errorf("%w: %v", aigit.ErrSigning, err)
+		}
+		return "", fmt.Errorf("failed to merge %s into %s (%s): %w", branch, base, strategy, err)
+	}
+	if strategy != MergeFastForward {
+		if _, err := aigit.Resign(dir, in.sign, "HEAD", ""); err != nil {
+			runGit(dir, "reset", "--hard", "-q", oldBase)
+			return "", fmt.Errorf("failed to sign the merge of %s into %s: %w", branch, base, err)
+		}
+	}
+
+	newBase, err := runGit(in.repoPath, "rev-parse", "refs/heads/"+base)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s after merge: %w", base, err)
+	}
+	if err := in.verifyMerge(strategy, oldBase, newBase, tip); err != nil {
+		return "", fmt.Errorf("merge verification failed: %w", err)
+	}
+	return newBase, nil
+}
+
+// baseBranchTip returns the commit of the local branch a direct merge moves.
+// Tags, commits and remote-tracking branches are valid bases for a run but
+// have no branch to merge into.
+func (in *Integrator) baseBranchTip(base string) (string, error) {
+	if sha, err := runGit(in.repoPath, "rev-parse", "--verify", "-q", "refs/heads/"+base); err == nil {
+		return sha, nil
+	}
+	if _, err := runGit(in.repoPath, "rev-parse", "--verify", "-q", base+"^{commit}"); err == nil {
+		return "", fmt.Errorf("base %s is not a local branch, so there is nothing to merge into; create a pull request or merge the run's branch yourself", base)
+	}
+	return "", fmt.Errorf("base branch %s does not exist in %s", base, in.repoPath)
+}
+
+// verifyMerge checks that base now contains the feature branch as the
+// strategy promises
+func (in *Integrator) verifyMerge(strategy MergeStrategy, oldBase, newBase, tip string) error {
+	parent := func(n int) string {
+		sha, _ := runGit(in.repoPath, "rev-parse", fmt.Sprintf("%s^%d", newBase, n))
+		return sha
+	}
+
+	switch strategy {
+	case MergeFastForward:
+		if newBase != tip {
+			return fmt.Errorf("base is at %s, expected %s", newBase, tip)
+		}
+	case MergeSquash:
+		if parent(1) != oldBase {
+			return fmt.Errorf("squash commit %s does not follow %s", newBase, oldBase)
+		}
+		// Without concurrent changes on base the squash must reproduce the
+		// feature tree exactly
+		if _, err := runGit(in.repoPath, "merge-base", "--is-ancestor", oldBase, tip); err == nil {
+			if _, err := runGit(in.repoPath, "diff", "--quiet", newBase, tip); err != nil {
+				return fmt.Errorf("squash commit %s differs from %s", newBase, tip)
+			}
+		}
+	default:
+		if parent(1) != oldBase || parent(2) != tip {
+			return fmt.Errorf("merge commit %s does not join %s and %s", newBase, oldBase, tip)
+		}
+	}
+	return nil
+}
+
+// checkout returns a clean working tree with base checked out, and a
+// function that removes it again if it was created for the merge
+func (in *Integrator) checkout(base string) (string, func(), error) {
+	noop := func() {}
+
+	if dir := in.findCheckout(base); dir != "" {
+		status, err := runGit(dir, "status", "--porcelain", "--untracked-files=no")
+		if err != nil {
+			return "", noop, fmt.Errorf("failed to check status of %s: %w", dir, err)
+		}
+		if status != "" {
+			return "", noop, fmt.Errorf("%s has %s checked out with uncommitted changes; commit or stash them first", dir, base)
+		}
+		return dir, noop, nil
+	}
+
+	tmpDir, err := os.MkdirTemp("", "aiflow-merge-")
+	if err != nil {
+		return "", noop, fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	dir := filepath.Join(tmpDir, "wt")
+	if _, err := runGit(in.repoPath, "worktree", "add", dir, base); err != nil {
+		os.RemoveAll(tmpDir)
+		return "", noop, fmt.Errorf("failed to check out %s: %w", base, err)
+	}
+	return dir, func() {
+		runGit(in.repoPath, "worktree", "remove", "--force", dir)
+		os.RemoveAll(tmpDir)
+		runGit(in.repoPath, "worktree", "prune")
+	}, nil
+}
+
+// findCheckout returns the working tree of the source repository that has
+// branch checked out, if any
+func (in *Integrator) findCheckout(branch string) string {
+	out, err := runGit(in.repoPath, "worktree", "list", "--porcelain")
+	if err != nil {
+		return ""
+	}
+
+	var dir string
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "worktree "):
+			dir = strings.TrimPrefix(line, "worktree ")
+		case line == "branch refs/heads/"+branch:
+			return dir
+		}
+	}
+	return ""
+}
+
+// Push pushes branch from the source repository to remote and verifies
+// that the remote now has the worktree's tip
+func (in *Integrator) Push(branch, remote string) error {
+	tip, err := in.Fetch(branch)
+	if err != nil {
+		return err
+	}
+
+	if _, err := runGit(in.repoPath, "push", "-u", remote, branch); err != nil {
+		return fmt.Errorf("failed to push %s to %s: %w", branch, remote, err)
+	}
+
+	out, err := runGit(in.repoPath, "ls-remote", remote, "refs/heads/"+branch)
+	if err != nil {
+		return fmt.Errorf("failed to verify push: %w", err)
+	}
+	if fields := strings.Fields(out); len(fields) == 0 || fields[0] != tip {
+		return fmt.Errorf("push verification failed: %s on %s is not at %s", branch, remote, tip)
+	}
+	return nil
+}
+
+// samePath reports whether two paths name the same directory
+func samePath(a, b string) bool {
+	ra, errA := filepath.EvalSymlinks(a)
+	rb, errB := filepath.EvalSymlinks(b)
+	if errA != nil || errB != nil {
+		return filepath.Clean(a) == filepath.Clean(b)
+	}
+	return ra == rb
+}
+
+// runGit runs a git command in dir and returns its trimmed output
+func runGit(dir string, args ...string) (string, error) {
+	return aigit.Run(dir, args...)
+}
+
+// runGitEnv runs a git command in dir with extra environment variables
+func runGitEnv(dir string, env []string, args ...string) (string, error) {
+	return aigit.RunEnv(dir, env, args...)
+}
@@ -8,15 +8,14 @@ import (
 	"strings"
 	"time"
 
-	"github.com/go-git/go-git/v5"
-	"github.com/go-git/go-git/v5/plumbing"
+	aigit "github.com/howell-aikit/aiflow/pkg/git"
 )
 
 // Manager handles git worktree operations
 type Manager struct {
 	repoPath    string
 	worktreeDir string
-	repo        *git.Repository
+	relDir      string // worktreeDir as configured, relative to the repo
 }
 
 // WorktreeInfo contains information about a worktree
@@ -25,12 +24,26 @@ type WorktreeInfo struct {
 	Branch    string
 	FeatureID string
 	CreatedAt time.Time
+	Linked    bool // False for clone-based worktrees from earlier versions
+}
+
+// ManagedExcludes returns gitignore-style patterns for the files and
+// directories aiflow writes into a working tree. These never belong in
+// task commits.
+func ManagedExcludes(worktreeDir string) []string {
+	patterns := []string{
+		"/.aiflow-locks/",
+		"/.aiflow-prompt-*.md",
+	}
+	if dir := strings.Trim(filepath.ToSlash(worktreeDir), "/"); dir != "" && !filepath.IsAbs(worktreeDir) {
+		patterns = append(patterns, "/"+dir+"/")
+	}
+	return patterns
 }
 
 // NewManager creates a new worktree manager
 func NewManager(repoPath, worktreeDir string) (*Manager, error) {
-	repo, err := git.PlainOpen(repoPath)
-	if err != nil {
+	if _, err := aigit.Open(repoPath); err != nil {
 		return nil, fmt.Errorf("failed to open repository: %w", err)
 	}
 
@@ -43,7 +56,7 @@ func NewManager(repoPath, worktreeDir string) (*Manager, error) {
 	return &Manager{
 		repoPath:    repoPath,
 		worktreeDir: wtDir,
-		repo:        repo,
+		relDir:      worktreeDir,
 	}, nil
 }
 
@@ -63,61 +76,89 @@ func slugify(s string) string {
 	return s
 }
 
-// Create creates a new worktree for a feature by cloning the repo
-func (m *Manager) Create(featureDesc, baseBranch string) (string, error) {
+// Create adds a linked git worktree for a feature on a new aiflow/<name>
+// branch starting at baseRev, which may be any revision git resolves to a
+// commit. It shares the object store and refs of the source repository, so
+// the feature branch is visible there without any fetching. Submodules and
+// LFS files are left for Prepare.
+func (m *Manager) Create(featureDesc, baseRev string) (string, error) {
 	slug := slugify(featureDesc)
 	timestamp := time.Now().Format("20060102-150405")
 	wtName := fmt.Sprintf("%s-%s", slug, timestamp)
 	wtPath := filepath.Join(m.worktreeDir, wtName)
 
-	// Get the base branch reference
-	branchRef := plumbing.NewBranchReferenceName(baseBranch)
-	ref, err := m.repo.Reference(branchRef, true)
+	base, err := m.git("rev-parse", "--verify", "-q", baseRev+"^{commit}")
 	if err != nil {
-		// Try remote branch
-		remoteRef := plumbing.NewRemoteReferenceName("origin", baseBranch)
-		ref, err = m.repo.Reference(remoteRef, true)
-		if err != nil {
-			return "", fmt.Errorf("branch %s not found: %w", baseBranch, err)
-		}
+		return "", fmt.Errorf("base %s not found: %w", baseRev, err)
 	}
 
-	// Create worktree directory
-	if err := os.MkdirAll(wtPath, 0755); err != nil {
-		return "", fmt.Errorf("failed to create worktree directory: %w", err)
+	// LFS content is checked out by Prepare, from the local store only
+	featureBranch := fmt.Sprintf("aiflow/%s", wtName)
+	env := []string{"GIT_LFS_SKIP_SMUDGE=1"}
+	if _, err := runGitEnv(m.repoPath, env, "worktree", "add", "-b", featureBranch, wtPath, base); err != nil {
+		os.RemoveAll(wtPath)
+		m.git("worktree", "prune")
+		return "", fmt.Errorf("failed to add worktree: %w", err)
 	}
 
-	// Clone the repository to the worktree path
-	wtRepo, err := git.PlainClone(wtPath, false, &git.CloneOptions{
-		URL:           m.repoPath,
-		ReferenceName: ref.Name(),
-		SingleBranch:  true,
-	})
-	if err != nil {
-		os.RemoveAll(wtPath)
-		return "", fmt.Errorf("failed to clone for worktree: %w", err)
+	// Keep aiflow's own files out of git status and commits
+	if repo, err := aigit.Open(wtPath); err == nil {
+		repo.EnsureExcludes(ManagedExcludes(m.relDir))
 	}
 
-	// Create and checkout feature branch
-	featureBranch := fmt.Sprintf("aiflow/%s", wtName)
-	wt, err := wtRepo.Worktree()
-	if err != nil {
+	return wtPath, nil
+}
+
+// CreateScratch adds a throwaway linked worktree named name with rev
+// checked out on a detached HEAD, for running a task away from the run's
+// own worktree. A non-empty sparse cone is applied before anything is
+// checked out. Remove it with Remove; its commits are only kept alive by
+// the refs the caller points at them.
+func (m *Manager) CreateScratch(name, rev string, sparse []string) (string, error) {
+	wtPath := filepath.Join(m.worktreeDir, name)
+	env := []string{"GIT_LFS_SKIP_SMUDGE=1"}
+	fail := func(err error) (string, error) {
 		os.RemoveAll(wtPath)
-		return "", fmt.Errorf("failed to get worktree: %w", err)
+		m.git("worktree", "prune")
+		return "", fmt.Errorf("failed to add scratch worktree: %w", err)
 	}
 
-	err = wt.Checkout(&git.CheckoutOptions{
-		Branch: plumbing.NewBranchReferenceName(featureBranch),
-		Create: true,
-	})
-	if err != nil {
-		os.RemoveAll(wtPath)
-		return "", fmt.Errorf("failed to checkout feature branch: %w", err)
+	if len(sparse) == 0 {
+		if _, err := runGitEnv(m.repoPath, env, "worktree", "add", "--detach", wtPath, rev); err != nil {
+			return fail(err)
+		}
+	} else {
+		if _, err := runGitEnv(m.repoPath, env, "worktree", "add", "--no-checkout", "--detach", wtPath, rev); err != nil {
+			return fail(err)
+		}
+		args := append([]string{"sparse-checkout", "set", "--cone", "--"}, sparse...)
+		if _, err := runGit(wtPath, args...); err != nil {
+			return fail(err)
+		}
+		if _, err := runGitEnv(wtPath, env, "checkout", "-q", "--detach", rev); err != nil {
+			return fail(err)
+		}
+	}
+
+	if repo, err := aigit.Open(wtPath); err == nil {
+		repo.EnsureExcludes(ManagedExcludes(m.relDir))
 	}
 
 	return wtPath, nil
 }
 
+// IsLinked reports whether the worktree at wtPath is a linked git worktree
+// rather than a clone made by earlier versions of aiflow
+func IsLinked(wtPath string) bool {
+	info, err := os.Stat(filepath.Join(wtPath, ".git"))
+	return err == nil && !info.IsDir()
+}
+
+// git runs a git command in the source repository
+func (m *Manager) git(args ...string) (string, error) {
+	return runGit(m.repoPath, args...)
+}
+
 // List returns all aiflow worktrees
 func (m *Manager) List() ([]WorktreeInfo, error) {
 	entries, err := os.ReadDir(m.worktreeDir)
@@ -142,12 +183,10 @@ func (m *Manager) List() ([]WorktreeInfo, error) {
 
 		// Try to get branch info
 		branch := ""
-		wtRepo, err := git.PlainOpen(wtPath)
-		if err == nil {
-			head, err := wtRepo.Head()
-			if err == nil {
-				branch = head.Name().Short()
-			}
+		if !aigit.IsGitRepo(wtPath) {
+			// Not a worktree; don't report the enclosing repository's branch
+		} else if wtRepo, err := aigit.Open(wtPath); err == nil {
+			branch, _ = wtRepo.CurrentBranch()
 		}
 
 		worktrees = append(worktrees, WorktreeInfo{
@@ -155,6 +194,7 @@ func (m *Manager) List() ([]WorktreeInfo, error) {
 			Branch:    branch,
 			FeatureID: entry.Name(),
 			CreatedAt: info.ModTime(),
+			Linked:    IsLinked(wtPath),
 		})
 	}
 
@@ -168,9 +208,19 @@ func (m *Manager) Remove(wtPath string) error {
 		return fmt.Errorf("path is not within worktree directory")
 	}
 
+	// Linked worktrees are unregistered from the source repository; their
+	// aiflow/<name> branch is kept
+	if IsLinked(wtPath) {
+		if _, err := m.git("worktree", "remove", "--force", wtPath); err == nil {
+			return nil
+		}
+		// Fall through: delete the directory and prune the registration
+	}
+
 	if err := os.RemoveAll(wtPath); err != nil {
 		return fmt.Errorf("failed to remove worktree: %w", err)
 	}
+	m.git("worktree", "prune")
 
 	return nil
 }
@@ -194,6 +244,11 @@ func (m *Manager) Prune() error {
 		}
 	}
 
+	// Drop registrations of linked worktrees whose directories are gone
+	if _, err := m.git("worktree", "prune"); err != nil {
+		return fmt.Errorf("failed to prune worktrees: %w", err)
+	}
+
 	return nil
 }
 
@@ -0,0 +1,155 @@
+package worktree
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SetupOptions selects what Prepare materializes in a new worktree
+type SetupOptions struct {
+	Submodules bool // Initialize submodules recursively
+	LFS        bool // Replace LFS pointer files with their content
+}
+
+// SetupReport describes what Prepare did and what it had to leave out
+type SetupReport struct {
+	Submodules []string // Submodule paths that were initialized
+	LFSFiles   int      // LFS files checked out from the local store
+	Skipped    []string // Human-readable notes on what was not set up
+}
+
+// Prepare initializes the submodules and LFS content of a worktree made by
+// Create. Submodules are initialized recursively, from the source
+// repository's own checkouts when it has them. LFS objects only come from
+// the local LFS store. Problems are reported in Skipped rather than
+// failing the run.
+func (m *Manager) Prepare(wtPath string, opts SetupOptions) *SetupReport {
+	report := &SetupReport{}
+
+	if _, err := os.Stat(filepath.Join(wtPath, ".gitmodules")); err == nil {
+		if opts.Submodules {
+			m.initSubmodules(m.repoPath, wtPath, "", report)
+		} else {
+			report.Skipped = append(report.Skipped, "submodules: disabled by worktree.submodules")
+		}
+	}
+
+	if usesLFS(wtPath) {
+		if opts.LFS {
+			checkoutLFS(wtPath, report)
+		} else {
+			report.Skipped = append(report.Skipped, "LFS files: disabled by worktree.lfs; pointer files left in place")
+		}
+	}
+
+	return report
+}
+
+// initSubmodules initializes the submodules of wtPath one level at a time,
+// recursing into each. A submodule is cloned from srcPath's checkout of it
+// when there is one, otherwise from the URL srcPath resolved for it.
+func (m *Manager) initSubmodules(srcPath, wtPath, prefix string, report *SetupReport) {
+	out, err := runGit(wtPath, "config", "-f", ".gitmodules", "--get-regexp", `^submodule\..*\.path$`)
+	if err != nil {
+		report.Skipped = append(report.Skipped, fmt.Sprintf("submodules of %s: failed to read .gitmodules", wtPath))
+		return
+	}
+
+	for _, line := range strings.Split(out, "\n") {
+		key, path, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(key, "submodule."), ".path")
+		urlKey := fmt.Sprintf("submodule.%s.url", name)
+
+		if _, err := runGit(wtPath, "submodule", "init", "--", path); err != nil {
+			report.Skipped = append(report.Skipped, fmt.Sprintf("submodule %s%s: %s", prefix, path, lastLine(err)))
+			continue
+		}
+		local := filepath.Join(srcPath, path)
+		if hasGitDir(local) {
+			runGit(wtPath, "config", urlKey, local)
+		} else if url, err := runGit(srcPath, "config", "--get", urlKey); err == nil {
+			runGit(wtPath, "config", urlKey, url)
+		}
+
+		if _, err := runGit(wtPath, "-c", "protocol.file.allow=always", "submodule", "update", "--init", "--", path); err != nil {
+			report.Skipped = append(report.Skipped, fmt.Sprintf("submodule %s%s: %s", prefix, path, lastLine(err)))
+			continue
+		}
+		report.Submodules = append(report.Submodules, prefix+path)
+
+		if _, err := os.Stat(filepath.Join(wtPath, path, ".gitmodules")); err == nil {
+			m.initSubmodules(local, filepath.Join(wtPath, path), prefix+path+"/", report)
+		}
+	}
+}
+
+// lastLine returns the last line of an error, where git puts the reason
+func lastLine(err error) string {
+	msg := strings.TrimSpace(err.Error())
+	if i := strings.LastIndex(msg, "\n"); i >= 0 {
+		return msg[i+1:]
+	}
+	return msg
+}
+
+// hasGitDir reports whether dir is a checked out repository
+func hasGitDir(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, ".git"))
+	return err == nil
+}
+
+// usesLFS reports whether any .gitattributes in the worktree routes files
+// through the LFS filter
+func usesLFS(wtPath string) bool {
+	out, err := runGit(wtPath, "ls-files", "--", ":(glob)**/.gitattributes")
+	if err != nil || out == "" {
+		return false
+	}
+	for _, file := range strings.Split(out, "\n") {
+		data, err := os.ReadFile(filepath.Join(wtPath, file))
+		if err == nil && strings.Contains(string(data), "filter=lfs") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkoutLFS smudges LFS pointer files from the local LFS store, which
+// linked worktrees share with the source repository
+func checkoutLFS(wtPath string, report *SetupReport) {
+	if _, err := runGit(wtPath, "lfs", "version"); err != nil {
+		report.Skipped = append(report.Skipped, "LFS files: git-lfs is not installed; pointer files left in place")
+		return
+	}
+	if _, err := runGit(wtPath, "lfs", "checkout"); err != nil {
+		report.Skipped = append(report.Skipped, fmt.Sprintf("LFS files: %v", err))
+		return
+	}
+
+	// ls-files marks files whose content is present with * and pointers
+	// with -
+	out, err := runGit(wtPath, "lfs", "ls-files")
+	if err != nil {
+		return
+	}
+	var missing []string
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+		if fields[1] == "*" {
+			report.LFSFiles++
+		} else {
+			missing = append(missing, strings.Join(fields[2:], " "))
+		}
+	}
+	if len(missing) > 0 {
+		report.Skipped = append(report.Skipped, fmt.Sprintf("LFS files not in the local store (run git lfs fetch): %s", strings.Join(missing, ", ")))
+	}
+}
@@ -0,0 +1,378 @@
+package worktree
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	aigit "github.com/howell-aikit/aiflow/pkg/git"
+)
+
+// SyncMode selects how a run's branch takes in its updated base branch
+type SyncMode string
+
+const (
+	SyncRebase SyncMode = "rebase"
+	SyncMerge  SyncMode = "merge"
+)
+
+// ParseSyncMode validates a configured sync mode. Empty means rebase.
+func ParseSyncMode(s string) (SyncMode, error) {
+	switch SyncMode(s) {
+	case "":
+		return SyncRebase, nil
+	case SyncRebase, SyncMerge:
+		return SyncMode(s), nil
+	}
+	return "", fmt.Errorf("unknown sync mode %q: use rebase or merge", s)
+}
+
+// ErrSyncConflict is returned when a sync stops on conflicts that were not
+// resolved. The worktree is left as it was before the sync.
+var ErrSyncConflict = errors.New("sync stopped on conflicts")
+
+// maxConflictRounds bounds how many conflicted rebase steps are handed to
+// the resolver
+const maxConflictRounds = 50
+
+// ConflictResolver edits the conflicted files left in the worktree until
+// they are resolved. Sync stages them and continues.
+type ConflictResolver func(files []string) error
+
+// SyncResult describes a sync of a run's branch with its base
+type SyncResult struct {
+	Mode      SyncMode
+	BaseRef   string // Ref the base was taken from, local or remote-tracking
+	BaseSHA   string
+	OldHead   string
+	NewHead   string
+	UpToDate  bool
+	Conflicts []string          // Every file that conflicted along the way
+	Resolved  bool              // Conflicts were resolved by the resolver
+	Rewritten map[string]string // Old commit SHA -> new SHA after a rebase
+}
+
+// Sync brings the worktree's branch up to date with base, by rebasing its
+// commits onto it or merging it in. base is fetched from remote in the
+// source repository first when possible. Conflicts are handed to resolve;
+// without a resolver, or if it fails, the sync is aborted and
+// ErrSyncConflict returned.
+func (in *Integrator) Sync(base string, mode SyncMode, remote string, resolve ConflictResolver) (*SyncResult, error) {
+	result := &SyncResult{Mode: mode, Rewritten: make(map[string]string)}
+
+	ref, sha, err := in.latestBase(base, remote)
+	if err != nil {
+		return nil, err
+	}
+	result.BaseRef, result.BaseSHA = ref, sha
+
+	// Clone-based worktrees don't share objects with the source
+	if !IsLinked(in.wtPath) && !samePath(in.wtPath, in.repoPath) {
+		if _, err := runGit(in.wtPath, "fetch", "--no-tags", in.repoPath, ref); err != nil {
+			return nil, fmt.Errorf("failed to fetch %s into the worktree: %w", base, err)
+		}
+	}
+
+	status, err := runGit(in.wtPath, "status", "--porcelain", "--untracked-files=no")
+	if err != nil {
+		return nil, fmt.Errorf("failed to check worktree status: %w", err)
+	}
+	if status != "" {
+		return nil, fmt.Errorf("worktree %s has uncommitted changes; commit or discard them before syncing", in.wtPath)
+	}
+
+	if result.OldHead, err = runGit(in.wtPath, "rev-parse", "HEAD"); err != nil {
+		return nil, fmt.Errorf("failed to resolve worktree HEAD: %w", err)
+	}
+	if _, err := runGit(in.wtPath, "merge-base", "--is-ancestor", sha, result.OldHead); err == nil {
+		result.UpToDate = true
+		result.NewHead = result.OldHead
+		return result, nil
+	}
+
+	var before []commitInfo
+	if mode == SyncRebase {
+		if before, err = in.commitsSince(sha, result.OldHead); err != nil {
+			return nil, err
+		}
+		err = in.rebase(sha, result, resolve)
+	} else {
+		err = in.merge(base, sha, result, resolve)
+	}
+	if err != nil {
+		return result, err
+	}
+
+	// git could not sign the new commits itself with a keyring
+	since := sha
+	if mode == SyncMerge {
+		since = ""
+	}
+	if _, err := aigit.Resign(in.wtPath, in.sign, "HEAD", since); err != nil {
+		in.ResetTo(result.OldHead)
+		return result, fmt.Errorf("failed to sign synced commits: %w", err)
+	}
+
+	if result.NewHead, err = runGit(in.wtPath, "rev-parse", "HEAD"); err != nil {
+		return result, fmt.Errorf("failed to resolve worktree HEAD: %w", err)
+	}
+	if mode == SyncRebase {
+		after, err := in.commitsSince(sha, result.NewHead)
+		if err != nil {
+			return result, err
+		}
+		result.Rewritten = matchRewritten(before, after)
+	}
+
+	return result, nil
+}
+
+// ResetTo moves the worktree's branch back to sha, discarding what a sync
+// did
+func (in *Integrator) ResetTo(sha string) error {
+	if _, err := runGit(in.wtPath, "reset", "--hard", "-q", sha); err != nil {
+		return fmt.Errorf("failed to reset worktree to %s: %w", sha, err)
+	}
+	return nil
+}
+
+// latestBase returns the newest known state of base in the source
+// repository. Branches use their remote-tracking branch after a fetch if
+// that is ahead of the local branch, otherwise the local branch. Remote
+// branches of any remote (upstream/release-1.4) are fetched from that
+// remote. Tags and commit SHAs stay where they are.
+func (in *Integrator) latestBase(base, remote string) (string, string, error) {
+	localRef := "refs/heads/" + base
+	local, localErr := runGit(in.repoPath, "rev-parse", "--verify", "-q", localRef)
+	if localErr != nil {
+		if name, branch, ok := in.remoteBranch(base); ok {
+			return in.fetchBase(name, branch)
+		}
+	}
+
+	remoteRef, upstream, upstreamErr := in.fetchBase(remote, base)
+	switch {
+	case localErr != nil && upstreamErr != nil:
+		sha, err := runGit(in.repoPath, "rev-parse", "--verify", "-q", base+"^{commit}")
+		if err != nil {
+			return "", "", fmt.Errorf("base %s not found in %s", base, in.repoPath)
+		}
+		return base, sha, nil
+	case localErr != nil:
+		return remoteRef, upstream, nil
+	case upstreamErr != nil:
+		return localRef, local, nil
+	}
+
+	if _, err := runGit(in.repoPath, "merge-base", "--is-ancestor", local, upstream); err == nil && local != upstream {
+		return remoteRef, upstream, nil
+	}
+	return localRef, local, nil
+}
+
+// fetchBase updates the remote-tracking branch of base from remote and
+// returns it. Offline or without such a remote, what we have is used.
+func (in *Integrator) fetchBase(remote, base string) (string, string, error) {
+	remoteRef := fmt.Sprintf("refs/remotes/%s/%s", remote, base)
+	if remote != "" {
+		runGit(in.repoPath, "fetch", "--no-tags", remote, fmt.Sprintf("+refs/heads/%s:%s", base, remoteRef))
+	}
+	sha, err := runGit(in.repoPath, "rev-parse", "--verify", "-q", remoteRef)
+	if err != nil {
+		return "", "", fmt.Errorf("base %s/%s not found in %s", remote, base, in.repoPath)
+	}
+	return remoteRef, sha, nil
+}
+
+// remoteBranch splits a base like upstream/release-1.4 into a configured
+// remote and its branch
+func (in *Integrator) remoteBranch(base string) (string, string, bool) {
+	name, branch, ok := strings.Cut(base, "/")
+	if !ok || branch == "" {
+		return "", "", false
+	}
+	remotes, err := runGit(in.repoPath, "remote")
+	if err != nil {
+		return "", "", false
+	}
+	for _, r := range strings.Split(remotes, "\n") {
+		if r == name {
+			return name, branch, true
+		}
+	}
+	return "", "", false
+}
+
+// rebase replays the worktree's commits onto sha, resolving conflicts
+// step by step
+func (in *Integrator) rebase(sha string, result *SyncResult, resolve ConflictResolver) error {
+	_, err := in.git(in.wtPath, "-c", "core.editor=true", "rebase", sha)
+	for round := 0; err != nil; round++ {
+		conflicts := in.unmerged()
+		if len(conflicts) == 0 {
+			// An earlier resolution can leave a step with nothing to commit
+			if msg := err.Error(); strings.Contains(msg, "skip this patch") || strings.Contains(msg, "nothing to commit") {
+				_, err = in.git(in.wtPath, "-c", "core.editor=true", "rebase", "--skip")
+				continue
+			}
+			runGit(in.wtPath, "rebase", "--abort")
+			return fmt.Errorf("failed to rebase onto %s: %w", sha, err)
+		}
+
+		result.Conflicts = appendUnique(result.Conflicts, conflicts...)
+		if resolve == nil || round >= maxConflictRounds {
+			runGit(in.wtPath, "rebase", "--abort")
+			return fmt.Errorf("%w in %s", ErrSyncConflict, strings.Join(conflicts, ", "))
+		}
+		if rerr := in.resolveConflicts(conflicts, resolve); rerr != nil {
+			runGit(in.wtPath, "rebase", "--abort")
+			return rerr
+		}
+		result.Resolved = true
+		_, err = in.git(in.wtPath, "-c", "core.editor=true", "rebase", "--continue")
+	}
+	return nil
+}
+
+// merge merges sha into the worktree's branch, resolving conflicts once
+func (in *Integrator) merge(base, sha string, result *SyncResult, resolve ConflictResolver) error {
+	message := fmt.Sprintf("aiflow: sync with %s", base)
+	_, err := in.git(in.wtPath, "merge", "--no-ff", "-m", message, sha)
+	if err == nil {
+		return nil
+	}
+
+	conflicts := in.unmerged()
+	if len(conflicts) == 0 {
+		runGit(in.wtPath, "merge", "--abort")
+		return fmt.Errorf("failed to merge %s: %w", base, err)
+	}
+
+	result.Conflicts = appendUnique(result.Conflicts, conflicts...)
+	if resolve == nil {
+		runGit(in.wtPath, "merge", "--abort")
+		return fmt.Errorf("%w in %s", ErrSyncConflict, strings.Join(conflicts, ", "))
+	}
+	if err := in.resolveConflicts(conflicts, resolve); err != nil {
+		runGit(in.wtPath, "merge", "--abort")
+		return err
+	}
+	result.Resolved = true
+
+	if _, err := in.git(in.wtPath, "commit", "--no-edit"); err != nil {
+		runGit(in.wtPath, "merge", "--abort")
+		return fmt.Errorf("failed to commit merge: %w", err)
+	}
+	return nil
+}
+
+// resolveConflicts runs the resolver, checks that no conflict markers are
+// left and stages the files
+func (in *Integrator) resolveConflicts(files []string, resolve ConflictResolver) error {
+	if err := resolve(files); err != nil {
+		return fmt.Errorf("conflict resolution failed: %w", err)
+	}
+
+	var marked []string
+	for _, f := range files {
+		if hasConflictMarkers(filepath.Join(in.wtPath, f)) {
+			marked = append(marked, f)
+		}
+	}
+	if len(marked) > 0 {
+		return fmt.Errorf("%w: conflict markers remain in %s", ErrSyncConflict, strings.Join(marked, ", "))
+	}
+
+	args := append([]string{"add", "-A", "--"}, files...)
+	if _, err := runGit(in.wtPath, args...); err != nil {
+		return fmt.Errorf("failed to stage resolved files: %w", err)
+	}
+	if left := in.unmerged(); len(left) > 0 {
+		return fmt.Errorf("%w: still unmerged: %s", ErrSyncConflict, strings.Join(left, ", "))
+	}
+	return nil
+}
+
+// hasConflictMarkers reports whether a file still contains conflict
+// markers. Deleted files have none.
+func hasConflictMarkers(path string) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "<<<<<<< ") || strings.HasPrefix(line, ">>>>>>> ") || line == "=======" {
+			return true
+		}
+	}
+	return false
+}
+
+// unmerged returns the files with unresolved conflicts
+func (in *Integrator) unmerged() []string {
+	out, err := runGit(in.wtPath, "diff", "--name-only", "-z", "--diff-filter=U")
+	if err != nil {
+		return nil
+	}
+	return strings.FieldsFunc(out, func(c rune) bool { return c == 0 })
+}
+
+// commitInfo identifies a commit across a rebase, which keeps the author
+// date and message but changes the SHA
+type commitInfo struct {
+	sha string
+	key string
+}
+
+// commitsSince lists the commits in from..to, oldest first
+func (in *Integrator) commitsSince(from, to string) ([]commitInfo, error) {
+	out, err := runGit(in.wtPath, "log", "--reverse", "--format=%H%x1f%at%x1f%an%x1f%s", from+".."+to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list commits: %w", err)
+	}
+
+	var commits []commitInfo
+	for _, line := range strings.Split(out, "\n") {
+		if line == "" {
+			continue
+		}
+		sha, key, _ := strings.Cut(line, "\x1f")
+		commits = append(commits, commitInfo{sha: sha, key: key})
+	}
+	return commits, nil
+}
+
+// matchRewritten pairs commits from before and after a rebase. Commits
+// that became empty and were dropped have no counterpart.
+func matchRewritten(before, after []commitInfo) map[string]string {
+	byKey := make(map[string][]string)
+	for _, c := range after {
+		byKey[c.key] = append(byKey[c.key], c.sha)
+	}
+
+	rewritten := make(map[string]string)
+	for _, c := range before {
+		if shas := byKey[c.key]; len(shas) > 0 {
+			rewritten[c.sha] = shas[0]
+			byKey[c.key] = shas[1:]
+		}
+	}
+	return rewritten
+}
+
+// appendUnique appends the values not already in list
+func appendUnique(list []string, values ...string) []string {
+	seen := make(map[string]bool, len(list))
+	for _, v := range list {
+		seen[v] = true
+	}
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			list = append(list, v)
+		}
+	}
+	return list
+}
@@ -0,0 +1,93 @@
+package git
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Signature is the name and email recorded as a commit's author or
+// committer
+type Signature struct {
+	Name  string
+	Email string
+}
+
+// String formats the signature as git does, Name <email>
+func (s Signature) String() string {
+	return fmt.Sprintf("%s <%s>", s.Name, s.Email)
+}
+
+// CommitOptions controls the identities Commit records and how the commit
+// is signed. Empty author fields fall back to user.name and user.email from
+// the repository's git config, empty committer fields to git's own
+// committer identity.
+type CommitOptions struct {
+	Author    Signature
+	Committer Signature // Defaults to git's committer, or Author if git has none
+	Sign      *Signing  // Nil leaves the commit unsigned
+}
+
+// CommitterIdent returns the committer git would record in the repository
+// at dir, from GIT_COMMITTER_* or its config, and false if it has none
+func CommitterIdent(dir string) (Signature, bool) {
+	ident, err := Run(dir, "var", "GIT_COMMITTER_IDENT")
+	if err != nil {
+		return Signature{}, false
+	}
+	// Name <email> timestamp zone
+	name, rest, ok := strings.Cut(ident, " <")
+	email, _, ok2 := strings.Cut(rest, ">")
+	if !ok || !ok2 {
+		return Signature{}, false
+	}
+	return Signature{Name: name, Email: email}, true
+}
+
+// signatures fills in the author and committer for a commit, reading the
+// repository's git config for anything opts leaves out. env holds the
+// GIT_COMMITTER_* variables git needs to record that committer: those
+// configured in opts, or the author's when git has no committer of its own.
+func (r *execRepo) signatures(opts *CommitOptions) (author, committer Signature, env []string, err error) {
+	var explicit Signature
+	if opts != nil {
+		author, explicit = opts.Author, opts.Committer
+	}
+	if author.Name == "" {
+		author.Name, _ = r.git(nil, "config", "user.name")
+	}
+	if author.Email == "" {
+		author.Email, _ = r.git(nil, "config", "user.email")
+	}
+	if author.Name == "" || author.Email == "" {
+		return author, committer, nil, fmt.Errorf("no commit identity: set author_name and author_email under [commit], or git's user.name and user.email")
+	}
+
+	committer = explicit
+	if committer.Name == "" || committer.Email == "" {
+		ident, ok := CommitterIdent(r.path)
+		if !ok {
+			// git would refuse to commit; the author stands in
+			ident = author
+			if explicit.Name == "" {
+				explicit.Name = author.Name
+			}
+			if explicit.Email == "" {
+				explicit.Email = author.Email
+			}
+		}
+		if committer.Name == "" {
+			committer.Name = ident.Name
+		}
+		if committer.Email == "" {
+			committer.Email = ident.Email
+		}
+	}
+
+	if explicit.Name != "" {
+		env = append(env, "GIT_COMMITTER_NAME="+explicit.Name)
+	}
+	if explicit.Email != "" {
+		env = append(env, "GIT_COMMITTER_EMAIL="+explicit.Email)
+	}
+	return author, committer, env, nil
+}
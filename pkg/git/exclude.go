@@ -0,0 +1,142 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+)
+
+const (
+	excludeBlockStart = "# BEGIN aiflow managed excludes"
+	excludeBlockEnd   = "# END aiflow managed excludes"
+)
+
+// EnsureExcludes writes patterns into a managed block of the repository's
+// info/exclude file, replacing any block written previously. Entries outside
+// the block are left untouched.
+func (r *execRepo) EnsureExcludes(patterns []string) error {
+	gitDir, err := resolveGitDir(r.path)
+	if err != nil {
+		return err
+	}
+
+	excludePath := filepath.Join(gitDir, "info", "exclude")
+	existing, err := os.ReadFile(excludePath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read exclude file: %w", err)
+	}
+
+	content := replaceManagedBlock(string(existing), patterns)
+	if content == string(existing) {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(excludePath), 0755); err != nil {
+		return fmt.Errorf("failed to create info directory: %w", err)
+	}
+	if err := os.WriteFile(excludePath, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write exclude file: %w", err)
+	}
+
+	return nil
+}
+
+// replaceManagedBlock swaps the aiflow block in an exclude file for one
+// containing patterns
+func replaceManagedBlock(content string, patterns []string) string {
+	var kept []string
+	inBlock := false
+	for _, line := range strings.Split(strings.TrimRight(content, "\n"), "\n") {
+		switch {
+		case line == excludeBlockStart:
+			inBlock = true
+		case line == excludeBlockEnd:
+			inBlock = false
+		case !inBlock:
+			kept = append(kept, line)
+		}
+	}
+
+	var b strings.Builder
+	for _, line := range kept {
+		if line == "" && b.Len() == 0 {
+			continue
+		}
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+	b.WriteString(excludeBlockStart + "\n")
+	for _, p := range patterns {
+		b.WriteString(p + "\n")
+	}
+	b.WriteString(excludeBlockEnd + "\n")
+
+	return b.String()
+}
+
+// resolveGitDir returns the directory holding shared repository data for a
+// working tree. For linked worktrees and submodules, where .git is a file,
+// this follows the gitdir pointer and then any commondir pointer.
+func resolveGitDir(workDir string) (string, error) {
+	dotGit := filepath.Join(workDir, ".git")
+	info, err := os.Stat(dotGit)
+	if err != nil {
+		return "", fmt.Errorf("failed to find .git: %w", err)
+	}
+	if info.IsDir() {
+		return dotGit, nil
+	}
+
+	data, err := os.ReadFile(dotGit)
+	if err != nil {
+		return "", fmt.Errorf("failed to read .git file: %w", err)
+	}
+	line := strings.TrimSpace(string(data))
+	if !strings.HasPrefix(line, "gitdir:") {
+		return "", fmt.Errorf("invalid .git file in %s", workDir)
+	}
+	gitDir := strings.TrimSpace(strings.TrimPrefix(line, "gitdir:"))
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(workDir, gitDir)
+	}
+
+	if data, err := os.ReadFile(filepath.Join(gitDir, "commondir")); err == nil {
+		common := strings.TrimSpace(string(data))
+		if !filepath.IsAbs(common) {
+			common = filepath.Join(gitDir, common)
+		}
+		return filepath.Clean(common), nil
+	}
+
+	return filepath.Clean(gitDir), nil
+}
+
+// MatchesAny reports whether a slash-separated path matches any of the given
+// gitignore-style patterns
+func MatchesAny(patterns []string, path string) bool {
+	if len(patterns) == 0 {
+		return false
+	}
+	matcher := gitignore.NewMatcher(parsePatterns(patterns))
+	parts := strings.Split(filepath.ToSlash(path), "/")
+
+	// A file inside an excluded directory is excluded too
+	for i := 1; i <= len(parts); i++ {
+		if matcher.Match(parts[:i], i < len(parts)) {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePatterns converts gitignore-style strings into matcher patterns
+func parsePatterns(patterns []string) []gitignore.Pattern {
+	ps := make([]gitignore.Pattern, 0, len(patterns))
+	for _, p := range patterns {
+		ps = append(ps, gitignore.ParsePattern(p, nil))
+	}
+	return ps
+}
@@ -0,0 +1,279 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// execRepo runs the system git CLI for every operation. Unlike go-git it
+// runs hooks, honors sparse checkout and is fast on large repositories.
+type execRepo struct {
+	path string
+}
+
+// Path returns the repository path
+func (r *execRepo) Path() string {
+	return r.path
+}
+
+// ResolveBase resolves the revision a run starts from to a commit SHA. Any
+// revision git understands works: local branches, remote-tracking branches
+// of any remote (upstream/release-1.4), tags and commit SHAs. A bare branch
+// name that only exists on origin is found there.
+func (r *execRepo) ResolveBase(rev string) (string, error) {
+	if sha, err := r.ResolveRef(rev); err == nil {
+		return sha, nil
+	}
+	if sha, err := r.ResolveRef("refs/remotes/origin/" + rev); err == nil {
+		return sha, nil
+	}
+	return "", fmt.Errorf("%q is not a branch, tag or commit in %s", rev, r.path)
+}
+
+// GetDefaultBranch returns the default branch (main or master)
+func (r *execRepo) GetDefaultBranch() string {
+	if r.HasBranch("main") {
+		return "main"
+	}
+	if r.HasBranch("master") {
+		return "master"
+	}
+	// Fallback to current branch
+	branch, err := r.CurrentBranch()
+	if err != nil {
+		return "main"
+	}
+	return branch
+}
+
+// GitDir returns the repository's own git directory. For linked worktrees
+// and submodules .git is a file pointing at it.
+func (r *execRepo) GitDir() (string, error) {
+	dotGit := filepath.Join(r.path, ".git")
+	info, err := os.Stat(dotGit)
+	if err != nil {
+		return "", fmt.Errorf("failed to find git directory: %w", err)
+	}
+	if info.IsDir() {
+		return dotGit, nil
+	}
+
+	data, err := os.ReadFile(dotGit)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", dotGit, err)
+	}
+	dir, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir: ")
+	if !ok {
+		return "", fmt.Errorf("%s is not a gitdir file", dotGit)
+	}
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(r.path, dir)
+	}
+	return filepath.Clean(dir), nil
+}
+
+// CommonDir returns the git directory holding the objects and refs shared
+// by all worktrees of the repository. It is the same for the main working
+// tree and every linked worktree.
+func (r *execRepo) CommonDir() (string, error) {
+	return resolveGitDir(r.path)
+}
+
+// CurrentBranch returns the current branch name
+func (r *execRepo) CurrentBranch() (string, error) {
+	branch, err := r.git(nil, "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return "", fmt.Errorf("failed to get HEAD: %w", err)
+	}
+	return branch, nil
+}
+
+// HasBranch checks if a branch exists
+func (r *execRepo) HasBranch(name string) bool {
+	if _, err := r.git(nil, "show-ref", "--verify", "-q", "refs/heads/"+name); err == nil {
+		return true
+	}
+	_, err := r.git(nil, "show-ref", "--verify", "-q", "refs/remotes/origin/"+name)
+	return err == nil
+}
+
+// StageAll stages all changes in the working directory, skipping any path
+// that matches one of the gitignore-style exclude patterns. In sparse
+// working trees new files outside the cone are staged too.
+func (r *execRepo) StageAll(excludes ...string) error {
+	args := []string{"add", "-A"}
+	if r.IsSparse() {
+		args = append(args, "--sparse")
+	}
+	if _, err := r.git(nil, args...); err != nil {
+		return fmt.Errorf("failed to stage changes: %w", err)
+	}
+
+	staged, err := r.StagedFiles()
+	if err != nil {
+		return err
+	}
+	var skipped []string
+	for _, p := range staged {
+		if MatchesAny(excludes, p) {
+			skipped = append(skipped, p)
+		}
+	}
+	return r.Unstage(skipped)
+}
+
+// StagedFiles returns the paths with changes staged for the next commit
+func (r *execRepo) StagedFiles() ([]string, error) {
+	// -z keeps paths with special characters unquoted
+	out, err := r.git(nil, "diff", "--cached", "--name-only", "--no-renames", "-z")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get status: %w", err)
+	}
+	files := strings.FieldsFunc(out, func(c rune) bool { return c == 0 })
+	if len(files) == 0 {
+		return nil, nil
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Unstage resets the index entries for paths back to HEAD, leaving the
+// working tree untouched. Paths that are new since HEAD are dropped from the
+// index entirely.
+func (r *execRepo) Unstage(paths []string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+	args := append([]string{"reset", "-q", "--"}, paths...)
+	if _, err := r.git(nil, args...); err != nil {
+		// Without a HEAD there is nothing to reset to
+		args = append([]string{"rm", "--cached", "-q", "--ignore-unmatch", "--"}, paths...)
+		if _, err := r.git(nil, args...); err != nil {
+			return fmt.Errorf("failed to write index: %w", err)
+		}
+	}
+	return nil
+}
+
+// Commit creates a commit with the given message and returns the commit
+// SHA. Commit hooks run. Failures of a signed commit wrap ErrSigning.
+func (r *execRepo) Commit(message string, opts *CommitOptions) (string, error) {
+	if _, err := r.git(nil, "diff", "--cached", "--quiet"); err == nil {
+		return "", fmt.Errorf("nothing to commit")
+	}
+	author, _, committerEnv, err := r.signatures(opts)
+	if err != nil {
+		return "", err
+	}
+	var sign *Signing
+	if opts != nil {
+		sign = opts.Sign
+	}
+
+	env := append([]string{
+		"GIT_AUTHOR_NAME=" + author.Name,
+		"GIT_AUTHOR_EMAIL=" + author.Email,
+	}, committerEnv...)
+	args := append(sign.Args(), "commit", "-q", "-m", message)
+	if _, err := r.git(env, args...); err != nil {
+		if sign.Enabled() {
+			return "", fmt.Errorf("%w: %v", ErrSigning, err)
+		}
+		return "", fmt.Errorf("failed to commit: %w", err)
+	}
+	if _, err := Resign(r.path, sign, "HEAD", ""); err != nil {
+		// Don't leave the unsigned commit behind
+		r.git(nil, "reset", "--soft", "-q", "HEAD~1")
+		return "", err
+	}
+	return r.GetCommitHash()
+}
+
+// ResetHard resets the repository to a specific commit SHA
+func (r *execRepo) ResetHard(sha string) error {
+	if _, err := r.git(nil, "reset", "--hard", "-q", sha); err != nil {
+		return fmt.Errorf("failed to reset to %s: %w", sha, err)
+	}
+	return nil
+}
+
+// IsDirty returns true if there are uncommitted changes
+func (r *execRepo) IsDirty() (bool, error) {
+	out, err := r.git(nil, "status", "--porcelain")
+	if err != nil {
+		return false, fmt.Errorf("failed to get status: %w", err)
+	}
+	return out != "", nil
+}
+
+// GetCommitHash returns the current commit hash
+func (r *execRepo) GetCommitHash() (string, error) {
+	sha, err := r.git(nil, "rev-parse", "HEAD")
+	if err != nil {
+		return "", fmt.Errorf("failed to get HEAD: %w", err)
+	}
+	return sha, nil
+}
+
+// GetCommitMessage returns the current commit message
+func (r *execRepo) GetCommitMessage() (string, error) {
+	msg, err := r.git(nil, "log", "-1", "--format=%B", "HEAD")
+	if err != nil {
+		return "", fmt.Errorf("failed to get commit: %w", err)
+	}
+	return msg + "\n", nil
+}
+
+// ListFiles returns all tracked files in the repository
+func (r *execRepo) ListFiles() ([]string, error) {
+	out, err := r.git(nil, "ls-tree", "-r", "--name-only", "HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files: %w", err)
+	}
+	if out == "" {
+		return nil, nil
+	}
+	return strings.Split(out, "\n"), nil
+}
+
+// Run runs a git command in the working tree and returns its trimmed
+// output
+func (r *execRepo) Run(args ...string) (string, error) {
+	return Run(r.path, args...)
+}
+
+// Stream runs a git command in the working tree with its output going to
+// the terminal
+func (r *execRepo) Stream(args ...string) error {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = r.path
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("git %s: %w", subcommand(args), err)
+	}
+	return nil
+}
+
+// git runs a git command in the repository with extra environment and
+// returns its trimmed output
+func (r *execRepo) git(env []string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = r.path
+	cmd.Env = append(os.Environ(), env...)
+
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %w: %s", subcommand(args), err, msg)
+		}
+		return "", fmt.Errorf("git %s: %w", subcommand(args), err)
+	}
+	return strings.TrimRight(string(out), "\n"), nil
+}
@@ -1,251 +1,245 @@
 package git
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 
 	"github.com/go-git/go-git/v5"
-	"github.com/go-git/go-git/v5/plumbing"
-	"github.com/go-git/go-git/v5/plumbing/object"
 )
 
-// Repository wraps go-git operations
-type Repository struct {
-	repo *git.Repository
-	path string
-}
-
-// Open opens a git repository at the given path
-func Open(path string) (*Repository, error) {
-	repo, err := git.PlainOpen(path)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open repository: %w", err)
-	}
-	return &Repository{repo: repo, path: path}, nil
-}
-
-// Path returns the repository path
-func (r *Repository) Path() string {
-	return r.path
-}
+// Git is the set of git operations aiflow performs on a working tree. Open
+// returns the implementation of the backend selected with SetBackend.
+type Git interface {
+	Path() string
+	GitDir() (string, error)
+	CommonDir() (string, error)
+
+	// Branches and commits
+	CurrentBranch() (string, error)
+	HasBranch(name string) bool
+	GetDefaultBranch() string
+	ResolveBase(rev string) (string, error)
+	ResolveRef(ref string) (string, error)
+	GetCommitHash() (string, error)
+	GetCommitMessage() (string, error)
+	ListFiles() ([]string, error)
+
+	// Working tree and index
+	IsDirty() (bool, error)
+	StageAll(excludes ...string) error
+	StagedFiles() ([]string, error)
+	Unstage(paths []string) error
+	Commit(message string, opts *CommitOptions) (string, error)
+	ResetHard(sha string) error
+	CleanWorkingTree() error
+	EnsureExcludes(patterns []string) error
+
+	// Refs and work in progress snapshots
+	UpdateRef(ref, sha string) error
+	DeleteRef(ref string) error
+	SnapshotWIP(ref, message string) (string, error)
+	RestoreWIP(ref string) error
+	WIPDiff(ref string, stat bool) (string, error)
+
+	// Sparse checkout
+	IsSparse() bool
+	SparseDirs() ([]string, error)
+	SetSparse(dirs []string) error
+	AddSparse(dirs []string) error
+
+	// Run runs any other git command in the working tree and returns its
+	// output; Stream passes the output through to the terminal
+	Run(args ...string) (string, error)
+	Stream(args ...string) error
+}
+
+// Backend selects how git operations are carried out
+type Backend string
+
+const (
+	BackendGoGit Backend = "go-git" // In-process go-git, falling back to git where go-git falls short
+	BackendExec  Backend = "exec"   // The system git CLI for everything
+)
 
-// CurrentBranch returns the current branch name
-func (r *Repository) CurrentBranch() (string, error) {
-	head, err := r.repo.Head()
-	if err != nil {
-		return "", fmt.Errorf("failed to get HEAD: %w", err)
-	}
-	return head.Name().Short(), nil
-}
+// backend is the process-wide backend used by Open
+var backend = BackendGoGit
 
-// HasBranch checks if a branch exists
-func (r *Repository) HasBranch(name string) bool {
-	ref := plumbing.NewBranchReferenceName(name)
-	_, err := r.repo.Reference(ref, true)
-	if err == nil {
-		return true
+// ParseBackend validates a configured git backend. Empty means go-git.
+func ParseBackend(s string) (Backend, error) {
+	switch Backend(s) {
+	case "":
+		return BackendGoGit, nil
+	case BackendGoGit, BackendExec:
+		return Backend(s), nil
 	}
-
-	// Check remote branches
-	remoteRef := plumbing.NewRemoteReferenceName("origin", name)
-	_, err = r.repo.Reference(remoteRef, true)
-	return err == nil
+	return "", fmt.Errorf("unknown git backend %q: use go-git or exec", s)
 }
 
-// GetDefaultBranch returns the default branch (main or master)
-func (r *Repository) GetDefaultBranch() string {
-	if r.HasBranch("main") {
-		return "main"
-	}
-	if r.HasBranch("master") {
-		return "master"
-	}
-	// Fallback to current branch
-	branch, err := r.CurrentBranch()
-	if err != nil {
-		return "main"
-	}
-	return branch
+// SetBackend selects the backend Open uses from now on
+func SetBackend(b Backend) {
+	backend = b
 }
 
-// StageAll stages all changes in the working directory
-func (r *Repository) StageAll() error {
-	wt, err := r.repo.Worktree()
-	if err != nil {
-		return fmt.Errorf("failed to get worktree: %w", err)
+// Open opens the git repository containing path, which may be any
+// directory inside its working tree. Linked worktrees and submodules, whose
+// .git is a file, are opened with their shared object store and refs.
+func Open(path string) (Git, error) {
+	if backend == BackendExec {
+		root, err := discoverExec(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open repository: %w", err)
+		}
+		return &execRepo{path: root}, nil
 	}
 
-	// Add all changes
-	_, err = wt.Add(".")
+	repo, root, err := discover(path)
 	if err != nil {
-		return fmt.Errorf("failed to stage changes: %w", err)
+		return nil, fmt.Errorf("failed to open repository: %w", err)
 	}
-
-	return nil
+	return &goGitRepo{execRepo: &execRepo{path: root}, repo: repo}, nil
 }
 
-// Commit creates a commit with the given message and returns the commit SHA
-func (r *Repository) Commit(message string) (string, error) {
-	wt, err := r.repo.Worktree()
-	if err != nil {
-		return "", fmt.Errorf("failed to get worktree: %w", err)
-	}
-
-	// Check if there are staged changes
-	status, err := wt.Status()
-	if err != nil {
-		return "", fmt.Errorf("failed to get status: %w", err)
-	}
-
-	if status.IsClean() {
-		return "", fmt.Errorf("nothing to commit")
-	}
-
-	hash, err := wt.Commit(message, &git.CommitOptions{})
-	if err != nil {
-		return "", fmt.Errorf("failed to commit: %w", err)
-	}
-
-	return hash.String(), nil
+// PlainOpen opens the go-git repository at path, following the commondir
+// of linked worktrees
+func PlainOpen(path string) (*git.Repository, error) {
+	return git.PlainOpenWithOptions(path, &git.PlainOpenOptions{EnableDotGitCommonDir: true})
 }
 
-// ResetHard resets the repository to a specific commit SHA
-func (r *Repository) ResetHard(sha string) error {
-	wt, err := r.repo.Worktree()
-	if err != nil {
-		return fmt.Errorf("failed to get worktree: %w", err)
-	}
-
-	hash := plumbing.NewHash(sha)
-	err = wt.Reset(&git.ResetOptions{
-		Mode:   git.HardReset,
-		Commit: hash,
-	})
-	if err != nil {
-		return fmt.Errorf("failed to reset to %s: %w", sha, err)
+// IsGitRepo checks if the given path is a git repository
+func IsGitRepo(path string) bool {
+	if backend == BackendExec {
+		root, err := discoverExec(path)
+		return err == nil && sameDir(root, path)
 	}
-
-	return nil
+	_, err := PlainOpen(path)
+	return err == nil
 }
 
-// IsDirty returns true if there are uncommitted changes
-func (r *Repository) IsDirty() (bool, error) {
-	wt, err := r.repo.Worktree()
-	if err != nil {
-		return false, fmt.Errorf("failed to get worktree: %w", err)
+// FindRepoRoot returns the root of the working tree containing startPath:
+// the nearest enclosing repository, linked worktree or submodule
+func FindRepoRoot(startPath string) (string, error) {
+	if backend == BackendExec {
+		return discoverExec(startPath)
 	}
+	_, root, err := discover(startPath)
+	return root, err
+}
 
-	status, err := wt.Status()
+// FindRepoRootFromCwd finds the repo root from current working directory
+func FindRepoRootFromCwd() (string, error) {
+	cwd, err := os.Getwd()
 	if err != nil {
-		return false, fmt.Errorf("failed to get status: %w", err)
+		return "", fmt.Errorf("failed to get current directory: %w", err)
 	}
-
-	return !status.IsClean(), nil
+	return FindRepoRoot(cwd)
 }
 
-// GetCommitHash returns the current commit hash
-func (r *Repository) GetCommitHash() (string, error) {
-	head, err := r.repo.Head()
+// discover opens the repository whose working tree contains path, walking
+// up from path until a .git directory or file is found
+func discover(path string) (*git.Repository, string, error) {
+	abs, err := filepath.Abs(path)
 	if err != nil {
-		return "", fmt.Errorf("failed to get HEAD: %w", err)
+		return nil, "", fmt.Errorf("invalid path %s: %w", path, err)
+	}
+	// A missing directory would otherwise resolve to an enclosing repository
+	if info, err := os.Stat(abs); err != nil || !info.IsDir() {
+		return nil, "", fmt.Errorf("%s is not a directory", abs)
 	}
-	return head.Hash().String(), nil
-}
 
-// GetCommitMessage returns the current commit message
-func (r *Repository) GetCommitMessage() (string, error) {
-	head, err := r.repo.Head()
+	repo, err := git.PlainOpenWithOptions(abs, &git.PlainOpenOptions{
+		DetectDotGit:          true,
+		EnableDotGitCommonDir: true,
+	})
 	if err != nil {
-		return "", fmt.Errorf("failed to get HEAD: %w", err)
+		if errors.Is(err, git.ErrRepositoryNotExists) {
+			return nil, "", fmt.Errorf("not in a git repository")
+		}
+		return nil, "", err
 	}
-
-	commit, err := r.repo.CommitObject(head.Hash())
+	wt, err := repo.Worktree()
 	if err != nil {
-		return "", fmt.Errorf("failed to get commit: %w", err)
+		return nil, "", fmt.Errorf("%s has no working tree: %w", abs, err)
 	}
-
-	return commit.Message, nil
+	return repo, wt.Filesystem.Root(), nil
 }
 
-// ListFiles returns all tracked files in the repository
-func (r *Repository) ListFiles() ([]string, error) {
-	head, err := r.repo.Head()
+// discoverExec is discover for the exec backend: git itself finds the
+// working tree containing path
+func discoverExec(path string) (string, error) {
+	abs, err := filepath.Abs(path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get HEAD: %w", err)
+		return "", fmt.Errorf("invalid path %s: %w", path, err)
 	}
-
-	commit, err := r.repo.CommitObject(head.Hash())
-	if err != nil {
-		return nil, fmt.Errorf("failed to get commit: %w", err)
+	if info, err := os.Stat(abs); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", abs)
 	}
 
-	tree, err := commit.Tree()
+	out, err := Run(abs, "rev-parse", "--show-toplevel", "--git-common-dir")
 	if err != nil {
-		return nil, fmt.Errorf("failed to get tree: %w", err)
+		switch {
+		case strings.Contains(err.Error(), "not a git repository"):
+			return "", fmt.Errorf("not in a git repository")
+		case strings.Contains(err.Error(), "must be run in a work tree"):
+			// A bare repository or the inside of a .git directory
+			return "", fmt.Errorf("%s has no working tree", abs)
+		}
+		return "", err
 	}
-
-	var files []string
-	err = tree.Files().ForEach(func(f *object.File) error {
-		files = append(files, f.Name)
-		return nil
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to list files: %w", err)
+	root, _, _ := strings.Cut(out, "\n")
+	if root == "" {
+		return "", fmt.Errorf("%s has no working tree", abs)
 	}
-
-	return files, nil
+	return filepath.FromSlash(root), nil
 }
 
-// IsGitRepo checks if the given path is a git repository
-func IsGitRepo(path string) bool {
-	_, err := git.PlainOpen(path)
-	return err == nil
+// sameDir reports whether a and b name the same directory
+func sameDir(a, b string) bool {
+	ia, errA := os.Stat(a)
+	ib, errB := os.Stat(b)
+	return errA == nil && errB == nil && os.SameFile(ia, ib)
 }
 
-// FindRepoRoot finds the root of the git repository from the given path
-func FindRepoRoot(startPath string) (string, error) {
-	path := startPath
-	for {
-		if IsGitRepo(path) {
-			return path, nil
-		}
-
-		parent := path[:len(path)-len(path[len(path)-1:])]
-		if parent == path || parent == "" || parent == "/" {
-			return "", fmt.Errorf("not in a git repository")
-		}
-		path = parent
-	}
+// Run runs a git command in dir and returns its trimmed output. It is for
+// operations that span working trees, such as adding worktrees or merging
+// into the source repository; stderr is included in the error.
+func Run(dir string, args ...string) (string, error) {
+	return RunEnv(dir, nil, args...)
 }
 
-// FindRepoRootFromCwd finds the repo root from current working directory
-func FindRepoRootFromCwd() (string, error) {
-	cwd, err := os.Getwd()
-	if err != nil {
-		return "", fmt.Errorf("failed to get current directory: %w", err)
+// RunEnv runs a git command in dir with extra environment variables
+func RunEnv(dir string, env []string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
 	}
 
-	// Walk up looking for .git
-	path := cwd
-	for {
-		gitPath := path + "/.git"
-		if _, err := os.Stat(gitPath); err == nil {
-			return path, nil
-		}
-
-		parent := path[:len(path)-len(path[len(path)-1:])-1]
-		if parent == path || parent == "" {
-			return "", fmt.Errorf("not in a git repository")
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = strings.TrimSpace(string(output))
 		}
+		return "", fmt.Errorf("git %s: %w: %s", subcommand(args), err, msg)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
 
-		// Handle root directory
-		if parent == "/" || (len(parent) == 2 && parent[1] == ':') {
-			if _, err := os.Stat(parent + "/.git"); err == nil {
-				return parent, nil
-			}
-			return "", fmt.Errorf("not in a git repository")
+// subcommand returns the git command being run, skipping -c and -C options,
+// for error messages
+func subcommand(args []string) string {
+	for i := 0; i < len(args); i++ {
+		if args[i] == "-c" || args[i] == "-C" {
+			i++
+			continue
 		}
-
-		path = parent
+		return args[i]
 	}
+	return ""
 }
@@ -0,0 +1,282 @@
+package git
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// goGitRepo performs status, staging and commits in process with go-git.
+// Everything go-git cannot do, such as worktrees, WIP snapshots and sparse
+// checkout, comes from the embedded git CLI implementation. go-git does not
+// honor skip-worktree entries, so sparse working trees use git throughout.
+type goGitRepo struct {
+	*execRepo
+	repo *git.Repository
+}
+
+// CurrentBranch returns the current branch name
+func (r *goGitRepo) CurrentBranch() (string, error) {
+	head, err := r.repo.Head()
+	if err != nil {
+		return "", fmt.Errorf("failed to get HEAD: %w", err)
+	}
+	return head.Name().Short(), nil
+}
+
+// HasBranch checks if a branch exists
+func (r *goGitRepo) HasBranch(name string) bool {
+	ref := plumbing.NewBranchReferenceName(name)
+	_, err := r.repo.Reference(ref, true)
+	if err == nil {
+		return true
+	}
+
+	// Check remote branches
+	remoteRef := plumbing.NewRemoteReferenceName("origin", name)
+	_, err = r.repo.Reference(remoteRef, true)
+	return err == nil
+}
+
+// StageAll stages all changes in the working directory, skipping any path
+// that matches one of the gitignore-style exclude patterns
+func (r *goGitRepo) StageAll(excludes ...string) error {
+	if r.IsSparse() {
+		return r.execRepo.StageAll(excludes...)
+	}
+	wt, err := r.repo.Worktree()
+	if err != nil {
+		return fmt.Errorf("failed to get worktree: %w", err)
+	}
+	wt.Excludes = append(wt.Excludes, parsePatterns(excludes)...)
+
+	// Add all changes
+	if err := wt.AddWithOptions(&git.AddOptions{All: true}); err != nil {
+		return fmt.Errorf("failed to stage changes: %w", err)
+	}
+
+	return nil
+}
+
+// StagedFiles returns the paths with changes staged for the next commit
+func (r *goGitRepo) StagedFiles() ([]string, error) {
+	if r.IsSparse() {
+		return r.execRepo.StagedFiles()
+	}
+	wt, err := r.repo.Worktree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get worktree: %w", err)
+	}
+
+	status, err := wt.Status()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get status: %w", err)
+	}
+
+	var files []string
+	for path, s := range status {
+		if s.Staging != git.Unmodified && s.Staging != git.Untracked {
+			files = append(files, path)
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Unstage resets the index entries for paths back to HEAD, leaving the
+// working tree untouched. Paths that are new since HEAD are dropped from the
+// index entirely.
+func (r *goGitRepo) Unstage(paths []string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+	if r.IsSparse() {
+		return r.execRepo.Unstage(paths)
+	}
+
+	var tree *object.Tree
+	if head, err := r.repo.Head(); err == nil {
+		commit, err := r.repo.CommitObject(head.Hash())
+		if err != nil {
+			return fmt.Errorf("failed to get commit: %w", err)
+		}
+		if tree, err = commit.Tree(); err != nil {
+			return fmt.Errorf("failed to get tree: %w", err)
+		}
+	}
+
+	idx, err := r.repo.Storer.Index()
+	if err != nil {
+		return fmt.Errorf("failed to read index: %w", err)
+	}
+
+	for _, path := range paths {
+		var headEntry *object.TreeEntry
+		if tree != nil {
+			headEntry, _ = tree.FindEntry(path)
+		}
+
+		if headEntry == nil {
+			idx.Remove(path)
+			continue
+		}
+
+		entry, err := idx.Entry(path)
+		if err != nil {
+			entry = idx.Add(path)
+		}
+		entry.Hash = headEntry.Hash
+		entry.Mode = headEntry.Mode
+	}
+
+	if err := r.repo.Storer.SetIndex(idx); err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+	return nil
+}
+
+// Commit creates a commit with the given message and returns the commit
+// SHA. go-git only signs with an OpenPGP keyring; gpg and ssh signing is
+// left to git.
+func (r *goGitRepo) Commit(message string, opts *CommitOptions) (string, error) {
+	var sign *Signing
+	if opts != nil {
+		sign = opts.Sign
+	}
+	if r.IsSparse() || (sign.Enabled() && sign.entity == nil) {
+		return r.execRepo.Commit(message, opts)
+	}
+	author, committer, _, err := r.signatures(opts)
+	if err != nil {
+		return "", err
+	}
+	wt, err := r.repo.Worktree()
+	if err != nil {
+		return "", fmt.Errorf("failed to get worktree: %w", err)
+	}
+
+	// Check if there are staged changes
+	status, err := wt.Status()
+	if err != nil {
+		return "", fmt.Errorf("failed to get status: %w", err)
+	}
+
+	if status.IsClean() {
+		return "", fmt.Errorf("nothing to commit")
+	}
+
+	now := time.Now()
+	commitOpts := &git.CommitOptions{
+		Author:    &object.Signature{Name: author.Name, Email: author.Email, When: now},
+		Committer: &object.Signature{Name: committer.Name, Email: committer.Email, When: now},
+	}
+	if sign.Enabled() {
+		commitOpts.SignKey = sign.entity
+	}
+	hash, err := wt.Commit(message, commitOpts)
+	if err != nil {
+		if commitOpts.SignKey != nil {
+			return "", fmt.Errorf("%w: %v", ErrSigning, err)
+		}
+		return "", fmt.Errorf("failed to commit: %w", err)
+	}
+
+	return hash.String(), nil
+}
+
+// ResetHard resets the repository to a specific commit SHA
+func (r *goGitRepo) ResetHard(sha string) error {
+	if r.IsSparse() {
+		return r.execRepo.ResetHard(sha)
+	}
+	wt, err := r.repo.Worktree()
+	if err != nil {
+		return fmt.Errorf("failed to get worktree: %w", err)
+	}
+
+	hash := plumbing.NewHash(sha)
+	err = wt.Reset(&git.ResetOptions{
+		Mode:   git.HardReset,
+		Commit: hash,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to reset to %s: %w", sha, err)
+	}
+
+	return nil
+}
+
+// IsDirty returns true if there are uncommitted changes
+func (r *goGitRepo) IsDirty() (bool, error) {
+	if r.IsSparse() {
+		return r.execRepo.IsDirty()
+	}
+	wt, err := r.repo.Worktree()
+	if err != nil {
+		return false, fmt.Errorf("failed to get worktree: %w", err)
+	}
+
+	status, err := wt.Status()
+	if err != nil {
+		return false, fmt.Errorf("failed to get status: %w", err)
+	}
+
+	return !status.IsClean(), nil
+}
+
+// GetCommitHash returns the current commit hash
+func (r *goGitRepo) GetCommitHash() (string, error) {
+	head, err := r.repo.Head()
+	if err != nil {
+		return "", fmt.Errorf("failed to get HEAD: %w", err)
+	}
+	return head.Hash().String(), nil
+}
+
+// GetCommitMessage returns the current commit message
+func (r *goGitRepo) GetCommitMessage() (string, error) {
+	head, err := r.repo.Head()
+	if err != nil {
+		return "", fmt.Errorf("failed to get HEAD: %w", err)
+	}
+
+	commit, err := r.repo.CommitObject(head.Hash())
+	if err != nil {
+		return "", fmt.Errorf("failed to get commit: %w", err)
+	}
+
+	return commit.Message, nil
+}
+
+// ListFiles returns all tracked files in the repository
+func (r *goGitRepo) ListFiles() ([]string, error) {
+	head, err := r.repo.Head()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get HEAD: %w", err)
+	}
+
+	commit, err := r.repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commit: %w", err)
+	}
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tree: %w", err)
+	}
+
+	var files []string
+	err = tree.Files().ForEach(func(f *object.File) error {
+		files = append(files, f.Name)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files: %w", err)
+	}
+
+	return files, nil
+}
@@ -0,0 +1,303 @@
+package git
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+)
+
+// ErrSigning wraps every failure to produce a signed commit. Callers stop
+// rather than carry on with unsigned history.
+var ErrSigning = errors.New("commit signing failed")
+
+// PassphraseEnv holds the passphrase of an encrypted signing keyring
+const PassphraseEnv = "AIFLOW_SIGNING_PASSPHRASE"
+
+// Signing describes how commits are signed. A nil *Signing leaves it to
+// git's own config; an empty Format never signs.
+type Signing struct {
+	Format  string // gpg.format: "openpgp", "ssh" or "x509"; empty for unsigned
+	Key     string // user.signingkey: OpenPGP key ID or SSH key path; empty lets git choose
+	Keyring string // OpenPGP secret keyring file to sign with in process instead of gpg
+
+	entity *openpgp.Entity
+}
+
+// ResolveSigning combines aiflow's sign setting with the git config of the
+// repository at dir. An empty mode follows commit.gpgsign, gpg.format and
+// user.signingkey; "off" never signs; "openpgp" and "ssh" always do. A
+// keyring is loaded and unlocked here so a bad key fails before any
+// commit is attempted.
+func ResolveSigning(dir, mode, key, keyring string) (*Signing, error) {
+	config := func(name string) string {
+		v, _ := Run(dir, "config", name)
+		return v
+	}
+
+	var s *Signing
+	switch mode {
+	case "off":
+		return &Signing{}, nil
+	case "":
+		if v, _ := Run(dir, "config", "--bool", "commit.gpgsign"); v != "true" {
+			return &Signing{}, nil
+		}
+		s = &Signing{Format: config("gpg.format")}
+	case "openpgp", "ssh":
+		s = &Signing{Format: mode}
+	default:
+		return nil, fmt.Errorf("unknown sign mode %q: use off, openpgp or ssh", mode)
+	}
+
+	if s.Format == "" {
+		s.Format = "openpgp"
+	}
+	s.Key = key
+	if s.Key == "" {
+		s.Key = config("user.signingkey")
+	}
+	if s.Format == "ssh" && s.Key == "" {
+		return nil, fmt.Errorf("%w: ssh signing needs a key; set signing_key or git's user.signingkey", ErrSigning)
+	}
+
+	if keyring != "" {
+		if s.Format != "openpgp" {
+			return nil, fmt.Errorf("%w: a signing keyring only works with openpgp signing", ErrSigning)
+		}
+		s.Keyring = keyring
+		entity, err := loadSigningKey(keyring, s.Key)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrSigning, err)
+		}
+		s.entity = entity
+	}
+
+	return s, nil
+}
+
+// Enabled reports whether commits are signed
+func (s *Signing) Enabled() bool {
+	return s != nil && s.Format != ""
+}
+
+// String describes the signing setup for messages
+func (s *Signing) String() string {
+	if !s.Enabled() {
+		return "unsigned"
+	}
+	desc := s.Format
+	if s.Key != "" {
+		desc += " key " + s.Key
+	}
+	if s.Keyring != "" {
+		desc += " from " + s.Keyring
+	}
+	return desc
+}
+
+// Args returns the git -c options for commands that create commits. With
+// gpg or ssh-keygen doing the signing git signs by itself; keyring
+// signatures are added afterwards with Resign, and git must not try to
+// sign on its own.
+func (s *Signing) Args() []string {
+	if s == nil {
+		return nil
+	}
+	if !s.Enabled() || s.entity != nil {
+		return []string{"-c", "commit.gpgsign=false"}
+	}
+	args := []string{"-c", "commit.gpgsign=true", "-c", "gpg.format=" + s.Format}
+	if s.Key != "" {
+		args = append(args, "-c", "user.signingkey="+s.Key)
+	}
+	return args
+}
+
+// CommitTreeArgs returns the options that make git commit-tree sign, as it
+// ignores commit.gpgsign. Use them together with Args, which selects the
+// format and key.
+func (s *Signing) CommitTreeArgs() []string {
+	if !s.Enabled() || s.entity != nil {
+		return nil
+	}
+	if s.Key != "" {
+		return []string{"--gpg-sign=" + s.Key}
+	}
+	return []string{"--gpg-sign"}
+}
+
+// Resign signs the commits in since..ref of the repository at dir with the
+// keyring, or only ref's commit when since is empty, and moves ref (HEAD or
+// a branch) to the rewritten history. Parents are remapped as commits are
+// rewritten. It returns the old -> new SHA of every rewritten commit and
+// does nothing unless signing uses a keyring.
+func Resign(dir string, s *Signing, ref, since string) (map[string]string, error) {
+	rewritten := make(map[string]string)
+	if s == nil || s.entity == nil {
+		return rewritten, nil
+	}
+
+	args := []string{"rev-list", "--reverse", "--topo-order", ref, "-1"}
+	if since != "" {
+		args = []string{"rev-list", "--reverse", "--topo-order", since + ".." + ref}
+	}
+	out, err := Run(dir, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to list commits: %v", ErrSigning, err)
+	}
+	if out == "" {
+		return rewritten, nil
+	}
+
+	oldHead, err := Run(dir, "rev-parse", ref)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to resolve %s: %v", ErrSigning, ref, err)
+	}
+	newHead := oldHead
+	for _, sha := range strings.Split(out, "\n") {
+		raw, err := gitOutput(dir, nil, "cat-file", "commit", sha)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to read commit %s: %v", ErrSigning, sha, err)
+		}
+		signed, err := signCommit(raw, s.entity, rewritten)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrSigning, err)
+		}
+		newSHA, err := gitOutput(dir, signed, "hash-object", "-t", "commit", "-w", "--stdin")
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to write signed commit: %v", ErrSigning, err)
+		}
+		rewritten[sha] = strings.TrimSpace(string(newSHA))
+		newHead = rewritten[sha]
+	}
+
+	if _, err := Run(dir, "update-ref", "-m", "aiflow: sign commits", ref, newHead, oldHead); err != nil {
+		return nil, fmt.Errorf("%w: failed to update %s: %v", ErrSigning, ref, err)
+	}
+	return rewritten, nil
+}
+
+// signCommit replaces any signature on a raw commit object with one made
+// by entity, remapping parents that were rewritten
+func signCommit(raw []byte, entity *openpgp.Entity, rewritten map[string]string) ([]byte, error) {
+	header, message, ok := bytes.Cut(raw, []byte("\n\n"))
+	if !ok {
+		header, message = bytes.TrimSuffix(raw, []byte("\n")), nil
+	}
+
+	var payload bytes.Buffer
+	inSig := false
+	for _, line := range strings.Split(string(header), "\n") {
+		switch {
+		case strings.HasPrefix(line, "gpgsig ") || strings.HasPrefix(line, "gpgsig-sha256 "):
+			inSig = true
+			continue
+		case inSig && strings.HasPrefix(line, " "):
+			continue
+		}
+		inSig = false
+		if parent, ok := strings.CutPrefix(line, "parent "); ok {
+			if sha, ok := rewritten[parent]; ok {
+				line = "parent " + sha
+			}
+		}
+		payload.WriteString(line + "\n")
+	}
+	payload.WriteString("\n")
+	payload.Write(message)
+
+	var sig bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&sig, entity, bytes.NewReader(payload.Bytes()), nil); err != nil {
+		return nil, fmt.Errorf("failed to sign commit: %w", err)
+	}
+
+	// The signature goes last in the header, continuation lines indented
+	headerEnd := payload.Len() - len(message) - 1
+	var signed bytes.Buffer
+	signed.Write(payload.Bytes()[:headerEnd])
+	signed.WriteString("gpgsig " + strings.ReplaceAll(strings.TrimSpace(sig.String()), "\n", "\n ") + "\n")
+	signed.Write(payload.Bytes()[headerEnd:])
+	return signed.Bytes(), nil
+}
+
+// loadSigningKey reads an armored or binary secret keyring and returns the
+// key matching id (a key ID, fingerprint or email), or the first secret key
+// when id is empty. Encrypted keys are unlocked with PassphraseEnv.
+func loadSigningKey(path, id string) (*openpgp.Entity, error) {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		home, _ := os.UserHomeDir()
+		path = filepath.Join(home, rest)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing keyring: %w", err)
+	}
+	keys, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+	if err != nil {
+		if keys, err = openpgp.ReadKeyRing(bytes.NewReader(data)); err != nil {
+			return nil, fmt.Errorf("failed to parse signing keyring %s: %w", path, err)
+		}
+	}
+
+	id = strings.ToUpper(strings.TrimSuffix(strings.TrimPrefix(id, "0x"), "!"))
+	for _, entity := range keys {
+		if entity.PrivateKey == nil || (id != "" && !keyMatches(entity, id)) {
+			continue
+		}
+		if entity.PrivateKey.Encrypted {
+			passphrase := os.Getenv(PassphraseEnv)
+			if passphrase == "" {
+				return nil, fmt.Errorf("signing key is encrypted; set %s", PassphraseEnv)
+			}
+			if err := entity.DecryptPrivateKeys([]byte(passphrase)); err != nil {
+				return nil, fmt.Errorf("failed to unlock signing key: %w", err)
+			}
+		}
+		return entity, nil
+	}
+
+	if id != "" {
+		return nil, fmt.Errorf("no secret key %s in %s", id, path)
+	}
+	return nil, fmt.Errorf("no secret key in %s", path)
+}
+
+// keyMatches reports whether an upper-cased key ID, fingerprint or email
+// identifies entity
+func keyMatches(entity *openpgp.Entity, id string) bool {
+	if strings.HasSuffix(fmt.Sprintf("%X", entity.PrimaryKey.Fingerprint), id) {
+		return true
+	}
+	for _, ident := range entity.Identities {
+		if ident.UserId != nil && strings.EqualFold(ident.UserId.Email, id) {
+			return true
+		}
+	}
+	return false
+}
+
+// gitOutput runs git in dir with input on stdin and returns its untrimmed
+// output
+func gitOutput(dir string, input []byte, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	if input != nil {
+		cmd.Stdin = bytes.NewReader(input)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,101 @@
+package git
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// IsSparse reports whether the working tree uses sparse checkout
+func (r *execRepo) IsSparse() bool {
+	out, err := r.git(nil, "config", "--bool", "core.sparseCheckout")
+	return err == nil && out == "true"
+}
+
+// SparseDirs returns the directories of the sparse-checkout cone
+func (r *execRepo) SparseDirs() ([]string, error) {
+	out, err := r.git(nil, "sparse-checkout", "list")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sparse-checkout: %w", err)
+	}
+	if out == "" {
+		return nil, nil
+	}
+	return strings.Split(out, "\n"), nil
+}
+
+// SetSparse narrows the working tree to dirs with cone patterns. Files in
+// the repository root are always included.
+func (r *execRepo) SetSparse(dirs []string) error {
+	args := append([]string{"sparse-checkout", "set", "--cone", "--"}, dirs...)
+	if _, err := r.git(nil, args...); err != nil {
+		return fmt.Errorf("failed to set sparse-checkout: %w", err)
+	}
+	return nil
+}
+
+// AddSparse widens the sparse-checkout cone by dirs
+func (r *execRepo) AddSparse(dirs []string) error {
+	if len(dirs) == 0 {
+		return nil
+	}
+	args := append([]string{"sparse-checkout", "add", "--"}, dirs...)
+	if _, err := r.git(nil, args...); err != nil {
+		return fmt.Errorf("failed to widen sparse-checkout: %w", err)
+	}
+	return nil
+}
+
+// ConeDirs returns the minimal set of directories whose cone holds every
+// path. Paths ending in / are directories; files need their parent
+// directory, and none at all in the repository root.
+func ConeDirs(paths []string) []string {
+	var dirs []string
+	for _, p := range paths {
+		if dir := coneDir(p); dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	sort.Strings(dirs)
+
+	// Sorted, a directory comes before everything below it
+	var minimal []string
+	for _, d := range dirs {
+		if !underAny(minimal, d) {
+			minimal = append(minimal, d)
+		}
+	}
+	return minimal
+}
+
+// ConeCovers reports whether the cone of dirs includes path p
+func ConeCovers(dirs []string, p string) bool {
+	dir := coneDir(p)
+	return dir == "" || underAny(dirs, dir)
+}
+
+// coneDir returns the directory a path needs in the cone: the path itself
+// when it ends in /, otherwise its parent. Empty means the root.
+func coneDir(p string) string {
+	p = strings.ReplaceAll(p, "\\", "/")
+	isDir := strings.HasSuffix(p, "/")
+	p = strings.TrimPrefix(path.Clean("/"+p), "/")
+	if !isDir {
+		p = path.Dir(p)
+	}
+	if p == "." || p == "" {
+		return ""
+	}
+	return p
+}
+
+// underAny reports whether dir is one of dirs or below one of them
+func underAny(dirs []string, dir string) bool {
+	for _, d := range dirs {
+		if dir == d || strings.HasPrefix(dir, d+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// WIPRef returns the ref that holds the work in progress of an interrupted
+// task
+func WIPRef(runID, taskID string) string {
+	return fmt.Sprintf("refs/aiflow/wip/%s/%s", runID, taskID)
+}
+
+// RerunRef returns the ref that holds the result of re-running a task
+// until it is kept or discarded
+func RerunRef(runID, taskID string) string {
+	return fmt.Sprintf("refs/aiflow/rerun/%s/%s", runID, taskID)
+}
+
+// BackupRef returns a ref for history a rollback of a run discards
+func BackupRef(runID string, at time.Time) string {
+	return fmt.Sprintf("refs/aiflow/backup/%s/%d", runID, at.Unix())
+}
+
+// SnapshotWIP records the working tree, including untracked files but not
+// ignored ones, as a commit on top of HEAD and points ref at it. HEAD, the
+// index and the working tree are left untouched. Returns the snapshot SHA.
+func (r *execRepo) SnapshotWIP(ref, message string) (string, error) {
+	tmpDir, err := os.MkdirTemp("", "aiflow-wip-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Build the snapshot tree in a scratch index so the real one keeps
+	// whatever the agent staged
+	env := []string{"GIT_INDEX_FILE=" + filepath.Join(tmpDir, "index")}
+	if _, err := r.git(env, "read-tree", "HEAD"); err != nil {
+		return "", fmt.Errorf("failed to read HEAD tree: %w", err)
+	}
+	if _, err := r.git(env, "add", "-A", "."); err != nil {
+		return "", fmt.Errorf("failed to stage work in progress: %w", err)
+	}
+	tree, err := r.git(env, "write-tree")
+	if err != nil {
+		return "", fmt.Errorf("failed to write tree: %w", err)
+	}
+
+	// Snapshots are internal refs; don't fail for want of an identity
+	if _, err := r.git(nil, "config", "user.email"); err != nil {
+		env = append(env, "GIT_AUTHOR_NAME=aiflow", "GIT_AUTHOR_EMAIL=aiflow@localhost",
+			"GIT_COMMITTER_NAME=aiflow", "GIT_COMMITTER_EMAIL=aiflow@localhost")
+	}
+	sha, err := r.git(env, "commit-tree", tree, "-p", "HEAD", "-m", message)
+	if err != nil {
+		return "", fmt.Errorf("failed to create snapshot commit: %w", err)
+	}
+	if err := r.UpdateRef(ref, sha); err != nil {
+		return "", err
+	}
+	return sha, nil
+}
+
+// CleanWorkingTree discards uncommitted changes and untracked files,
+// leaving ignored files (including aiflow's own) in place
+func (r *execRepo) CleanWorkingTree() error {
+	if _, err := r.git(nil, "reset", "--hard", "-q", "HEAD"); err != nil {
+		return fmt.Errorf("failed to reset working tree: %w", err)
+	}
+	if _, err := r.git(nil, "clean", "-fdq"); err != nil {
+		return fmt.Errorf("failed to remove untracked files: %w", err)
+	}
+	return nil
+}
+
+// RestoreWIP applies the changes of a snapshot to the working tree without
+// staging them. HEAD may have moved since the snapshot was taken; the
+// changes are merged three-way where possible.
+func (r *execRepo) RestoreWIP(ref string) error {
+	patch, err := r.git(nil, "diff", "--binary", ref+"^", ref)
+	if err != nil {
+		return fmt.Errorf("failed to read work in progress: %w", err)
+	}
+	if patch == "" {
+		return nil
+	}
+
+	cmd := exec.Command("git", "apply", "--3way", "--whitespace=nowarn")
+	cmd.Dir = r.path
+	cmd.Stdin = strings.NewReader(patch + "\n")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to apply work in progress: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	// --3way stages what it applies; leave the changes unstaged like the
+	// agent originally wrote them
+	if _, err := r.git(nil, "reset", "-q"); err != nil {
+		return fmt.Errorf("failed to unstage restored changes: %w", err)
+	}
+	return nil
+}
+
+// WIPDiff returns the changes recorded in a snapshot, as a diffstat or a
+// full patch
+func (r *execRepo) WIPDiff(ref string, stat bool) (string, error) {
+	args := []string{"diff", ref + "^", ref}
+	if stat {
+		args = []string{"diff", "--stat", ref + "^", ref}
+	}
+	out, err := r.git(nil, args...)
+	if err != nil {
+		return "", fmt.Errorf("failed to diff work in progress: %w", err)
+	}
+	return out, nil
+}
+
+// UpdateRef points ref at sha
+func (r *execRepo) UpdateRef(ref, sha string) error {
+	if _, err := r.git(nil, "update-ref", ref, sha); err != nil {
+		return fmt.Errorf("failed to update %s: %w", ref, err)
+	}
+	return nil
+}
+
+// DeleteRef removes ref if it exists
+func (r *execRepo) DeleteRef(ref string) error {
+	if _, err := r.git(nil, "update-ref", "-d", ref); err != nil {
+		return fmt.Errorf("failed to delete %s: %w", ref, err)
+	}
+	return nil
+}
+
+// ResolveRef returns the SHA ref points at
+func (r *execRepo) ResolveRef(ref string) (string, error) {
+	sha, err := r.git(nil, "rev-parse", "--verify", "-q", ref+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", ref, err)
+	}
+	return sha, nil
+}